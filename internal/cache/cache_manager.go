@@ -69,8 +69,9 @@ func (cm *CacheManager) generateKey(prefix string, data interface{}) string {
 
 // 获取缓存项
 func (cm *CacheManager) Get(key string) (interface{}, bool) {
-	cm.mutex.RLock()
-	defer cm.mutex.RUnlock()
+	// 读取时会删除过期项并更新统计，需要写锁
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
 
 	item, exists := cm.items[key]
 	if !exists {
@@ -140,8 +141,8 @@ func (cm *CacheManager) Clear() {
 
 // 获取缓存统计
 func (cm *CacheManager) GetStats() CacheStats {
-	cm.mutex.RLock()
-	defer cm.mutex.RUnlock()
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
 
 	cm.stats.MemoryUsage = cm.calculateMemoryUsage()
 	return cm.stats
@@ -270,3 +271,39 @@ func (cm *CacheManager) GetRuleMatch(logLine string) (interface{}, bool) {
 	key := cm.generateKey("rule", logLine)
 	return cm.Get(key)
 }
+
+// 按日志模板缓存 AI 分析结果
+func (cm *CacheManager) CacheTemplateAnalysis(templateID string, analysis interface{}) {
+	if !cm.config.Enabled || templateID == "" {
+		return
+	}
+
+	cm.Set("tpl:"+templateID, analysis, cm.config.AITTL)
+}
+
+// 按日志模板获取 AI 分析结果
+func (cm *CacheManager) GetTemplateAnalysis(templateID string) (interface{}, bool) {
+	if !cm.config.Enabled || templateID == "" {
+		return nil, false
+	}
+
+	return cm.Get("tpl:" + templateID)
+}
+
+// 按异常指纹缓存 AI 分析结果
+func (cm *CacheManager) CacheExceptionAnalysis(fingerprint string, analysis interface{}) {
+	if !cm.config.Enabled || fingerprint == "" {
+		return
+	}
+
+	cm.Set("exc:"+fingerprint, analysis, cm.config.AITTL)
+}
+
+// 按异常指纹获取 AI 分析结果
+func (cm *CacheManager) GetExceptionAnalysis(fingerprint string) (interface{}, bool) {
+	if !cm.config.Enabled || fingerprint == "" {
+		return nil, false
+	}
+
+	return cm.Get("exc:" + fingerprint)
+}
@@ -1,73 +1,400 @@
 package cmd
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/xurenlu/aipipe/internal/input"
+	"github.com/xurenlu/aipipe/internal/pipeline"
+	"github.com/xurenlu/aipipe/internal/record"
 	"github.com/xurenlu/aipipe/internal/utils"
 )
 
+var (
+	analyzeFiles []string
+	analyzeSince string
+	analyzeUntil string
+)
+
+// 分析统计
+type analysisStats struct {
+	lineCount     int
+	filteredCount int
+	alertCount    int
+	skippedCount  int // 时间窗口外跳过的行数
+	repeatCount   int // 合并的重复异常告警数
+	input         input.LineStats
+}
+
 // analyzeCmd 代表分析命令
 var analyzeCmd = &cobra.Command{
-	Use:   "analyze",
-	Short: "分析标准输入的日志",
+	Use:   "analyze [file...]",
+	Short: "分析标准输入或日志文件",
 	Long: `分析从标准输入读取的日志内容，使用 AI 判断日志重要性。
 
+指定 --file 或文件参数时离线分析日志文件，支持:
+- 多个路径和通配符 (如 'app.log*')
+- 透明解压 gzip/zstd/bzip2 压缩的轮转文件
+- 按日志时间（或轮转后缀）从旧到新依次处理
+- 将 Java/Python/Go 堆栈等多行内容合并为一个事件，相同指纹的异常只告警一次
+
+--since/--until 按每条日志解析出的时间戳只分析指定时间窗口，支持相对时间
+(如 2h、15m、1d) 和绝对时间 (如 "2025-10-17 14:30")。对较大的未压缩文件
+会按时间二分查找直接定位，无需读取整个文件。
+
 示例:
   tail -f app.log | aipipe analyze
   echo "ERROR: Database connection failed" | aipipe analyze
-  cat logfile.txt | aipipe analyze --format nginx`,
+  cat logfile.txt | aipipe analyze --format nginx
+  aipipe analyze --file app.log.1.gz
+  aipipe analyze --file '/var/log/app/app.log*' --format java
+  aipipe analyze --file app.log --since "2025-10-17 14:20" --until "2025-10-17 14:35"
+  aipipe analyze --file app.log --since 2h`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("🚀 AIPipe 分析模式 - 监控 %s 格式日志\n", logFormat)
-		fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+		timeRange, err := record.ParseTimeRange(analyzeSince, analyzeUntil, time.Now())
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
 
-		// 从标准输入读取日志
-		scanner := bufio.NewScanner(os.Stdin)
-		scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+		lineOptions := input.NewLineOptions(globalConfig.Input, inputEncoding)
+		if err := lineOptions.Validate(); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
 
-		lineCount := 0
-		filteredCount := 0
-		alertCount := 0
+		// 第一次中断时停止读取并取消正在进行的分析，之后恢复默认处理，再次中断可以强制退出
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			stop()
+		}()
 
-		for scanner.Scan() {
-			line := scanner.Text()
-			lineCount++
+		analyzer := utils.NewAnalyzer(globalConfig)
+		defer closeAnalyzer(analyzer)
 
-			if line == "" {
-				continue
-			}
+		patterns := append(append([]string{}, analyzeFiles...), args...)
 
-			// 使用 AI 分析日志
-			analysis, err := utils.AnalyzeLog(line, logFormat, globalConfig)
-			if err != nil {
-				fmt.Printf("❌ 分析失败: %v\n", err)
-				continue
+		// 分析标准输入（如 tail -f 的输出）时对重要日志发送通知，离线分析历史文件时不发送
+		var notifier *alertNotifier
+		if len(patterns) == 0 {
+			notifier = newAlertNotifier()
+		}
+
+		stats := &analysisStats{}
+		workers, err := startAnalyzePipeline(ctx, analyzer, stats, notifier)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+		defer workers.Close()
+
+		if len(patterns) > 0 {
+			if err := analyzeArchives(patterns, timeRange, lineOptions, workers, analyzer, stats); err != nil {
+				fmt.Printf("❌ %v\n", err)
+				return
 			}
+		} else {
+			fmt.Printf("🚀 AIPipe 分析模式 - 监控 %s 格式日志\n", logFormat)
+			printTimeRange(timeRange)
+			fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 
-			if analysis.Important {
-				fmt.Printf("⚠️  [重要] %s\n", line)
-				fmt.Printf("   📝 摘要: %s\n", analysis.Summary)
-				alertCount++
-			} else {
-				if showNotImportant {
-					fmt.Printf("🔇 [过滤] %s\n", line)
+			// 从标准输入读取日志，输入可能是持续的流，空闲时输出暂存的多行事件
+			filter := record.NewTimeFilter(timeRange)
+			err := scanEvents(os.Stdin, lineOptions, stats, true, func(event string) bool {
+				if keep, _ := filter.Check(event); !keep {
+					stats.skippedCount++
+					return true
 				}
-				filteredCount++
+				return submitLine(workers, analyzer, event, logFormat, stats) && ctx.Err() == nil
+			})
+			if err != nil {
+				fmt.Printf("❌ 读取输入失败: %v\n", err)
+				return
 			}
 		}
 
-		if err := scanner.Err(); err != nil {
-			fmt.Printf("❌ 读取输入失败: %v\n", err)
-			return
+		// 等待已读取的日志分析完成
+		workers.Close()
+		notifier.Wait()
+		if ctx.Err() != nil {
+			fmt.Println("\n🛑 分析已中断")
 		}
 
 		fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-		fmt.Printf("📊 统计: 总计 %d 行, 过滤 %d 行, 告警 %d 次\n", lineCount, filteredCount, alertCount)
+		fmt.Printf("📊 统计: 总计 %d 行, 过滤 %d 行, 告警 %d 次\n", stats.lineCount, stats.filteredCount, stats.alertCount)
+		if stats.repeatCount > 0 {
+			fmt.Printf("🔁 重复异常已合并 %d 次 (共 %d 种异常, 使用 'aipipe exceptions' 查看详情)\n", stats.repeatCount, len(analyzer.Exceptions()))
+		}
+		if !timeRange.IsZero() {
+			fmt.Printf("⏱️  时间窗口外跳过 %d 行\n", stats.skippedCount)
+		}
+		printLineStats(stats.input)
 	},
 }
 
+// 显示输入处理统计（仅在有转码、截断等情况时显示）
+func printLineStats(s input.LineStats) {
+	if s.Transcoded+s.Truncated+s.Split+s.Skipped+s.Binary == 0 {
+		return
+	}
+	fmt.Printf("🧹 输入处理: 转码 %d 行, 截断 %d 行, 拆分 %d 行, 丢弃超长行 %d 行, 丢弃二进制行 %d 行\n",
+		s.Transcoded, s.Truncated, s.Split, s.Skipped, s.Binary)
+}
+
+// 显示时间窗口
+func printTimeRange(r record.TimeRange) {
+	if !r.Since.IsZero() {
+		fmt.Printf("⏱️  开始时间: %s\n", r.Since.Format("2006-01-02 15:04:05"))
+	}
+	if !r.Until.IsZero() {
+		fmt.Printf("⏱️  结束时间: %s\n", r.Until.Format("2006-01-02 15:04:05"))
+	}
+}
+
+// 按时间顺序分析多个（可能压缩的）日志文件
+func analyzeArchives(patterns []string, timeRange record.TimeRange, lineOptions input.LineOptions, workers *pipeline.Pipeline, analyzer *utils.Analyzer, stats *analysisStats) error {
+	paths, err := input.ExpandPaths(patterns)
+	if err != nil {
+		return err
+	}
+
+	files, err := input.SortChronologically(paths)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("🚀 AIPipe 分析模式 - 分析 %d 个 %s 格式日志文件\n", len(files), logFormat)
+	printTimeRange(timeRange)
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	for i, file := range files {
+		if outsideTimeRange(files, i, timeRange) {
+			fmt.Fprintf(os.Stderr, "⏭️  [%d/%d] %s: 不在时间窗口内，跳过\n", i+1, len(files), file.Path)
+			continue
+		}
+		if err := analyzeArchive(file, i+1, len(files), timeRange, lineOptions, workers, analyzer, stats); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 判断整个文件是否在时间窗口外：文件 i 覆盖 [Start_i, Start_i+1)
+func outsideTimeRange(files []input.ArchiveFile, i int, timeRange record.TimeRange) bool {
+	if !files[i].HasTime {
+		return false
+	}
+	if !timeRange.Until.IsZero() && files[i].Start.After(timeRange.Until) {
+		return true
+	}
+	if !timeRange.Since.IsZero() && i+1 < len(files) && files[i+1].HasTime {
+		return files[i+1].Start.Before(timeRange.Since)
+	}
+	return false
+}
+
+// 分析单个日志文件，并在标准错误输出进度
+func analyzeArchive(file input.ArchiveFile, index, total int, timeRange record.TimeRange, lineOptions input.LineOptions, workers *pipeline.Pipeline, analyzer *utils.Analyzer, stats *analysisStats) error {
+	reader, err := input.OpenSince(file.Path, timeRange.Since)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	compression := ""
+	if reader.Compression != "" {
+		compression = fmt.Sprintf(", %s", reader.Compression)
+	}
+	fmt.Fprintf(os.Stderr, "📄 [%d/%d] %s (%.2f MB%s)\n", index, total, file.Path, float64(file.Size)/1024/1024, compression)
+
+	fileLines := 0
+	lastProgress := time.Now()
+	filter := record.NewTimeFilter(timeRange)
+	err = scanEvents(reader, lineOptions, stats, false, func(line string) bool {
+		keep, past := filter.Check(line)
+		if past {
+			// 文件按时间有序，超过结束时间后无需继续读取
+			return false
+		}
+
+		if keep {
+			fileLines++
+			if !submitLine(workers, analyzer, line, logFormat, stats) {
+				// 已中断
+				return false
+			}
+		} else {
+			stats.skippedCount++
+		}
+
+		if time.Since(lastProgress) >= time.Second {
+			fmt.Fprintf(os.Stderr, "⏳ [%d/%d] %s: %.1f%% (%d 行)\n", index, total, file.Path, reader.Progress()*100, fileLines)
+			lastProgress = time.Now()
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("读取文件失败 %s: %w", file.Path, err)
+	}
+
+	fmt.Fprintf(os.Stderr, "✅ [%d/%d] %s: 100%% (%d 行)\n", index, total, file.Path, fileLines)
+	return nil
+}
+
+// 逐行读取输入（转码、处理超长行和二进制行），fn 返回 false 时停止读取
+func scanLines(r io.Reader, opts input.LineOptions, stats *analysisStats, fn func(line string) bool) error {
+	reader := input.NewLineReader(r, opts)
+	defer func() {
+		s := reader.Stats()
+		stats.input.Transcoded += s.Transcoded
+		stats.input.Truncated += s.Truncated
+		stats.input.Split += s.Split
+		stats.input.Skipped += s.Skipped
+		stats.input.Binary += s.Binary
+	}()
+
+	for {
+		line, err := reader.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !fn(line) {
+			return nil
+		}
+	}
+}
+
+// 逐个读取多行事件（堆栈等续行合并到前一条日志），fn 返回 false 时停止读取。
+// follow 为 true 时输入是持续的流（如 tail -f），空闲时也输出暂存的事件；fn 不会并发调用
+func scanEvents(r io.Reader, opts input.LineOptions, stats *analysisStats, follow bool, fn func(event string) bool) error {
+	var stopped atomic.Bool
+	assembler := pipeline.NewEventAssembler(globalConfig.Exceptions.MaxLines, pipeline.DefaultAssembleIdle, func(entry pipeline.Entry) {
+		if !stopped.Load() && !fn(entry.Line) {
+			stopped.Store(true)
+		}
+	})
+	if follow {
+		stopFlush := make(chan struct{})
+		defer close(stopFlush)
+		go assembler.FlushEvery(stopFlush)
+	}
+
+	err := scanLines(r, opts, stats, func(line string) bool {
+		assembler.Add(pipeline.Entry{Line: line}, time.Now())
+		return !stopped.Load()
+	})
+	if err != nil {
+		return err
+	}
+
+	assembler.Close()
+	return nil
+}
+
+// 创建分析流水线：多个协程并发分析，结果按输入顺序输出；ctx 取消时中止正在进行的分析。
+// notifier 不为 nil 时对重要日志发送通知
+func startAnalyzePipeline(ctx context.Context, analyzer *utils.Analyzer, stats *analysisStats, notifier *alertNotifier) (*pipeline.Pipeline, error) {
+	cfg := pipeline.ConfigFrom(globalConfig)
+	// 分析已有的输入时不丢弃日志，队列满时等待
+	cfg.Overflow = pipeline.OverflowBlock
+	cfg.QueueTimeout = 0
+
+	p, err := pipeline.New(cfg, func(ctx context.Context, entry pipeline.Entry) (interface{}, error) {
+		return analyzer.AnalyzeEntry(ctx, entry)
+	}, func(result pipeline.Result) {
+		recordAnalysis(result, stats, notifier)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建分析队列失败: %w", err)
+	}
+	p.Start(ctx)
+	return p, nil
+}
+
+// 匹配日志模板和规则后提交单个事件进行分析，空行直接忽略，返回 false 表示分析已中断
+func submitLine(workers *pipeline.Pipeline, analyzer *utils.Analyzer, line, format string, stats *analysisStats) bool {
+	stats.lineCount++
+	if strings.TrimSpace(line) == "" {
+		return true
+	}
+	entry := pipeline.Entry{Format: format, Line: line}
+	analyzer.Prepare(&entry)
+	return workers.Submit(entry)
+}
+
+// 输出单行日志的分析结果并更新统计，重要日志同时发送通知
+func recordAnalysis(result pipeline.Result, stats *analysisStats, notifier *alertNotifier) {
+	if result.Err != nil {
+		if !errors.Is(result.Err, context.Canceled) {
+			fmt.Printf("❌ 分析失败: %v\n", result.Err)
+		}
+		return
+	}
+
+	line := result.Entry.Line
+	analysis := result.Value.(*utils.LogAnalysis)
+	if analysis.Important && analysis.Repeat {
+		// 相同指纹的异常在重复告警窗口内只告警一次
+		if showNotImportant {
+			fmt.Printf("🔁 [重复] %s (指纹: %s, 第 %d 次)\n", analysis.Exception, analysis.Fingerprint, analysis.Occurrences)
+		}
+		stats.repeatCount++
+	} else if analysis.Important {
+		fmt.Printf("⚠️  [重要] %s\n", utils.HighlightLine(line, analysis.Highlight))
+		fmt.Printf("   📝 摘要: %s\n", analysis.Summary)
+		printFingerprint(analysis)
+		printRule(analysis)
+		notifier.Notify(result.Entry, analysis)
+		stats.alertCount++
+	} else {
+		if showNotImportant {
+			fmt.Printf("🔇 [过滤] %s\n", utils.HighlightLine(line, analysis.Highlight))
+			printRule(analysis)
+		}
+		stats.filteredCount++
+	}
+}
+
+// 显示异常指纹
+func printFingerprint(analysis *utils.LogAnalysis) {
+	if analysis.Fingerprint != "" {
+		fmt.Printf("   🔖 异常: %s (指纹: %s)\n", analysis.Exception, analysis.Fingerprint)
+	}
+}
+
+// 显示决定结果的规则
+func printRule(analysis *utils.LogAnalysis) {
+	if note := utils.RuleNote(analysis); note != "" {
+		fmt.Printf("   📏 %s\n", note)
+	}
+}
+
+// 关闭分析器并保存日志模板
+func closeAnalyzer(analyzer *utils.Analyzer) {
+	if err := analyzer.Close(); err != nil {
+		fmt.Printf("⚠️  保存日志模板失败: %v\n", err)
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(analyzeCmd)
+
+	analyzeCmd.Flags().StringSliceVar(&analyzeFiles, "file", nil, "要分析的日志文件，可重复指定或使用通配符 (支持 .gz/.zst/.bz2)")
+	analyzeCmd.Flags().StringVar(&analyzeSince, "since", "", "只分析该时间之后的日志 (如 2h、15m、\"2025-10-17 14:30\")")
+	analyzeCmd.Flags().StringVar(&analyzeUntil, "until", "", "只分析该时间之前的日志 (格式同 --since)")
 }
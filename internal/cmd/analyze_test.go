@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/input"
+)
+
+const javaTrace = "2024-01-02 03:04:05 ERROR order failed\n" +
+	"java.lang.IllegalStateException: boom\n" +
+	"\tat com.example.OrderService.create(OrderService.java:42)"
+
+// 测试文件和标准输入使用同样的多行事件组装
+func TestScanEvents(t *testing.T) {
+	saved := globalConfig
+	cfg := config.DefaultConfig
+	globalConfig = &cfg
+	defer func() { globalConfig = saved }()
+
+	content := javaTrace + "\n2024-01-02 03:04:06 INFO next\n"
+	for _, follow := range []bool{false, true} {
+		var events []string
+		err := scanEvents(strings.NewReader(content), input.DefaultLineOptions(), &analysisStats{}, follow, func(event string) bool {
+			events = append(events, event)
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 2 || events[0] != javaTrace || events[1] != "2024-01-02 03:04:06 INFO next" {
+			t.Errorf("follow=%v: unexpected events %q", follow, events)
+		}
+	}
+
+	// fn 返回 false 后停止读取，暂存的事件不再输出
+	var events []string
+	err := scanEvents(strings.NewReader(content+"2024-01-02 03:04:07 INFO last\n"), input.DefaultLineOptions(), &analysisStats{}, false, func(event string) bool {
+		events = append(events, event)
+		return false
+	})
+	if err != nil || len(events) != 1 {
+		t.Errorf("expected to stop after first event, got %q (err=%v)", events, err)
+	}
+}
+
+// 测试持续的输入空闲时输出暂存的事件
+func TestScanEventsFollowIdle(t *testing.T) {
+	saved := globalConfig
+	cfg := config.DefaultConfig
+	globalConfig = &cfg
+	defer func() { globalConfig = saved }()
+
+	r, w := io.Pipe()
+	events := make(chan string, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- scanEvents(r, input.DefaultLineOptions(), &analysisStats{}, true, func(event string) bool {
+			events <- event
+			return true
+		})
+	}()
+
+	if _, err := io.WriteString(w, javaTrace+"\n"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-events:
+		if event != javaTrace {
+			t.Errorf("unexpected event %q", event)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("pending event not flushed while input is idle")
+	}
+
+	w.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/xurenlu/aipipe/internal/exception"
+	"github.com/xurenlu/aipipe/internal/input"
+	"github.com/xurenlu/aipipe/internal/record"
+)
+
+var (
+	exceptionFiles []string
+	exceptionLimit int
+)
+
+// exceptionsCmd 代表异常统计命令
+var exceptionsCmd = &cobra.Command{
+	Use:   "exceptions [file...]",
+	Short: "统计日志文件中的异常",
+	Long: `汇总日志文件中出现最多的异常，不调用 AI。
+
+Java、Python、Go 的多行堆栈会先合并为一个事件，再按异常类型、消息模板和前 N 个
+应用堆栈帧计算指纹。同一指纹的异常归为一组，显示出现次数和首次/最后出现时间。
+
+示例:
+  aipipe exceptions --file /var/log/app.log
+  aipipe exceptions --file '/var/log/app/app.log*' --limit 20
+  aipipe exceptions app.log.1.gz app.log`,
+	Run: func(cmd *cobra.Command, args []string) {
+		patterns := append(append([]string{}, exceptionFiles...), args...)
+		if len(patterns) == 0 {
+			fmt.Println("❌ 请指定日志文件: aipipe exceptions --file <path>")
+			return
+		}
+
+		lineOptions := input.NewLineOptions(globalConfig.Input, inputEncoding)
+		if err := lineOptions.Validate(); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+
+		paths, err := input.ExpandPaths(patterns)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+		files, err := input.SortChronologically(paths)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+
+		fingerprinter := exception.NewFingerprinter(globalConfig.Exceptions)
+		aggregator := exception.NewAggregator()
+		stats := &analysisStats{}
+
+		for _, file := range files {
+			if err := collectExceptions(file.Path, lineOptions, fingerprinter, aggregator, stats); err != nil {
+				fmt.Printf("❌ %v\n", err)
+				return
+			}
+		}
+
+		groups := aggregator.Groups()
+		if len(groups) == 0 {
+			fmt.Printf("✅ 在 %d 个事件中没有发现异常\n", stats.lineCount)
+			return
+		}
+
+		var total int64
+		for _, g := range groups {
+			total += g.Count
+		}
+
+		fmt.Printf("🔖 异常统计: %d 个事件中发现 %d 次异常, 共 %d 种\n", stats.lineCount, total, len(groups))
+		fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+		for i, g := range groups {
+			if exceptionLimit > 0 && i >= exceptionLimit {
+				fmt.Printf("... 还有 %d 种异常未显示\n", len(groups)-exceptionLimit)
+				break
+			}
+
+			fmt.Printf("指纹: %s (%d 次)\n", g.Fingerprint, g.Count)
+			if g.Language != "" {
+				fmt.Printf("  类型: %s (%s)\n", g.Class, g.Language)
+			} else {
+				fmt.Printf("  类型: %s\n", g.Class)
+			}
+			if g.Template != "" {
+				fmt.Printf("  消息: %s\n", g.Template)
+			}
+			if len(g.Frames) > 0 {
+				fmt.Printf("  堆栈: %s\n", strings.Join(g.Frames, " ← "))
+			}
+			if !g.FirstSeen.IsZero() {
+				fmt.Printf("  首次: %s | 最后: %s\n",
+					g.FirstSeen.Format("2006-01-02 15:04:05"), g.LastSeen.Format("2006-01-02 15:04:05"))
+			}
+			fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+		}
+
+		printLineStats(stats.input)
+	},
+}
+
+// 从单个日志文件中收集异常
+func collectExceptions(path string, lineOptions input.LineOptions, fingerprinter *exception.Fingerprinter, aggregator *exception.Aggregator, stats *analysisStats) error {
+	reader, err := input.Open(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	err = scanEvents(reader, lineOptions, stats, false, func(event string) bool {
+		stats.lineCount++
+		if exc, ok := fingerprinter.Parse(event); ok {
+			at, _ := record.ExtractTimestamp(event)
+			aggregator.Add(exc, at, event)
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("读取文件失败 %s: %w", path, err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(exceptionsCmd)
+
+	exceptionsCmd.Flags().StringSliceVar(&exceptionFiles, "file", nil, "要统计的日志文件，可重复指定或使用通配符 (支持 .gz/.zst/.bz2)")
+	exceptionsCmd.Flags().IntVar(&exceptionLimit, "limit", 10, "最多显示的异常种类 (0 表示全部)")
+}
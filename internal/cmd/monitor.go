@@ -1,19 +1,45 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"sort"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/input"
 	"github.com/xurenlu/aipipe/internal/monitor"
+	"github.com/xurenlu/aipipe/internal/record"
+	"github.com/xurenlu/aipipe/internal/source"
 	"github.com/xurenlu/aipipe/internal/utils"
 )
 
+// 监控和服务模式共享的日志分析器，入队前用它匹配日志模板和规则
+var logAnalyzer *utils.Analyzer
+
+var (
+	monitorFrom      string
+	monitorRecursive bool
+	monitorExclude   []string
+	monitorSyslog    string
+	monitorCommand   string
+	monitorContainer string
+	monitorSources   string
+	monitorPoll      bool
+	monitorPollEvery time.Duration
+
+	// journalctl 参数
+	journalConfig config.JournalConfig
+)
+
 // monitorCmd 代表监控命令
 var monitorCmd = &cobra.Command{
 	Use:   "monitor",
@@ -24,14 +50,62 @@ var monitorCmd = &cobra.Command{
 1. 自动模式: 从配置文件读取所有监控文件
    aipipe monitor
 
-2. 手动模式: 指定单个文件监控
+2. 手动模式: 指定单个文件、通配符或目录监控
    aipipe monitor --file /var/log/app.log --format nginx
 
+3. 系统日志模式: --format journald 且未指定 --file 时直接读取 journalctl
+   aipipe monitor --format journald --journal-services nginx,docker
+
+4. syslog 接收模式: 接收网络设备和其他主机转发的 syslog (RFC 3164/5424)
+   aipipe monitor --syslog udp://0.0.0.0:5514
+
+5. 命令模式: 分析任意命令的输出 (stdout 和 stderr)，命令退出后按指数退避重启
+   aipipe monitor --command "kubectl logs -f deploy/api" --format java
+
+6. 容器日志模式: 作为节点代理读取所有容器日志，添加命名空间、Pod、容器和镜像信息
+   aipipe monitor --containers docker    # /var/lib/docker/containers/*/*-json.log
+   aipipe monitor --containers cri       # /var/log/pods/<ns>_<pod>_<uid>/<container>/*.log
+
+7. 多源模式: 从多源配置文件 (YAML, TOML 或 JSON) 读取数据源并同时监控
+   aipipe monitor --sources aipipe-sources.yaml
+   未指定 --sources 且 ~/.aipipe-monitor.json 中没有文件时，自动使用
+   ~/.config/aipipe-sources.{yaml,yml,toml,json}
+
+通配符（支持 ** 匹配多级目录）和目录会自动监控之后新创建的匹配文件，
+被删除的文件在宽限期（默认 30 秒）内没有重新创建则停止监控。
+
+NFS、CIFS、部分 FUSE 和容器 overlay 文件系统可能收不到文件事件: 目录无法添加 fsnotify 监控，
+或文件有变化但超过一个轮询间隔仍没有收到事件时，自动改为按 --poll-interval 轮询；
+--poll 可以强制使用轮询 (多源配置中为每个数据源设置 poll: true)。
+
+读取位置会定期保存到检查点文件 (~/.local/state/aipipe/positions.json)，
+重启后默认从上次位置继续，避免重复分析和重复告警。--from 可以指定起始位置:
+  checkpoint - 从检查点继续，没有检查点 (第一次运行) 时从文件开头读取 (默认)
+  beginning  - 从文件开头读取
+  end        - 只读取之后新写入的内容
+
 示例:
   aipipe monitor                                    # 监控所有配置的文件
   aipipe monitor --file /var/log/app.log           # 监控指定文件
-  aipipe monitor --file /var/log/nginx/access.log --format nginx`,
+  aipipe monitor --file /var/log/nginx/access.log --format nginx
+  aipipe monitor --file /var/log/app.log --from beginning
+  aipipe monitor --file '/var/log/app/app-*.log'
+  aipipe monitor --file /var/log/pods --recursive --exclude '*.tmp'
+  aipipe monitor --format journald --journal-priority err --journal-since "1 hour ago"
+  aipipe monitor --syslog tcp://0.0.0.0:6514
+  aipipe monitor --syslog unix:///run/aipipe/syslog.sock
+  aipipe monitor --command "ssh web-1 tail -F /var/log/nginx/error.log" --format nginx`,
 	Run: func(cmd *cobra.Command, args []string) {
+		logAnalyzer = utils.NewAnalyzer(globalConfig)
+		defer closeAnalyzer(logAnalyzer)
+
+		// 在文件监控器停止之后关闭，已读取的日志处理完再退出
+		if err := startPipeline(logAnalyzer); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+		defer stopPipeline()
+
 		// 创建文件监控器
 		fileMonitor, err := monitor.NewFileMonitor()
 		if err != nil {
@@ -40,12 +114,47 @@ var monitorCmd = &cobra.Command{
 		}
 		defer fileMonitor.Stop()
 
+		if err := fileMonitor.SetStartFrom(monitorFrom); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+		if err := fileMonitor.SetPollInterval(monitorPollEvery); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+		fileMonitor.SetForcePoll(monitorPoll)
+
+		// 所有数据源共用一个检查点存储，避免各自保存时互相覆盖
+		var positions *monitor.PositionStore
+		if globalConfig.Checkpoint.Enabled {
+			store, err := monitor.LoadPositionStore(globalConfig.Checkpoint.File)
+			if err != nil {
+				fmt.Printf("⚠️  加载读取位置失败，将忽略已有检查点: %v\n", err)
+			}
+			positions = store
+			fileMonitor.EnableCheckpoints(positions, globalConfig.Checkpoint.FlushInterval)
+		}
+
 		// 如果指定了文件，使用手动模式
-		if filePath != "" {
+		if monitorSources != "" {
+			startSourcesMonitor(monitorSources, positions)
+		} else if monitorContainer != "" {
+			startContainerMonitor(monitorContainer, filePath, logFormat, positions)
+		} else if monitorCommand != "" {
+			startCommandMonitor(monitorCommand, logFormat)
+		} else if monitorSyslog != "" {
+			format := logFormat
+			if !cmd.Flags().Changed("format") {
+				format = "syslog"
+			}
+			startSyslogMonitor(monitorSyslog, format)
+		} else if filePath == "" && logFormat == "journald" {
+			startJournalMonitor(journalConfig)
+		} else if filePath != "" {
 			startManualMonitor(fileMonitor, filePath, logFormat)
 		} else {
 			// 否则使用自动模式，从配置文件读取
-			startAutoMonitor(fileMonitor)
+			startAutoMonitor(fileMonitor, positions)
 		}
 	},
 }
@@ -57,9 +166,10 @@ func startManualMonitor(fileMonitor *monitor.FileMonitor, filePath, format strin
 	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 
 	// 添加文件监控
-	err := fileMonitor.AddFile(filePath, func(filePath, line string) {
+	options := input.NewLineOptions(globalConfig.Input, inputEncoding)
+	err := addMonitorPath(fileMonitor, filePath, monitorRecursive, monitorExclude, monitorPoll, options, func(filePath, line string) {
 		// 处理新日志行
-		processLogLine(line, format)
+		processLogLine(filePath, 0, line, format)
 	})
 
 	if err != nil {
@@ -71,8 +181,196 @@ func startManualMonitor(fileMonitor *monitor.FileMonitor, filePath, format strin
 	waitForInterrupt()
 }
 
+// journalctl 监控模式
+func startJournalMonitor(journal config.JournalConfig) {
+	fmt.Println("🚀 AIPipe 监控模式 - 监控系统日志 (journalctl)")
+	if len(journal.Services) > 0 {
+		fmt.Printf("📋 服务: %s\n", strings.Join(journal.Services, ", "))
+	}
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	// 只有从检查点继续时才使用 journal 游标
+	var cursors *source.CursorStore
+	if globalConfig.Checkpoint.Enabled && monitorFrom == monitor.StartFromCheckpoint {
+		store, err := source.LoadCursorStore("")
+		if err != nil {
+			fmt.Printf("⚠️  加载 journal 游标失败，将忽略已有游标: %v\n", err)
+		}
+		cursors = store
+	}
+
+	journalSource := source.NewJournaldSource(config.SourceConfig{
+		Name:    "journald",
+		Type:    "journald",
+		Format:  "journald",
+		Journal: journal,
+	}, cursors)
+
+	fmt.Println("✅ 系统日志监控已启动，按 Ctrl+C 停止")
+	runSource(journalSource)
+}
+
+// syslog 接收模式
+func startSyslogMonitor(listen, format string) {
+	fmt.Printf("🚀 AIPipe 监控模式 - 接收 syslog: %s\n", listen)
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	syslogSource, err := source.NewSyslogSource(config.SourceConfig{
+		Name:   "syslog",
+		Type:   "syslog",
+		Format: format,
+		Syslog: config.SyslogConfig{Listen: listen},
+	})
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+	addr, err := syslogSource.Listen()
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+
+	fmt.Printf("✅ syslog 接收器已启动 (%s)，按 Ctrl+C 停止\n", addr)
+	runSource(syslogSource)
+}
+
+// 命令监控模式
+func startCommandMonitor(command, format string) {
+	fmt.Printf("🚀 AIPipe 监控模式 - 监控命令输出: %s\n", command)
+	fmt.Printf("📋 日志格式: %s\n", format)
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	commandSource, err := source.NewCommandSource(config.SourceConfig{
+		Name:    "command",
+		Type:    "command",
+		Format:  format,
+		Command: config.CommandConfig{Command: command},
+	}, input.NewLineOptions(globalConfig.Input, inputEncoding))
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+
+	fmt.Println("✅ 命令监控已启动，命令退出后会自动重启，按 Ctrl+C 停止")
+	runSource(commandSource)
+}
+
+// 容器日志监控模式，root 为空时使用运行时的默认目录，positions 为 nil 时不保存读取位置
+func startContainerMonitor(runtime, root, format string, positions *monitor.PositionStore) {
+	containerSource, err := source.NewContainerSource(config.SourceConfig{
+		Name:         runtime,
+		Type:         runtime,
+		Path:         root,
+		Format:       format,
+		Poll:         monitorPoll,
+		PollInterval: monitorPollEvery,
+	}, input.NewLineOptions(globalConfig.Input, inputEncoding), positions)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+	containerSource.SetStartFrom(monitorFrom)
+
+	fmt.Printf("🚀 AIPipe 监控模式 - 监控容器日志 (%s)\n", runtime)
+	fmt.Printf("📋 日志格式: %s\n", format)
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Println("✅ 容器日志监控已启动，新容器的日志会自动监控，按 Ctrl+C 停止")
+	runSource(containerSource)
+}
+
+// 多源监控模式：按多源配置文件并发运行所有启用的数据源
+func startSourcesMonitor(path string, positions *monitor.PositionStore) {
+	sourcesConfig, err := config.LoadMultiSourceConfig(path)
+	if err != nil {
+		fmt.Printf("❌ 加载多源配置失败: %v\n", err)
+		return
+	}
+
+	// 只有从检查点继续时才使用 journal 游标
+	var cursors *source.CursorStore
+	if globalConfig.Checkpoint.Enabled && monitorFrom == monitor.StartFromCheckpoint {
+		store, err := source.LoadCursorStore("")
+		if err != nil {
+			fmt.Printf("⚠️  加载 journal 游标失败，将忽略已有游标: %v\n", err)
+		}
+		cursors = store
+	}
+
+	manager, err := source.NewManager(*sourcesConfig, source.ManagerOptions{
+		Input:     globalConfig.Input,
+		Encoding:  inputEncoding,
+		Positions: positions,
+		Cursors:   cursors,
+		StartFrom: monitorFrom,
+	})
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+
+	statuses := manager.Statuses()
+	fmt.Printf("🚀 AIPipe 多源监控启动 - 监控 %d 个源\n", len(statuses))
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	for _, status := range statuses {
+		if status.Description != "" {
+			fmt.Printf("📡 源: %s (%s) - %s\n", status.Name, status.Type, status.Description)
+		} else {
+			fmt.Printf("📡 源: %s (%s)\n", status.Name, status.Type)
+		}
+	}
+
+	manager.OnStatus = printSourceStatus
+	fmt.Printf("✅ 启用 %d 个监控源，按 Ctrl+C 停止\n", len(statuses))
+	runSource(manager)
+
+	fmt.Println("📊 数据源统计:")
+	for _, status := range manager.Statuses() {
+		fmt.Printf("   %s: %d 条日志, 重启 %d 次\n", status.Name, status.Records, status.Restarts)
+	}
+}
+
+// 输出数据源状态变化
+func printSourceStatus(status source.Status) {
+	switch status.State {
+	case source.StateRunning:
+		if status.Address != "" {
+			fmt.Printf("▶️  %s: 运行中 (%s)\n", status.Name, status.Address)
+		} else if status.Restarts > 0 {
+			fmt.Printf("▶️  %s: 已重启 (第 %d 次)\n", status.Name, status.Restarts)
+		}
+	case source.StateRestarting:
+		fmt.Printf("⚠️  %s: 出错退出，稍后重启: %s\n", status.Name, status.LastError)
+	case source.StateFailed:
+		fmt.Printf("❌ %s: 启动失败: %s\n", status.Name, status.LastError)
+	}
+}
+
+// 运行数据源直到收到中断信号，多个数据源并发运行
+func runSource(sources ...source.Source) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+	for _, src := range sources {
+		wg.Add(1)
+		go func(src source.Source) {
+			defer wg.Done()
+			err := src.Run(ctx, func(rec *record.Record) bool {
+				return processRecord(rec)
+			})
+			if err != nil {
+				fmt.Printf("❌ %s: %v\n", src.Name(), err)
+			}
+		}(src)
+	}
+	wg.Wait()
+
+	fmt.Println("\n🛑 监控已停止")
+}
+
 // 自动监控模式
-func startAutoMonitor(fileMonitor *monitor.FileMonitor) {
+func startAutoMonitor(fileMonitor *monitor.FileMonitor, positions *monitor.PositionStore) {
 	// 加载监控配置
 	monitorConfig, err := loadMonitorConfigFromFile()
 	if err != nil {
@@ -81,6 +379,11 @@ func startAutoMonitor(fileMonitor *monitor.FileMonitor) {
 	}
 
 	if len(monitorConfig.Files) == 0 {
+		if sourcesFile := config.FindSourcesFile(); sourcesFile != "" {
+			fmt.Printf("🔍 自动检测到多源配置文件: %s\n", sourcesFile)
+			startSourcesMonitor(sourcesFile, positions)
+			return
+		}
 		fmt.Println("❌ 没有配置任何监控文件")
 		fmt.Println("💡 使用 'aipipe dashboard add' 添加监控文件")
 		return
@@ -102,22 +405,16 @@ func startAutoMonitor(fileMonitor *monitor.FileMonitor) {
 		}
 
 		// 检查文件是否存在
-		if _, err := os.Stat(file.Path); os.IsNotExist(err) {
+		if _, err := os.Stat(file.Path); os.IsNotExist(err) && !monitor.IsPattern(file.Path) {
 			fmt.Printf("⚠️  文件不存在，跳过: %s\n", file.Path)
 			continue
 		}
 
 		// 添加文件监控
-		err := fileMonitor.AddFile(file.Path, func(filePath, line string) {
-			// 找到对应的格式
-			var format string
-			for _, f := range monitorConfig.Files {
-				if f.Path == filePath {
-					format = f.Format
-					break
-				}
-			}
-			processLogLine(line, format)
+		format, priority := file.Format, file.Priority
+		options := input.NewLineOptions(globalConfig.Input, file.Encoding)
+		err := addMonitorPath(fileMonitor, file.Path, file.Recursive, file.Exclude, file.Poll, options, func(filePath, line string) {
+			processLogLine(filePath, priority, line, format)
 		})
 
 		if err != nil {
@@ -138,6 +435,34 @@ func startAutoMonitor(fileMonitor *monitor.FileMonitor) {
 	waitForInterrupt()
 }
 
+// 添加监控路径：通配符和目录作为动态文件源，普通文件直接监控；poll 为 true 时强制轮询
+func addMonitorPath(fileMonitor *monitor.FileMonitor, path string, recursive bool, exclude []string, poll bool, options input.LineOptions, callback func(string, string)) error {
+	info, err := os.Stat(path)
+	if !monitor.IsPattern(path) && (err != nil || !info.IsDir()) {
+		if err := fileMonitor.AddFileWithOptions(path, options, callback); err != nil {
+			return err
+		}
+		if poll {
+			return fileMonitor.PollFile(path)
+		}
+		return nil
+	}
+
+	count, err := fileMonitor.AddSource(monitor.FileSource{
+		Pattern:   path,
+		Recursive: recursive,
+		Exclude:   exclude,
+		Poll:      poll,
+		Options:   options,
+	}, callback)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("📂 %s: 匹配到 %d 个文件，新创建的匹配文件会自动监控\n", path, count)
+	return nil
+}
+
 // 加载监控配置
 func loadMonitorConfigFromFile() (MonitorConfig, error) {
 	var config MonitorConfig
@@ -164,28 +489,31 @@ func waitForInterrupt() {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	<-c
+	// 恢复默认处理，等待队列处理完成时再次中断可以强制退出
+	signal.Stop(c)
 	fmt.Println("\n🛑 监控已停止")
 }
 
-// 处理日志行
-func processLogLine(line, format string) {
-	// 使用 AI 分析日志
-	analysis, err := utils.AnalyzeLog(line, format, globalConfig)
-	if err != nil {
-		fmt.Printf("❌ 分析失败: %v\n", err)
-		return
-	}
-
-	if analysis.Important {
-		fmt.Printf("⚠️  [重要] %s\n", line)
-		fmt.Printf("   📝 摘要: %s\n", analysis.Summary)
-	} else {
-		if showNotImportant {
-			fmt.Printf("🔇 [过滤] %s\n", line)
-		}
-	}
-}
-
 func init() {
 	rootCmd.AddCommand(monitorCmd)
+
+	monitorCmd.Flags().StringVar(&monitorFrom, "from", monitor.StartFromCheckpoint, "起始读取位置: beginning, end, checkpoint")
+	monitorCmd.Flags().BoolVar(&monitorRecursive, "recursive", false, "监控目录时包含子目录")
+	monitorCmd.Flags().StringSliceVar(&monitorExclude, "exclude", nil, "排除的文件模式，可重复指定 (如 '*.gz')")
+	monitorCmd.Flags().BoolVar(&monitorPoll, "poll", false, "强制轮询文件变化 (NFS、CIFS 等收不到文件事件的文件系统)")
+	monitorCmd.Flags().DurationVar(&monitorPollEvery, "poll-interval", monitor.DefaultPollInterval, "轮询间隔")
+
+	monitorCmd.Flags().StringVar(&monitorSources, "sources", "", "多源配置文件 (YAML, TOML 或 JSON)，同时监控其中所有启用的数据源")
+	monitorCmd.Flags().StringVar(&monitorContainer, "containers", "", "监控节点上的容器日志 (docker, cri)，--file 可指定日志根目录")
+	monitorCmd.Flags().StringVar(&monitorCommand, "command", "", "监控命令输出 (如 \"docker logs -f db\")")
+	monitorCmd.Flags().StringVar(&monitorSyslog, "syslog", "", "接收 syslog 的监听地址 (udp://host:port, tcp://host:port, unix:///path)")
+
+	// journalctl 参数
+	monitorCmd.Flags().StringSliceVar(&journalConfig.Services, "journal-services", nil, "监控的 systemd 服务列表，逗号分隔 (如: nginx,docker)")
+	monitorCmd.Flags().StringVar(&journalConfig.Priority, "journal-priority", "", "日志级别过滤 (emerg,alert,crit,err,warning,notice,info,debug)")
+	monitorCmd.Flags().StringVar(&journalConfig.Since, "journal-since", "", "开始时间 (如: '1 hour ago')，有保存的游标时从游标继续")
+	monitorCmd.Flags().StringVar(&journalConfig.Until, "journal-until", "", "结束时间 (如: 'now')")
+	monitorCmd.Flags().StringVar(&journalConfig.User, "journal-user", "", "用户过滤 (用户名或 UID)")
+	monitorCmd.Flags().BoolVar(&journalConfig.Boot, "journal-boot", false, "只监控当前启动的日志")
+	monitorCmd.Flags().BoolVar(&journalConfig.Kernel, "journal-kernel", false, "只监控内核消息")
 }
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/xurenlu/aipipe/internal/input"
+	"github.com/xurenlu/aipipe/internal/pattern"
+)
+
+var (
+	patternLimit int
+)
+
+// patternsCmd 代表日志模板命令
+var patternsCmd = &cobra.Command{
+	Use:   "patterns",
+	Short: "日志模板管理",
+	Long: `列出从日志中挖掘出的模板（Drain 算法），包括匹配次数、首次/最后出现时间和示例行。
+
+仅变量不同的日志行（如 IP、耗时、ID）会归入同一个模板，模板ID可以作为
+缓存键和规则目标 (aipipe rules add --template <id>)。
+
+子命令:
+  show      - 显示模板详情
+  clear     - 清空所有模板
+
+示例:
+  aipipe patterns                          # 列出已挖掘的模板
+  aipipe patterns --file /var/log/app.log  # 先挖掘指定文件再列出
+  aipipe patterns --limit 50`,
+	Run: func(cmd *cobra.Command, args []string) {
+		miner, err := pattern.LoadTemplateMiner(globalConfig.Patterns)
+		if err != nil {
+			fmt.Printf("❌ 加载日志模板失败: %v\n", err)
+			return
+		}
+
+		if filePath != "" {
+			count, err := mineFile(miner, filePath)
+			if err != nil {
+				fmt.Printf("❌ 挖掘日志模板失败: %v\n", err)
+				return
+			}
+			if err := miner.Save(); err != nil {
+				fmt.Printf("❌ 保存日志模板失败: %v\n", err)
+				return
+			}
+			fmt.Printf("✅ 已处理 %d 行日志: %s\n", count, filePath)
+		}
+
+		templates := miner.GetTemplates()
+		if len(templates) == 0 {
+			fmt.Println("📋 没有任何日志模板")
+			fmt.Println("💡 使用 'aipipe patterns --file <path>' 从文件挖掘模板")
+			return
+		}
+
+		fmt.Printf("📋 日志模板 (共 %d 个):\n", len(templates))
+		fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+		for i, t := range templates {
+			if patternLimit > 0 && i >= patternLimit {
+				fmt.Printf("... 还有 %d 个模板未显示\n", len(templates)-patternLimit)
+				break
+			}
+
+			fmt.Printf("ID: %s (%d 次)\n", t.ID, t.Count)
+			fmt.Printf("  模板: %s\n", t.String())
+			fmt.Printf("  首次: %s | 最后: %s\n",
+				t.FirstSeen.Format("2006-01-02 15:04:05"), t.LastSeen.Format("2006-01-02 15:04:05"))
+			if len(t.Examples) > 0 {
+				fmt.Printf("  示例: %s\n", t.Examples[0])
+			}
+			fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+		}
+	},
+}
+
+// patternsShowCmd 代表显示模板详情命令
+var patternsShowCmd = &cobra.Command{
+	Use:   "show <template_id>",
+	Short: "显示模板详情",
+	Long:  "显示指定日志模板的详细信息和所有示例行",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		miner, err := pattern.LoadTemplateMiner(globalConfig.Patterns)
+		if err != nil {
+			fmt.Printf("❌ 加载日志模板失败: %v\n", err)
+			return
+		}
+
+		t, exists := miner.GetTemplate(args[0])
+		if !exists {
+			fmt.Printf("❌ 未找到模板: %s\n", args[0])
+			return
+		}
+
+		fmt.Printf("ID: %s\n", t.ID)
+		fmt.Printf("模板: %s\n", t.String())
+		fmt.Printf("匹配次数: %d\n", t.Count)
+		fmt.Printf("首次出现: %s\n", t.FirstSeen.Format("2006-01-02 15:04:05"))
+		fmt.Printf("最后出现: %s\n", t.LastSeen.Format("2006-01-02 15:04:05"))
+		fmt.Println("示例:")
+		for _, example := range t.Examples {
+			fmt.Printf("  %s\n", example)
+		}
+	},
+}
+
+// patternsClearCmd 代表清空模板命令
+var patternsClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "清空所有模板",
+	Long:  "清空所有已挖掘的日志模板",
+	Run: func(cmd *cobra.Command, args []string) {
+		miner := pattern.NewTemplateMiner(globalConfig.Patterns)
+		miner.Clear()
+
+		if err := miner.Save(); err != nil {
+			fmt.Printf("❌ 清空日志模板失败: %v\n", err)
+			return
+		}
+
+		fmt.Printf("✅ 日志模板已清空: %s\n", miner.StateFile())
+	},
+}
+
+// 从文件挖掘日志模板
+func mineFile(miner *pattern.TemplateMiner, path string) (int, error) {
+	file, err := input.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := input.NewLineReader(file, input.NewLineOptions(globalConfig.Input, inputEncoding))
+
+	count := 0
+	for {
+		line, err := reader.ReadLine()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, fmt.Errorf("读取文件失败: %w", err)
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		miner.Match(line)
+		count++
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(patternsCmd)
+
+	// 添加模板子命令
+	patternsCmd.AddCommand(patternsShowCmd)
+	patternsCmd.AddCommand(patternsClearCmd)
+
+	patternsCmd.Flags().IntVar(&patternLimit, "limit", 20, "最多显示的模板数量 (0 表示全部)")
+}
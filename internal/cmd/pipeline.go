@@ -0,0 +1,335 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/notification"
+	"github.com/xurenlu/aipipe/internal/pipeline"
+	"github.com/xurenlu/aipipe/internal/record"
+	"github.com/xurenlu/aipipe/internal/rule"
+	"github.com/xurenlu/aipipe/internal/sampling"
+	"github.com/xurenlu/aipipe/internal/utils"
+)
+
+// 监控和服务模式共享的处理流水线：数据源只负责入队，AI 分析在工作协程中并发进行
+var logPipeline *pipeline.Pipeline
+
+// 队列满丢弃日志时的提示间隔
+const dropWarningInterval = 10 * time.Second
+
+// --verbose 时输出队列状态的间隔
+const queueReportInterval = time.Minute
+
+var (
+	overflowPolicy  string
+	stopQueueReport chan struct{}
+	logSampler      *sampling.Sampler
+	stopSampling    chan struct{}
+	samplingDone    chan struct{}
+	logAssembler    *pipeline.EventAssembler
+	stopAssembly    chan struct{}
+	logDeduper      *pipeline.Deduper
+	stopDedupe      chan struct{}
+	logNotifier     *alertNotifier
+	lastDropWarning time.Time
+	dropWarningMu   sync.Mutex
+)
+
+// 创建并启动处理流水线，analyzer 需要支持并发调用
+func startPipeline(analyzer *utils.Analyzer) error {
+	cfg := pipeline.ConfigFrom(globalConfig)
+	p, err := pipeline.New(cfg, func(ctx context.Context, entry pipeline.Entry) (interface{}, error) {
+		return analyzer.AnalyzeEntry(ctx, entry)
+	}, printAnalysis)
+	if err != nil {
+		return fmt.Errorf("创建处理队列失败: %w", err)
+	}
+
+	overflowPolicy = cfg.Overflow
+	logPipeline = p
+	logNotifier = newAlertNotifier()
+	p.Start(context.Background())
+
+	// 日志洪峰时抑制超过速率的相似日志，定期汇总输出被抑制的数量
+	if globalConfig.Sampling.Enabled {
+		logSampler = sampling.NewSampler(globalConfig.Sampling)
+		stopSampling, samplingDone = make(chan struct{}), make(chan struct{})
+		go utils.ReportSuppressed(logSampler, stopSampling, samplingDone)
+	}
+
+	// 连续重复的日志折叠为一条后再采样和分析
+	if globalConfig.Dedupe.Enabled {
+		d, err := pipeline.NewDeduper(globalConfig.Dedupe.Window, globalConfig.Dedupe.Match, func(entry pipeline.Entry) {
+			submitEntry(entry)
+		})
+		if err != nil {
+			p.Close()
+			logPipeline = nil
+			return fmt.Errorf("创建重复日志折叠失败: %w", err)
+		}
+		logDeduper = d
+		stopDedupe = make(chan struct{})
+		go d.FlushEvery(stopDedupe)
+	}
+
+	// 同一数据源的堆栈等续行合并为一个事件后再分析
+	logAssembler = pipeline.NewEventAssembler(globalConfig.Exceptions.MaxLines, pipeline.DefaultAssembleIdle, func(entry pipeline.Entry) {
+		processEvent(entry)
+	})
+	stopAssembly = make(chan struct{})
+	go logAssembler.FlushEvery(stopAssembly)
+
+	if verbose {
+		stopQueueReport = make(chan struct{})
+		go reportQueue(p, stopQueueReport)
+	}
+	return nil
+}
+
+// 定期输出队列状态直到 stop 关闭
+func reportQueue(p *pipeline.Pipeline, stop chan struct{}) {
+	ticker := time.NewTicker(queueReportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			printQueueStats(p.Stats())
+		case <-stop:
+			return
+		}
+	}
+}
+
+// 输出队列统计和各数据源的排队数、等待时间
+func printQueueStats(stats pipeline.Stats) {
+	fmt.Printf("📊 队列统计: 排队 %d 条, 入队 %d 条, 处理 %d 条, 丢弃 %d 条 (策略: %s)\n",
+		stats.Queued, stats.Enqueued, stats.Processed, stats.Dropped, overflowPolicy)
+	for _, source := range stats.Sources {
+		fmt.Printf("   %s (优先级 %d): 排队 %d 条, 已取出 %d 条, 丢弃 %d 条, 平均等待 %s, 最长等待 %s\n",
+			source.Source, source.Priority, source.Queued, source.Dequeued, source.Dropped,
+			source.AvgWait.Round(time.Millisecond), source.MaxWait.Round(time.Millisecond))
+	}
+}
+
+// 停止接收新日志，等待队列中的日志处理完成
+func stopPipeline() {
+	if logPipeline == nil {
+		return
+	}
+	if stopQueueReport != nil {
+		close(stopQueueReport)
+		stopQueueReport = nil
+	}
+	if logAssembler != nil {
+		close(stopAssembly)
+		logAssembler.Close()
+		logAssembler = nil
+	}
+	if logDeduper != nil {
+		close(stopDedupe)
+		logDeduper.Close()
+		logDeduper = nil
+	}
+
+	if queued := logPipeline.Stats().Queued; queued > 0 {
+		fmt.Printf("⏳ 等待队列中的 %d 条日志处理完成 (再次按 Ctrl+C 强制退出)\n", queued)
+	}
+	logPipeline.Close()
+	logNotifier.Wait()
+	logNotifier = nil
+
+	if logSampler != nil {
+		close(stopSampling)
+		<-samplingDone
+	}
+
+	// 有丢弃或有多个数据源时输出队列统计
+	stats := logPipeline.Stats()
+	if stats.Dropped > 0 || len(stats.Sources) > 1 || verbose {
+		printQueueStats(stats)
+	}
+	if logSampler != nil {
+		utils.PrintSamplingStats(logSampler)
+		logSampler = nil
+	}
+	logPipeline = nil
+}
+
+// 提交日志行到处理流水线，priority 越小越先分析；同一数据源的续行先合并为多行事件。
+// 返回 false 表示队列已满、日志被丢弃；暂存、被采样抑制的日志视为已接收
+func processLogLine(source string, priority int, line, format string) bool {
+	entry := pipeline.Entry{Source: source, Priority: priority, Format: format, Line: line}
+	if logAssembler != nil {
+		logAssembler.Add(entry, time.Now())
+		return true
+	}
+	return processEvent(entry)
+}
+
+// 提交数据源的记录，元数据随日志一起分析，多行事件保留第一条记录的元数据；
+// 结构化数据源的记录已是完整的事件，不参与多行合并
+func processRecord(rec *record.Record) bool {
+	if logAssembler != nil && !rec.Complete {
+		logAssembler.AddRecord(rec, time.Now())
+		return true
+	}
+	return processEvent(pipeline.RecordEntry(rec))
+}
+
+// 提交完整的事件：先匹配日志模板和规则，启用折叠时连续重复的日志先暂存计数，空行直接忽略。
+// 暂存的日志视为已接收并返回 true（Fluent Forward 据此回复 ack），折叠窗口结束后才进入队列
+func processEvent(entry pipeline.Entry) bool {
+	if strings.TrimSpace(entry.Line) == "" {
+		return true
+	}
+	logAnalyzer.Prepare(&entry)
+	if logDeduper != nil {
+		logDeduper.Add(entry, time.Now())
+		return true
+	}
+	return submitEntry(entry)
+}
+
+// 提交到处理流水线；启用采样时超过速率的相似日志只计数不分析，alert 规则匹配的日志不参与采样
+func submitEntry(entry pipeline.Entry) bool {
+	if logSampler != nil && !alerting(entry) {
+		templateID := ""
+		if entry.Template != nil {
+			templateID = entry.Template.TemplateID
+		}
+		decision := logSampler.Sample(entry.Source, templateID, entry.Line, time.Now())
+		if !decision.Pass {
+			return true
+		}
+		entry.Suppressed = decision.Suppressed
+	}
+
+	if logPipeline.Submit(entry) {
+		return true
+	}
+	warnDropped()
+	return false
+}
+
+// 日志是否匹配了 alert 规则
+func alerting(entry pipeline.Entry) bool {
+	return entry.Rule != nil && entry.Rule.Action == rule.ActionAlert
+}
+
+// 队列满丢弃日志时提示，每 dropWarningInterval 最多一次
+func warnDropped() {
+
+	dropWarningMu.Lock()
+	defer dropWarningMu.Unlock()
+	if time.Since(lastDropWarning) < dropWarningInterval {
+		return
+	}
+	lastDropWarning = time.Now()
+
+	stats := logPipeline.Stats()
+	fmt.Printf("⚠️  分析队列已满 (排队 %d 条, 策略: %s)，已丢弃 %d 条日志\n", stats.Queued, overflowPolicy, stats.Dropped)
+}
+
+// 输出分析结果
+func printAnalysis(result pipeline.Result) {
+	if result.Err != nil {
+		fmt.Printf("❌ 分析失败: %v\n", result.Err)
+		return
+	}
+
+	analysis := result.Value.(*utils.LogAnalysis)
+	if analysis.Important && analysis.Repeat {
+		// 相同指纹的异常在重复告警窗口内只告警一次
+		if showNotImportant {
+			fmt.Printf("🔁 [重复] %s (指纹: %s, 第 %d 次)\n", analysis.Exception, analysis.Fingerprint, analysis.Occurrences)
+		}
+	} else if analysis.Important {
+		fmt.Printf("⚠️  [重要] %s\n", utils.HighlightLine(result.Entry.Line, analysis.Highlight))
+		fmt.Printf("   📝 摘要: %s\n", analysis.Summary)
+		printFingerprint(analysis)
+		printRule(analysis)
+		printLabels(result.Entry)
+		printRepeats(result.Entry)
+		printSuppressedCount(result.Entry)
+		logNotifier.Notify(result.Entry, analysis)
+	} else {
+		if showNotImportant {
+			fmt.Printf("🔇 [过滤] %s\n", utils.HighlightLine(result.Entry.Line, analysis.Highlight))
+			printRule(analysis)
+			printRepeats(result.Entry)
+			printSuppressedCount(result.Entry)
+		}
+	}
+}
+
+// 输出数据源提供的元数据（如 OTLP 的 service.name、trace_id），方便关联到链路和实例
+func printLabels(entry pipeline.Entry) {
+	if len(entry.Labels) > 0 {
+		fmt.Printf("   🏷️  %s\n", utils.LabelsNote(entry.Labels))
+	}
+}
+
+// 输出折叠的重复次数和时间范围
+func printRepeats(entry pipeline.Entry) {
+	if entry.Repeats > 1 {
+		fmt.Printf("   🔁 %s\n", utils.RepeatsNote(entry))
+	}
+}
+
+// 输出这条日志之前被抑制的相似日志数
+func printSuppressedCount(entry pipeline.Entry) {
+	if entry.Suppressed > 0 {
+		fmt.Printf("   🔇 %s\n", utils.SuppressedNote(entry.Suppressed))
+	}
+}
+
+// 重要日志通知：异步发送，不阻塞结果输出，退出前等待发送完成
+type alertNotifier struct {
+	manager   *notification.NotificationManager
+	pending   sync.WaitGroup
+	lastError time.Time
+	mutex     sync.Mutex
+}
+
+func newAlertNotifier() *alertNotifier {
+	return &alertNotifier{manager: notification.NewNotificationManager(globalConfig)}
+}
+
+// 发送重要日志通知，n 为 nil 时不发送
+func (n *alertNotifier) Notify(entry pipeline.Entry, analysis *utils.LogAnalysis) {
+	if n == nil {
+		return
+	}
+
+	message := utils.AlertNotification(entry, analysis)
+	n.pending.Add(1)
+	go func() {
+		defer n.pending.Done()
+		if err := n.manager.Send(message); err != nil {
+			n.warn(err)
+		}
+	}()
+}
+
+// 发送失败时提示，每 dropWarningInterval 最多一次
+func (n *alertNotifier) warn(err error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if time.Since(n.lastError) < dropWarningInterval {
+		return
+	}
+	n.lastError = time.Now()
+	fmt.Printf("⚠️  %v\n", err)
+}
+
+// 等待发送中的通知完成
+func (n *alertNotifier) Wait() {
+	if n != nil {
+		n.pending.Wait()
+	}
+}
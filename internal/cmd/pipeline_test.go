@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/record"
+	"github.com/xurenlu/aipipe/internal/utils"
+)
+
+// 启用折叠时，记录进入折叠暂存就视为已接收（Fluent Forward 据此确认），关闭时才进入队列
+func TestProcessRecordAcceptedBeforeDedupe(t *testing.T) {
+	cfg := config.DefaultConfig
+	cfg.Dedupe.Enabled = true
+	cfg.Dedupe.Window = time.Minute
+	cfg.Patterns.StateFile = filepath.Join(t.TempDir(), "patterns.json")
+	cfg.Rules = []config.FilterRule{{ID: "all", Pattern: ".", Action: "filter", Enabled: true}}
+
+	saved := globalConfig
+	globalConfig = &cfg
+	defer func() { globalConfig = saved }()
+
+	logAnalyzer = utils.NewAnalyzer(&cfg)
+	defer closeAnalyzer(logAnalyzer)
+	if err := startPipeline(logAnalyzer); err != nil {
+		t.Fatal(err)
+	}
+	p := logPipeline
+
+	if !processRecord(&record.Record{Source: "fluent", Message: "disk full", Complete: true}) {
+		t.Fatal("暂存的记录应视为已接收")
+	}
+	if n := p.Stats().Enqueued; n != 0 {
+		t.Fatalf("折叠窗口内不应入队，已入队 %d 条", n)
+	}
+
+	stopPipeline()
+	if n := p.Stats().Enqueued; n != 1 {
+		t.Errorf("关闭时暂存的记录应进入队列，已入队 %d 条", n)
+	}
+}
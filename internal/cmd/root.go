@@ -17,6 +17,7 @@ var (
 	showNotImportant bool
 	logFormat        string
 	filePath         string
+	inputEncoding    string
 )
 
 // rootCmd 代表基础命令
@@ -64,4 +65,5 @@ func init() {
 	rootCmd.PersistentFlags().BoolVar(&showNotImportant, "show-not-important", false, "显示被过滤的日志")
 	rootCmd.PersistentFlags().StringVarP(&logFormat, "format", "f", "java", "日志格式")
 	rootCmd.PersistentFlags().StringVar(&filePath, "file", "", "要监控的日志文件路径")
+	rootCmd.PersistentFlags().StringVar(&inputEncoding, "encoding", "", "输入编码 (auto, utf-8, gbk, gb18030, latin1)，默认使用配置文件")
 }
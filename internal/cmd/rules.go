@@ -2,9 +2,11 @@ package cmd
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/spf13/cobra"
 	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/pattern"
 	"github.com/xurenlu/aipipe/internal/rule"
 )
 
@@ -17,6 +19,11 @@ var (
 	ruleColor       string
 	ruleEnabled     bool
 	ruleID          string
+	ruleTemplate    string
+	ruleCondition   string
+
+	// rules edit 指定的字段，只有命令行中出现的选项才会更新
+	ruleEdit config.FilterRule
 )
 
 // rulesCmd 代表规则命令
@@ -27,12 +34,37 @@ var rulesCmd = &cobra.Command{
 
 子命令:
   add       - 添加新规则
+  edit      - 修改规则
+  show      - 显示规则详情
   list      - 列出所有规则
   remove    - 删除规则
   enable    - 启用规则
   disable   - 禁用规则
   test      - 测试规则
-  stats     - 显示规则统计`,
+  stats     - 显示规则统计
+
+修改会校验规则后保存到 ~/.config/aipipe.json 的 rules 字段，其他配置项保持不变。`,
+}
+
+// 保存规则到配置文件并更新当前配置
+func saveRules(ruleEngine *rule.RuleEngine) bool {
+	rules := ruleEngine.GetRules()
+	if err := config.SaveRules(rules); err != nil {
+		fmt.Printf("❌ 保存规则失败: %v\n", err)
+		return false
+	}
+	globalConfig.Rules = rules
+	return true
+}
+
+// 生成未被占用的规则ID
+func nextRuleID(ruleEngine *rule.RuleEngine) string {
+	for i := len(ruleEngine.GetRules()) + 1; ; i++ {
+		id := fmt.Sprintf("rule_%d", i)
+		if _, exists := ruleEngine.GetRule(id); !exists {
+			return id
+		}
+	}
 }
 
 // rulesAddCmd 代表添加规则命令
@@ -41,8 +73,8 @@ var rulesAddCmd = &cobra.Command{
 	Short: "添加新规则",
 	Long:  "添加新的过滤规则",
 	Run: func(cmd *cobra.Command, args []string) {
-		if rulePattern == "" {
-			fmt.Println("❌ 请指定规则模式 (--pattern)")
+		if rulePattern == "" && ruleTemplate == "" && ruleCondition == "" {
+			fmt.Println("❌ 请指定规则模式 (--pattern)、日志模板ID (--template) 或条件 (--condition)")
 			return
 		}
 
@@ -51,7 +83,7 @@ var rulesAddCmd = &cobra.Command{
 
 		// 生成规则ID
 		if ruleID == "" {
-			ruleID = fmt.Sprintf("rule_%d", len(globalConfig.Rules)+1)
+			ruleID = nextRuleID(ruleEngine)
 		}
 
 		// 创建新规则
@@ -65,6 +97,13 @@ var rulesAddCmd = &cobra.Command{
 			Enabled:     ruleEnabled,
 			Category:    ruleCategory,
 			Color:       ruleColor,
+			Template:    ruleTemplate,
+			Condition:   ruleCondition,
+		}
+
+		if err := rule.ValidateRule(newRule); err != nil {
+			fmt.Printf("❌ 添加规则失败: %v\n", err)
+			return
 		}
 
 		// 添加规则
@@ -73,14 +112,142 @@ var rulesAddCmd = &cobra.Command{
 			fmt.Printf("❌ 添加规则失败: %v\n", err)
 			return
 		}
+		if !saveRules(ruleEngine) {
+			return
+		}
 
 		fmt.Printf("✅ 规则添加成功: %s\n", ruleID)
-		fmt.Printf("   模式: %s\n", rulePattern)
+		if rulePattern != "" {
+			fmt.Printf("   模式: %s\n", rulePattern)
+		}
+		if ruleTemplate != "" {
+			fmt.Printf("   模板: %s\n", ruleTemplate)
+		}
+		if ruleCondition != "" {
+			fmt.Printf("   条件: %s\n", ruleCondition)
+		}
 		fmt.Printf("   动作: %s\n", ruleAction)
 		fmt.Printf("   优先级: %d\n", rulePriority)
 	},
 }
 
+// rulesEditCmd 代表修改规则命令
+var rulesEditCmd = &cobra.Command{
+	Use:   "edit <rule_id>",
+	Short: "修改规则",
+	Long: `修改已有规则，只更新指定的选项，例如:
+  aipipe rules edit rule_1 --pattern "ERROR.*timeout" --priority 10
+  aipipe rules edit rule_1 --action highlight --color red`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ruleEngine := rule.NewRuleEngine(globalConfig.Rules)
+		r, exists := ruleEngine.GetRule(args[0])
+		if !exists {
+			fmt.Printf("❌ 未找到规则: %s\n", args[0])
+			return
+		}
+
+		flags := cmd.Flags()
+		if flags.Changed("name") {
+			r.Name = ruleEdit.Name
+		}
+		if flags.Changed("pattern") {
+			r.Pattern = ruleEdit.Pattern
+		}
+		if flags.Changed("template") {
+			r.Template = ruleEdit.Template
+		}
+		if flags.Changed("condition") {
+			r.Condition = ruleEdit.Condition
+		}
+		if flags.Changed("action") {
+			r.Action = ruleEdit.Action
+		}
+		if flags.Changed("priority") {
+			r.Priority = ruleEdit.Priority
+		}
+		if flags.Changed("description") {
+			r.Description = ruleEdit.Description
+		}
+		if flags.Changed("category") {
+			r.Category = ruleEdit.Category
+		}
+		if flags.Changed("color") {
+			r.Color = ruleEdit.Color
+		}
+		if flags.Changed("enabled") {
+			r.Enabled = ruleEdit.Enabled
+		}
+
+		if err := rule.ValidateRule(r); err != nil {
+			fmt.Printf("❌ 修改规则失败: %v\n", err)
+			return
+		}
+		if err := ruleEngine.UpdateRule(r); err != nil {
+			fmt.Printf("❌ 修改规则失败: %v\n", err)
+			return
+		}
+		if !saveRules(ruleEngine) {
+			return
+		}
+
+		fmt.Printf("✅ 规则修改成功: %s\n", r.ID)
+		printRuleDetails(r)
+	},
+}
+
+// rulesShowCmd 代表显示规则详情命令
+var rulesShowCmd = &cobra.Command{
+	Use:   "show <rule_id>",
+	Short: "显示规则详情",
+	Long:  "显示规则的全部字段和校验结果",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ruleEngine := rule.NewRuleEngine(globalConfig.Rules)
+		r, exists := ruleEngine.GetRule(args[0])
+		if !exists {
+			fmt.Printf("❌ 未找到规则: %s\n", args[0])
+			return
+		}
+
+		fmt.Printf("📋 规则 %s\n", r.ID)
+		fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+		printRuleDetails(r)
+		if err := rule.ValidateRule(r); err != nil {
+			fmt.Printf("  校验: ❌ %v\n", err)
+		} else {
+			fmt.Println("  校验: ✅ 有效")
+		}
+	},
+}
+
+// 显示规则的全部字段
+func printRuleDetails(r config.FilterRule) {
+	status := "❌ 禁用"
+	if r.Enabled {
+		status = "✅ 启用"
+	}
+
+	fmt.Printf("  名称: %s\n", r.Name)
+	fmt.Printf("  模式: %s\n", r.Pattern)
+	if r.Template != "" {
+		fmt.Printf("  模板: %s\n", r.Template)
+	}
+	if r.Condition != "" {
+		fmt.Printf("  条件: %s\n", r.Condition)
+	}
+	fmt.Printf("  动作: %s\n", r.Action)
+	fmt.Printf("  优先级: %d\n", r.Priority)
+	fmt.Printf("  状态: %s\n", status)
+	fmt.Printf("  分类: %s\n", r.Category)
+	if r.Color != "" {
+		fmt.Printf("  颜色: %s\n", r.Color)
+	}
+	if r.Description != "" {
+		fmt.Printf("  描述: %s\n", r.Description)
+	}
+}
+
 // rulesListCmd 代表列出规则命令
 var rulesListCmd = &cobra.Command{
 	Use:   "list",
@@ -107,6 +274,12 @@ var rulesListCmd = &cobra.Command{
 			fmt.Printf("ID: %s\n", rule.ID)
 			fmt.Printf("  名称: %s\n", rule.Name)
 			fmt.Printf("  模式: %s\n", rule.Pattern)
+			if rule.Template != "" {
+				fmt.Printf("  模板: %s\n", rule.Template)
+			}
+			if rule.Condition != "" {
+				fmt.Printf("  条件: %s\n", rule.Condition)
+			}
 			fmt.Printf("  动作: %s\n", rule.Action)
 			fmt.Printf("  优先级: %d\n", rule.Priority)
 			fmt.Printf("  状态: %s\n", status)
@@ -134,6 +307,9 @@ var rulesRemoveCmd = &cobra.Command{
 			fmt.Printf("❌ 删除规则失败: %v\n", err)
 			return
 		}
+		if !saveRules(ruleEngine) {
+			return
+		}
 
 		fmt.Printf("✅ 规则删除成功: %s\n", ruleID)
 	},
@@ -154,6 +330,9 @@ var rulesEnableCmd = &cobra.Command{
 			fmt.Printf("❌ 启用规则失败: %v\n", err)
 			return
 		}
+		if !saveRules(ruleEngine) {
+			return
+		}
 
 		fmt.Printf("✅ 规则启用成功: %s\n", ruleID)
 	},
@@ -174,6 +353,9 @@ var rulesDisableCmd = &cobra.Command{
 			fmt.Printf("❌ 禁用规则失败: %v\n", err)
 			return
 		}
+		if !saveRules(ruleEngine) {
+			return
+		}
 
 		fmt.Printf("✅ 规则禁用成功: %s\n", ruleID)
 	},
@@ -183,27 +365,94 @@ var rulesDisableCmd = &cobra.Command{
 var rulesTestCmd = &cobra.Command{
 	Use:   "test <rule_id> <test_line>",
 	Short: "测试规则",
-	Long:  "使用测试日志行测试规则匹配",
-	Args:  cobra.ExactArgs(2),
+	Long: `使用测试日志行测试规则匹配，显示解析出的字段、模式匹配结果和条件的每一步求值，例如:
+  aipipe rules test slow_api 'level=ERROR service=payments latency_ms=2300 msg="timeout"'`,
+	Args: cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		ruleID := args[0]
 		testLine := args[1]
 		ruleEngine := rule.NewRuleEngine(globalConfig.Rules)
 
-		matched, err := ruleEngine.TestRule(ruleID, testLine)
+		// 按模板匹配的规则需要日志行的模板ID
+		templateID := ""
+		if r, exists := ruleEngine.GetRule(ruleID); exists && r.Template != "" && globalConfig.Patterns.Enabled {
+			if miner, err := pattern.LoadTemplateMiner(globalConfig.Patterns); err == nil {
+				templateID = miner.Match(testLine).TemplateID
+			}
+		}
+
+		explanation, err := ruleEngine.ExplainRule(ruleID, testLine, templateID)
 		if err != nil {
 			fmt.Printf("❌ 测试规则失败: %v\n", err)
 			return
 		}
+		printExplanation(explanation)
 
-		if matched {
-			fmt.Printf("✅ 规则匹配成功: %s\n", ruleID)
+		if explanation.Matched {
+			fmt.Printf("✅ 规则匹配成功: %s (动作: %s)\n", ruleID, explanation.Rule.Action)
 		} else {
 			fmt.Printf("❌ 规则不匹配: %s\n", ruleID)
 		}
 	},
 }
 
+// 显示规则的求值过程
+func printExplanation(explanation *rule.Explanation) {
+	r := explanation.Rule
+
+	names := make([]string, 0, len(explanation.Fields))
+	for name := range explanation.Fields {
+		if name != "line" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	fmt.Println("📋 解析出的字段:")
+	if len(names) == 0 {
+		fmt.Println("   (无)")
+	}
+	for _, name := range names {
+		fmt.Printf("   %s = %#v\n", name, explanation.Fields[name])
+	}
+
+	if r.Pattern != "" || r.Template != "" {
+		status := "❌ 不匹配"
+		if explanation.PatternMatched {
+			status = "✅ 匹配"
+		}
+		if r.Pattern != "" {
+			fmt.Printf("🔍 模式: %s\n", r.Pattern)
+		}
+		if r.Template != "" {
+			fmt.Printf("🔍 模板: %s (日志行模板: %s)\n", r.Template, explanation.TemplateID)
+		}
+		fmt.Printf("   结果: %s\n", status)
+	}
+
+	if r.Condition != "" {
+		fmt.Printf("🧮 条件: %s\n", r.Condition)
+		for _, step := range explanation.Steps {
+			result := "❌ false"
+			if step.Result {
+				result = "✅ true"
+			}
+			if step.Values != "" {
+				fmt.Printf("   %s → %s (%s)\n", step.Expr, result, step.Values)
+			} else {
+				fmt.Printf("   %s → %s\n", step.Expr, result)
+			}
+		}
+		if !explanation.PatternMatched {
+			fmt.Println("   (模式不匹配，分析时不会求值条件)")
+		}
+		if explanation.ConditionMatched {
+			fmt.Println("   结果: ✅ 成立")
+		} else {
+			fmt.Println("   结果: ❌ 不成立")
+		}
+	}
+}
+
 // rulesStatsCmd 代表规则统计命令
 var rulesStatsCmd = &cobra.Command{
 	Use:   "stats",
@@ -234,6 +483,8 @@ func init() {
 
 	// 添加规则子命令
 	rulesCmd.AddCommand(rulesAddCmd)
+	rulesCmd.AddCommand(rulesEditCmd)
+	rulesCmd.AddCommand(rulesShowCmd)
 	rulesCmd.AddCommand(rulesListCmd)
 	rulesCmd.AddCommand(rulesRemoveCmd)
 	rulesCmd.AddCommand(rulesEnableCmd)
@@ -250,4 +501,18 @@ func init() {
 	rulesAddCmd.Flags().StringVar(&ruleColor, "color", "", "高亮颜色")
 	rulesAddCmd.Flags().BoolVar(&ruleEnabled, "enabled", true, "是否启用规则")
 	rulesAddCmd.Flags().StringVar(&ruleID, "id", "", "规则ID (可选)")
+	rulesAddCmd.Flags().StringVar(&ruleTemplate, "template", "", "日志模板ID (可选，见 aipipe patterns)")
+	rulesAddCmd.Flags().StringVar(&ruleCondition, "condition", "", "字段条件表达式 (可选)，如 'status >= 500 && path =~ \"^/api/\"'")
+
+	// 修改规则标志，只更新指定的选项
+	rulesEditCmd.Flags().StringVar(&ruleEdit.Name, "name", "", "规则名称")
+	rulesEditCmd.Flags().StringVar(&ruleEdit.Pattern, "pattern", "", "规则模式 (正则表达式)")
+	rulesEditCmd.Flags().StringVar(&ruleEdit.Action, "action", "", "规则动作 (filter, alert, ignore, highlight)")
+	rulesEditCmd.Flags().IntVar(&ruleEdit.Priority, "priority", 0, "规则优先级 (数字越小优先级越高)")
+	rulesEditCmd.Flags().StringVar(&ruleEdit.Description, "description", "", "规则描述")
+	rulesEditCmd.Flags().StringVar(&ruleEdit.Category, "category", "", "规则分类")
+	rulesEditCmd.Flags().StringVar(&ruleEdit.Color, "color", "", "高亮颜色 (red, green, yellow, blue, magenta, cyan)")
+	rulesEditCmd.Flags().BoolVar(&ruleEdit.Enabled, "enabled", true, "是否启用规则")
+	rulesEditCmd.Flags().StringVar(&ruleEdit.Template, "template", "", "日志模板ID")
+	rulesEditCmd.Flags().StringVar(&ruleEdit.Condition, "condition", "", "字段条件表达式")
 }
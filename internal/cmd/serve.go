@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/source"
+	"github.com/xurenlu/aipipe/internal/utils"
+)
+
+var (
+	serveIngest      bool
+	serveListen      string
+	serveToken       string
+	serveMaxBodySize int64
+	serveOTLP        bool
+	serveOTLPListen  string
+	serveForward     bool
+	serveForwardAddr string
+	serveTagFormats  []string
+)
+
+// serveCmd 代表服务命令
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "启动 HTTP 服务",
+	Long: `启动 HTTP 服务，接收应用和日志采集器推送的日志并实时分析。
+
+--ingest 开启以下接收端点:
+  POST /ingest             按行分隔的文本或 JSON (NDJSON)、JSON 记录数组
+  POST /loki/api/v1/push   Loki push API (JSON 格式，支持 gzip)
+  GET  /healthz            健康检查
+
+--otlp 在 --otlp-listen（默认 :4318）开启 OTLP/HTTP 日志接收器:
+  POST /v1/logs            OTLP 日志 (application/x-protobuf 或 application/json)
+LogRecord 的严重级别、内容、属性、资源属性 (service.name、k8s.* 等) 和
+trace/span ID 都会保存到日志记录中。
+
+--forward 在 --forward-listen（默认 :24224）开启 Fluent Forward 接收器，可以作为
+Fluent Bit / Fluentd 的 forward 输出目标，支持 Message、Forward、PackedForward 模式和 ack。
+--tag-format 按 tag 指定日志格式（* 匹配一段，** 匹配多段），按顺序匹配。
+
+请求可以通过 ?source=名称&format=格式 参数，或 X-Aipipe-Source、X-Aipipe-Format 头
+指定日志来源和格式。设置 --token（或环境变量 AIPIPE_INGEST_TOKEN）后，
+请求需要携带 Authorization: Bearer <token> 头。
+
+示例:
+  aipipe serve --ingest --listen :9880
+  aipipe serve --ingest --token secret --max-body-size 1048576
+  aipipe serve --otlp --otlp-listen :4318
+  aipipe serve --forward --tag-format 'kube.**=java' --tag-format 'nginx.*=nginx'
+  curl -X POST --data-binary @app.log 'http://localhost:9880/ingest?source=api&format=java'`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !serveIngest && !serveOTLP && !serveForward {
+			fmt.Println("❌ 没有启用任何服务，使用 --ingest 开启日志接收端点，--otlp 开启 OTLP 接收器，--forward 开启 Fluent Forward 接收器")
+			return
+		}
+
+		token := serveToken
+		if token == "" {
+			token = os.Getenv("AIPIPE_INGEST_TOKEN")
+		}
+		httpConfig := config.HTTPConfig{
+			Token:       token,
+			MaxBodySize: serveMaxBodySize,
+		}
+
+		var sources []source.Source
+		var addrs []string
+		if serveIngest {
+			httpConfig.Listen = serveListen
+			httpSource, err := source.NewHTTPSource(config.SourceConfig{Name: "http", Type: "http", Format: logFormat, HTTP: httpConfig})
+			if err != nil {
+				fmt.Printf("❌ %v\n", err)
+				return
+			}
+			addr, err := httpSource.Listen()
+			if err != nil {
+				fmt.Printf("❌ %v\n", err)
+				return
+			}
+			sources = append(sources, httpSource)
+			addrs = append(addrs, fmt.Sprintf("日志接收端点 http://%s", addr))
+		}
+		if serveOTLP {
+			httpConfig.Listen = serveOTLPListen
+			otlpSource, err := source.NewOTLPSource(config.SourceConfig{Name: "otlp", Type: "otlp", Format: logFormat, HTTP: httpConfig})
+			if err != nil {
+				fmt.Printf("❌ %v\n", err)
+				return
+			}
+			addr, err := otlpSource.Listen()
+			if err != nil {
+				fmt.Printf("❌ %v\n", err)
+				return
+			}
+			sources = append(sources, otlpSource)
+			addrs = append(addrs, fmt.Sprintf("OTLP 接收器 http://%s%s", addr, source.OTLPLogsPath))
+		}
+
+		if serveForward {
+			tagFormats, err := parseTagFormats(serveTagFormats)
+			if err != nil {
+				fmt.Printf("❌ %v\n", err)
+				return
+			}
+			forwardSource, err := source.NewForwardSource(config.SourceConfig{
+				Name:    "forward",
+				Type:    "forward",
+				Format:  logFormat,
+				Forward: config.ForwardConfig{Listen: serveForwardAddr, TagFormats: tagFormats},
+			})
+			if err != nil {
+				fmt.Printf("❌ %v\n", err)
+				return
+			}
+			addr, err := forwardSource.Listen()
+			if err != nil {
+				fmt.Printf("❌ %v\n", err)
+				return
+			}
+			sources = append(sources, forwardSource)
+			addrs = append(addrs, fmt.Sprintf("Fluent Forward 接收器 %s", addr))
+		}
+
+		logAnalyzer = utils.NewAnalyzer(globalConfig)
+		defer closeAnalyzer(logAnalyzer)
+		if err := startPipeline(logAnalyzer); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+		defer stopPipeline()
+
+		fmt.Println("🚀 AIPipe 服务模式")
+		for _, addr := range addrs {
+			fmt.Printf("📡 %s\n", addr)
+		}
+		fmt.Printf("📋 默认日志格式: %s\n", logFormat)
+		if token == "" {
+			fmt.Println("⚠️  未设置 --token，接收端点不校验身份")
+		}
+		fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+		fmt.Println("✅ 服务已启动，按 Ctrl+C 停止")
+		runSource(sources...)
+	},
+}
+
+// 解析 --tag-format 参数 (tag=format)
+func parseTagFormats(values []string) ([]config.TagFormat, error) {
+	var tagFormats []config.TagFormat
+	for _, value := range values {
+		tag, format, ok := strings.Cut(value, "=")
+		if !ok || tag == "" || format == "" {
+			return nil, fmt.Errorf("无效的 tag 格式映射: %s (应为 tag=format)", value)
+		}
+		tagFormats = append(tagFormats, config.TagFormat{Tag: tag, Format: format})
+	}
+	return tagFormats, nil
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().BoolVar(&serveIngest, "ingest", false, "开启日志接收端点")
+	serveCmd.Flags().StringVar(&serveListen, "listen", ":9880", "监听地址")
+	serveCmd.Flags().StringVar(&serveToken, "token", "", "Bearer Token (默认读取 AIPIPE_INGEST_TOKEN)")
+	serveCmd.Flags().BoolVar(&serveOTLP, "otlp", false, "开启 OTLP/HTTP 日志接收器")
+	serveCmd.Flags().StringVar(&serveOTLPListen, "otlp-listen", source.DefaultOTLPListen, "OTLP 接收器监听地址")
+	serveCmd.Flags().BoolVar(&serveForward, "forward", false, "开启 Fluent Forward 接收器")
+	serveCmd.Flags().StringVar(&serveForwardAddr, "forward-listen", source.DefaultForwardListen, "Fluent Forward 接收器监听地址")
+	serveCmd.Flags().StringArrayVar(&serveTagFormats, "tag-format", nil, "tag 到日志格式的映射 (如 'kube.**=java')，可重复指定")
+	serveCmd.Flags().Int64Var(&serveMaxBodySize, "max-body-size", source.DefaultMaxBodySize, "单个请求最大字节数")
+}
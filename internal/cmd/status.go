@@ -224,10 +224,14 @@ type MonitorConfig struct {
 }
 
 type MonitorFile struct {
-	Path     string `json:"path"`
-	Format   string `json:"format"`
-	Enabled  bool   `json:"enabled"`
-	Priority int    `json:"priority"`
+	Path      string   `json:"path"` // 文件路径、通配符或目录
+	Format    string   `json:"format"`
+	Enabled   bool     `json:"enabled"`
+	Priority  int      `json:"priority"`
+	Encoding  string   `json:"encoding,omitempty"`  // 文件编码，如 gbk（默认使用配置文件）
+	Recursive bool     `json:"recursive,omitempty"` // 目录是否包含子目录
+	Exclude   []string `json:"exclude,omitempty"`   // 排除的文件模式，如 *.gz
+	Poll      bool     `json:"poll,omitempty"`      // 强制轮询（网络文件系统等收不到文件事件时）
 }
 
 // 全局监控配置
@@ -332,8 +336,8 @@ func addMonitorFileInteractive() {
 		return
 	}
 
-	// 检查文件是否存在
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	// 检查文件是否存在（通配符可以匹配之后创建的文件）
+	if _, err := os.Stat(filePath); os.IsNotExist(err) && !monitor.IsPattern(filePath) {
 		fmt.Printf("❌ 文件不存在: %s\n", filePath)
 		return
 	}
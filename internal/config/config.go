@@ -50,15 +50,17 @@ type AIService struct {
 
 // 过滤规则
 type FilterRule struct {
-	ID          string `json:"id"`          // 规则ID
-	Name        string `json:"name"`        // 规则名称
-	Pattern     string `json:"pattern"`     // 正则表达式模式
-	Action      string `json:"action"`      // 动作: filter, alert, ignore, highlight
-	Priority    int    `json:"priority"`    // 优先级（数字越小优先级越高）
-	Description string `json:"description"` // 规则描述
-	Enabled     bool   `json:"enabled"`     // 是否启用
-	Category    string `json:"category"`    // 规则分类
-	Color       string `json:"color"`       // 高亮颜色
+	ID          string `json:"id"`                  // 规则ID
+	Name        string `json:"name"`                // 规则名称
+	Pattern     string `json:"pattern"`             // 正则表达式模式
+	Action      string `json:"action"`              // 动作: filter, alert, ignore, highlight
+	Priority    int    `json:"priority"`            // 优先级（数字越小优先级越高）
+	Description string `json:"description"`         // 规则描述
+	Enabled     bool   `json:"enabled"`             // 是否启用
+	Category    string `json:"category"`            // 规则分类
+	Color       string `json:"color"`               // 高亮颜色
+	Template    string `json:"template,omitempty"`  // 日志模板ID（可选，与模式任一匹配即可）
+	Condition   string `json:"condition,omitempty"` // 字段条件表达式（可选，与模式/模板同时满足），如 status >= 500 && path =~ "^/api/"
 }
 
 // 缓存配置
@@ -86,30 +88,86 @@ type WorkerPoolConfig struct {
 
 // 内存配置
 type MemoryConfig struct {
-	MaxMemoryUsage    int64         `json:"max_memory_usage"`    // 最大内存使用量（字节）
-	GCThreshold       int64         `json:"gc_threshold"`        // 垃圾回收阈值
-	LeakDetection     bool          `json:"leak_detection"`      // 是否启用内存泄漏检测
-	ProfilingInterval time.Duration `json:"profiling_interval"`  // 性能分析间隔
-	Enabled           bool          `json:"enabled"`             // 是否启用内存优化
+	MaxMemoryUsage    int64         `json:"max_memory_usage"`   // 最大内存使用量（字节）
+	GCThreshold       int64         `json:"gc_threshold"`       // 垃圾回收阈值
+	LeakDetection     bool          `json:"leak_detection"`     // 是否启用内存泄漏检测
+	ProfilingInterval time.Duration `json:"profiling_interval"` // 性能分析间隔
+	Enabled           bool          `json:"enabled"`            // 是否启用内存优化
 }
 
 // 并发控制配置
 type ConcurrencyConfig struct {
-	MaxConcurrency    int           `json:"max_concurrency"`    // 最大并发数
-	BackpressureLimit int           `json:"backpressure_limit"` // 背压限制
-	QueueTimeout      time.Duration `json:"queue_timeout"`      // 队列超时时间
-	RetryDelay        time.Duration `json:"retry_delay"`        // 重试延迟
-	Enabled           bool          `json:"enabled"`            // 是否启用并发控制
+	MaxConcurrency    int           `json:"max_concurrency"`           // 最大并发数（分析协程数的上限）
+	BackpressureLimit int           `json:"backpressure_limit"`        // 背压限制（数据源和分析之间队列的容量）
+	QueueTimeout      time.Duration `json:"queue_timeout"`             // 队列超时时间（block 策略下等待队列空位的最长时间，0 表示一直等待）
+	RetryDelay        time.Duration `json:"retry_delay"`               // 重试延迟
+	Enabled           bool          `json:"enabled"`                   // 是否启用并发控制
+	OverflowPolicy    string        `json:"overflow_policy,omitempty"` // 队列满时的策略: block, drop_oldest, drop_newest, spill
+	SpillDir          string        `json:"spill_dir,omitempty"`       // spill 策略的溢写目录（默认 ~/.local/state/aipipe/spill）
+	SpillMaxBytes     int64         `json:"spill_max_bytes,omitempty"` // 溢写文件的最大字节数，超过后丢弃新日志（默认 1GB）
 }
 
 // I/O配置
 type IOConfig struct {
-	BufferSize        int           `json:"buffer_size"`        // 缓冲区大小
-	BatchSize         int           `json:"batch_size"`         // 批处理大小
-	FlushInterval     time.Duration `json:"flush_interval"`     // 刷新间隔
-	AsyncIO           bool          `json:"async_io"`           // 是否启用异步I/O
-	Compression       bool          `json:"compression"`        // 是否启用压缩
-	Enabled           bool          `json:"enabled"`            // 是否启用I/O优化
+	BufferSize    int           `json:"buffer_size"`    // 缓冲区大小
+	BatchSize     int           `json:"batch_size"`     // 批处理大小
+	FlushInterval time.Duration `json:"flush_interval"` // 刷新间隔
+	AsyncIO       bool          `json:"async_io"`       // 是否启用异步I/O
+	Compression   bool          `json:"compression"`    // 是否启用压缩
+	Enabled       bool          `json:"enabled"`        // 是否启用I/O优化
+}
+
+// 输入处理配置
+type InputConfig struct {
+	Encoding       string `json:"encoding"`         // 默认编码: auto, utf-8, gbk, gb18030, latin1
+	MaxLineSize    int    `json:"max_line_size"`    // 单行最大字节数
+	LongLinePolicy string `json:"long_line_policy"` // 超长行处理: truncate, split, skip
+	SkipBinary     bool   `json:"skip_binary"`      // 是否跳过二进制行
+}
+
+// 日志模板挖掘配置
+type PatternConfig struct {
+	Enabled             bool    `json:"enabled"`              // 是否启用模板挖掘
+	Depth               int     `json:"depth"`                // 前缀树深度
+	SimilarityThreshold float64 `json:"similarity_threshold"` // 相似度阈值
+	MaxChildren         int     `json:"max_children"`         // 每个节点最大子节点数
+	MaxExamples         int     `json:"max_examples"`         // 每个模板保留的示例行数
+	StateFile           string  `json:"state_file"`           // 模板持久化文件路径
+}
+
+// 异常指纹配置
+type ExceptionConfig struct {
+	MaxFrames   int      `json:"max_frames"`   // 参与指纹计算的应用堆栈帧数
+	AppPackages []string `json:"app_packages"` // 应用代码的包名/路径前缀（为空时排除常见框架和标准库）
+	MaxLines    int      `json:"max_lines"`    // 单个多行事件的最大行数
+
+	// 重复告警窗口：相同指纹的异常在窗口内只告警一次，超过窗口后再次出现时重新告警（alert 规则匹配的异常总是告警）
+	RepeatWindow time.Duration `json:"repeat_window"`
+}
+
+// 读取位置检查点配置
+type CheckpointConfig struct {
+	Enabled       bool          `json:"enabled"`        // 是否持久化读取位置
+	File          string        `json:"file"`           // 检查点文件路径（默认 ~/.local/state/aipipe/positions.json）
+	FlushInterval time.Duration `json:"flush_interval"` // 定期保存间隔
+}
+
+// 日志洪峰采样配置：超过速率的相似日志不再分析，只记录被抑制的数量
+type SamplingConfig struct {
+	Enabled        bool          `json:"enabled"`         // 是否启用采样（默认关闭）
+	SourceRate     float64       `json:"source_rate"`     // 每个数据源每秒放行的日志数
+	SourceBurst    int           `json:"source_burst"`    // 每个数据源允许的突发日志数
+	TemplateRate   float64       `json:"template_rate"`   // 同一数据源中同一模板每秒放行的日志数
+	TemplateBurst  int           `json:"template_burst"`  // 同一模板允许的突发日志数
+	ReportInterval time.Duration `json:"report_interval"` // 汇总输出被抑制日志数量的间隔
+	MaxTemplates   int           `json:"max_templates"`   // 最多跟踪的模板数
+}
+
+// 重复日志折叠配置：同一数据源中连续重复的日志折叠为一条，附带重复次数和时间范围
+type DedupeConfig struct {
+	Enabled bool          `json:"enabled"` // 是否启用折叠（默认关闭，启用后每条日志最多延迟一个窗口输出）
+	Window  time.Duration `json:"window"`  // 折叠窗口，从第一条开始计算，超过后输出并重新开始折叠
+	Match   string        `json:"match"`   // 重复的判断方式: exact (完全相同), template (同一模板)
 }
 
 // 多源配置
@@ -120,14 +178,82 @@ type MultiSourceConfig struct {
 
 // 数据源配置
 type SourceConfig struct {
-	Name     string `json:"name"`     // 数据源名称
-	Type     string `json:"type"`     // 数据源类型 (file, journald, syslog)
-	Path     string `json:"path"`     // 文件路径或配置
-	Format   string `json:"format"`   // 日志格式
-	Enabled  bool   `json:"enabled"`  // 是否启用
-	Priority int    `json:"priority"` // 优先级
+	Name         string          `json:"name"`                    // 数据源名称
+	Type         string          `json:"type"`                    // 数据源类型 (file, journald, syslog, command, http, otlp, forward, docker, cri)
+	Path         string          `json:"path"`                    // 文件路径、通配符（支持 **）、目录或配置
+	Format       string          `json:"format"`                  // 日志格式
+	Enabled      bool            `json:"enabled"`                 // 是否启用
+	Priority     int             `json:"priority"`                // 优先级
+	Encoding     string          `json:"encoding,omitempty"`      // 文件编码（默认使用 input.encoding）
+	Recursive    bool            `json:"recursive,omitempty"`     // 目录源是否包含子目录
+	Exclude      []string        `json:"exclude,omitempty"`       // 排除的文件模式
+	GracePeriod  time.Duration   `json:"grace_period,omitempty"`  // 文件删除后停止监控前的等待时间
+	Poll         bool            `json:"poll,omitempty"`          // 强制轮询文件变化（NFS、CIFS 等不支持 fsnotify 的文件系统）
+	PollInterval time.Duration   `json:"poll_interval,omitempty"` // 轮询间隔（默认 1 秒）
+	Description  string          `json:"description,omitempty"`   // 数据源描述
+	Journal      JournalConfig   `json:"journal,omitempty"`       // journalctl 数据源配置
+	Syslog       SyslogConfig    `json:"syslog,omitempty"`        // syslog 接收器配置
+	Command      CommandConfig   `json:"command,omitempty"`       // 命令数据源配置
+	HTTP         HTTPConfig      `json:"http,omitempty"`          // HTTP 接收端点配置
+	Forward      ForwardConfig   `json:"forward,omitempty"`       // Fluent Forward 接收器配置
+	Container    ContainerConfig `json:"container,omitempty"`     // 容器日志 (docker, cri) 配置
+}
+
+// journalctl 数据源配置
+type JournalConfig struct {
+	Services []string `json:"services"`            // systemd 单元列表
+	Priority string   `json:"priority"`            // 最低优先级 (emerg, alert, crit, err, warning, notice, info, debug)
+	Since    string   `json:"since"`               // 开始时间（没有游标时使用）
+	Until    string   `json:"until"`               // 结束时间
+	User     string   `json:"user"`                // 用户名或 UID
+	Boot     bool     `json:"boot"`                // 只读取本次启动的日志
+	Kernel   bool     `json:"kernel"`              // 只读取内核消息
+	Command  string   `json:"command,omitempty"`   // journalctl 可执行文件路径（默认 journalctl）
+	NoCursor bool     `json:"no_cursor,omitempty"` // 不保存/恢复 journal 游标
+}
+
+// syslog 接收器配置
+type SyslogConfig struct {
+	Listen         string `json:"listen"`                     // 监听地址，如 udp://0.0.0.0:514、tcp://:6514、unix:///run/aipipe.sock
+	MaxMessageSize int    `json:"max_message_size,omitempty"` // 单条消息最大字节数（默认 64KB）
+}
+
+// 命令数据源配置
+type CommandConfig struct {
+	Command         string        `json:"command"`                     // 命令行，未指定 args 时通过 shell 执行
+	Args            []string      `json:"args,omitempty"`              // 命令参数，指定时直接执行 command
+	Dir             string        `json:"dir,omitempty"`               // 工作目录
+	Env             []string      `json:"env,omitempty"`               // 额外的环境变量 (KEY=VALUE)
+	RestartDelay    time.Duration `json:"restart_delay,omitempty"`     // 命令退出后首次重启的等待时间（默认 1 秒）
+	MaxRestartDelay time.Duration `json:"max_restart_delay,omitempty"` // 重启等待时间上限（默认 1 分钟）
+}
+
+// HTTP 接收端点配置
+type HTTPConfig struct {
+	Listen      string `json:"listen"`                  // 监听地址，如 :9880
+	Token       string `json:"token,omitempty"`         // Bearer Token，为空时不校验
+	MaxBodySize int64  `json:"max_body_size,omitempty"` // 单个请求最大字节数（默认 10MB）
+}
+
+// Fluent Forward 接收器配置
+type ForwardConfig struct {
+	Listen         string      `json:"listen"`                     // 监听地址（默认 :24224），支持 tcp://、unix://
+	TagFormats     []TagFormat `json:"tag_formats,omitempty"`      // tag 到日志格式的映射，按顺序匹配
+	MaxMessageSize int         `json:"max_message_size,omitempty"` // 单个消息最大字节数（默认 16MB）
+	MaxEntries     int         `json:"max_entries,omitempty"`      // 单个消息最大条目数（默认 100000）
 }
 
+// 容器日志配置，path 为日志根目录（docker 默认 /var/lib/docker/containers，cri 默认 /var/log/pods）
+type ContainerConfig struct {
+	LinksDir string `json:"links_dir,omitempty"` // CRI 日志软链接目录，用于查找容器ID（默认 /var/log/containers）
+	StateDir string `json:"state_dir,omitempty"` // containerd 容器状态目录，用于读取镜像名称
+}
+
+// tag 到日志格式的映射，tag 支持 * (匹配一段) 和 ** (匹配零或多段)
+type TagFormat struct {
+	Tag    string `json:"tag"`
+	Format string `json:"format"`
+}
 
 // 输出格式配置
 type OutputFormat struct {
@@ -153,7 +279,7 @@ type Config struct {
 	Token        string         `json:"token"`       // 向后兼容
 	Model        string         `json:"model"`       // 向后兼容
 	CustomPrompt string         `json:"custom_prompt"`
-	PromptFile   string         `json:"prompt_file"`   // 提示词文件路径
+	PromptFile   string         `json:"prompt_file"` // 提示词文件路径
 	Notifiers    NotifierConfig `json:"notifiers"`
 
 	// 新增配置项
@@ -190,6 +316,24 @@ type Config struct {
 
 	// 多源支持
 	MultiSource MultiSourceConfig `json:"multi_source"`
+
+	// 日志模板挖掘
+	Patterns PatternConfig `json:"patterns"`
+
+	// 输入处理（编码、超长行）
+	Input InputConfig `json:"input"`
+
+	// 异常指纹
+	Exceptions ExceptionConfig `json:"exceptions"`
+
+	// 读取位置检查点
+	Checkpoint CheckpointConfig `json:"checkpoint"`
+
+	// 日志洪峰采样
+	Sampling SamplingConfig `json:"sampling"`
+
+	// 连续重复日志折叠
+	Dedupe DedupeConfig `json:"dedupe"`
 }
 
 // 默认配置变量
@@ -242,6 +386,7 @@ func init() {
 			QueueTimeout:      5 * time.Second,
 			RetryDelay:        1 * time.Second,
 			Enabled:           true,
+			OverflowPolicy:    "block",
 		},
 		IO: IOConfig{
 			BufferSize:    64 * 1024, // 64KB
@@ -255,6 +400,45 @@ func init() {
 			Enabled: false,
 			Sources: []SourceConfig{},
 		},
+		Input: InputConfig{
+			Encoding:       "auto",
+			MaxLineSize:    1024 * 1024, // 1MB
+			LongLinePolicy: "truncate",
+			SkipBinary:     true,
+		},
+		Patterns: PatternConfig{
+			Enabled:             true,
+			Depth:               4,
+			SimilarityThreshold: 0.4,
+			MaxChildren:         100,
+			MaxExamples:         3,
+			StateFile:           "",
+		},
+		Exceptions: ExceptionConfig{
+			MaxFrames:    3,
+			AppPackages:  []string{},
+			MaxLines:     500,
+			RepeatWindow: 10 * time.Minute,
+		},
+		Checkpoint: CheckpointConfig{
+			Enabled:       true,
+			File:          "",
+			FlushInterval: 5 * time.Second,
+		},
+		Sampling: SamplingConfig{
+			Enabled:        false,
+			SourceRate:     50,
+			SourceBurst:    200,
+			TemplateRate:   1,
+			TemplateBurst:  10,
+			ReportInterval: time.Minute,
+			MaxTemplates:   10000,
+		},
+		Dedupe: DedupeConfig{
+			Enabled: false,
+			Window:  2 * time.Second,
+			Match:   "exact",
+		},
 		OutputFormat: OutputFormat{
 			Type:     "table",
 			Template: "",
@@ -305,9 +489,14 @@ func init() {
 	}
 }
 
+// 配置文件路径
+func ConfigPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".config", "aipipe.json")
+}
+
 // 加载配置文件
 func LoadConfig() (*Config, error) {
-	configPath := filepath.Join(os.Getenv("HOME"), ".config", "aipipe.json")
+	configPath := ConfigPath()
 
 	// 检查配置文件是否存在
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
@@ -330,9 +519,41 @@ func LoadConfig() (*Config, error) {
 	// 合并默认配置
 	mergedConfig := mergeConfig(DefaultConfig, config)
 
+	// 采样和折叠配置可以关闭 (enabled: false)，配置文件中出现时整体使用用户配置，未填写的项使用默认值
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err == nil {
+		if _, exists := fields["sampling"]; exists {
+			mergedConfig.Sampling = config.Sampling
+		}
+		if _, exists := fields["dedupe"]; exists {
+			mergedConfig.Dedupe = config.Dedupe
+		}
+
+		// 默认开启的布尔项，只有填写了才使用用户配置，否则无法关闭
+		if hasField(fields, "patterns", "enabled") {
+			mergedConfig.Patterns.Enabled = config.Patterns.Enabled
+		}
+		if hasField(fields, "checkpoint", "enabled") {
+			mergedConfig.Checkpoint.Enabled = config.Checkpoint.Enabled
+		}
+		if hasField(fields, "input", "skip_binary") {
+			mergedConfig.Input.SkipBinary = config.Input.SkipBinary
+		}
+	}
+
 	return &mergedConfig, nil
 }
 
+// 配置文件中是否填写了 section.key
+func hasField(fields map[string]json.RawMessage, section, key string) bool {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(fields[section], &object); err != nil {
+		return false
+	}
+	_, exists := object[key]
+	return exists
+}
+
 // 合并配置
 func mergeConfig(defaultConfig, userConfig Config) Config {
 	merged := defaultConfig
@@ -374,6 +595,84 @@ func mergeConfig(defaultConfig, userConfig Config) Config {
 		merged.LogLevel.MinLevel = userConfig.LogLevel.Level
 	}
 
+	// 合并过滤规则
+	if len(userConfig.Rules) > 0 {
+		merged.Rules = userConfig.Rules
+	}
+
+	// 合并输入处理配置
+	if userConfig.Input.Encoding != "" {
+		merged.Input.Encoding = userConfig.Input.Encoding
+	}
+	if userConfig.Input.MaxLineSize > 0 {
+		merged.Input.MaxLineSize = userConfig.Input.MaxLineSize
+	}
+	if userConfig.Input.LongLinePolicy != "" {
+		merged.Input.LongLinePolicy = userConfig.Input.LongLinePolicy
+	}
+
+	// 合并模板挖掘配置
+	if userConfig.Patterns.Depth > 0 {
+		merged.Patterns.Depth = userConfig.Patterns.Depth
+	}
+	if userConfig.Patterns.SimilarityThreshold > 0 {
+		merged.Patterns.SimilarityThreshold = userConfig.Patterns.SimilarityThreshold
+	}
+	if userConfig.Patterns.MaxChildren > 0 {
+		merged.Patterns.MaxChildren = userConfig.Patterns.MaxChildren
+	}
+	if userConfig.Patterns.MaxExamples > 0 {
+		merged.Patterns.MaxExamples = userConfig.Patterns.MaxExamples
+	}
+	if userConfig.Patterns.StateFile != "" {
+		merged.Patterns.StateFile = userConfig.Patterns.StateFile
+	}
+
+	// 合并异常指纹配置
+	if userConfig.Exceptions.MaxFrames > 0 {
+		merged.Exceptions.MaxFrames = userConfig.Exceptions.MaxFrames
+	}
+	if len(userConfig.Exceptions.AppPackages) > 0 {
+		merged.Exceptions.AppPackages = userConfig.Exceptions.AppPackages
+	}
+	if userConfig.Exceptions.MaxLines > 0 {
+		merged.Exceptions.MaxLines = userConfig.Exceptions.MaxLines
+	}
+	if userConfig.Exceptions.RepeatWindow > 0 {
+		merged.Exceptions.RepeatWindow = userConfig.Exceptions.RepeatWindow
+	}
+
+	// 合并检查点配置
+	if userConfig.Checkpoint.File != "" {
+		merged.Checkpoint.File = userConfig.Checkpoint.File
+	}
+	if userConfig.Checkpoint.FlushInterval > 0 {
+		merged.Checkpoint.FlushInterval = userConfig.Checkpoint.FlushInterval
+	}
+
+	// 合并工作池和并发控制配置
+	if userConfig.WorkerPool.MaxWorkers > 0 {
+		merged.WorkerPool.MaxWorkers = userConfig.WorkerPool.MaxWorkers
+	}
+	if userConfig.Concurrency.MaxConcurrency > 0 {
+		merged.Concurrency.MaxConcurrency = userConfig.Concurrency.MaxConcurrency
+	}
+	if userConfig.Concurrency.BackpressureLimit > 0 {
+		merged.Concurrency.BackpressureLimit = userConfig.Concurrency.BackpressureLimit
+	}
+	if userConfig.Concurrency.QueueTimeout > 0 {
+		merged.Concurrency.QueueTimeout = userConfig.Concurrency.QueueTimeout
+	}
+	if userConfig.Concurrency.OverflowPolicy != "" {
+		merged.Concurrency.OverflowPolicy = userConfig.Concurrency.OverflowPolicy
+	}
+	if userConfig.Concurrency.SpillDir != "" {
+		merged.Concurrency.SpillDir = userConfig.Concurrency.SpillDir
+	}
+	if userConfig.Concurrency.SpillMaxBytes > 0 {
+		merged.Concurrency.SpillMaxBytes = userConfig.Concurrency.SpillMaxBytes
+	}
+
 	// 合并通知器配置
 	if userConfig.Notifiers.Email.Enabled {
 		merged.Notifiers.Email = userConfig.Notifiers.Email
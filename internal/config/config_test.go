@@ -0,0 +1,175 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLoadConfigRulesAndOptionalSections(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	path := filepath.Join(home, ".config", "aipipe.json")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := `{
+  "rules": [{"id": "noise", "pattern": "healthz", "action": "ignore", "enabled": true}],
+  "sampling": {"enabled": true, "source_rate": 10}
+}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if DefaultConfig.Sampling.Enabled {
+		t.Error("采样默认应关闭")
+	}
+	if len(cfg.Rules) != 1 || cfg.Rules[0].ID != "noise" {
+		t.Errorf("规则未加载: %+v", cfg.Rules)
+	}
+	if !cfg.Sampling.Enabled || cfg.Sampling.SourceRate != 10 {
+		t.Errorf("配置文件中启用的采样应生效: %+v", cfg.Sampling)
+	}
+	if cfg.Dedupe.Enabled || cfg.Dedupe.Window != DefaultConfig.Dedupe.Window {
+		t.Errorf("未配置的折叠应使用默认值（关闭）: %+v", cfg.Dedupe)
+	}
+}
+
+func TestLoadConfigDisableDefaultFlags(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	path := filepath.Join(home, ".config", "aipipe.json")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := `{
+  "patterns": {"enabled": false, "depth": 5},
+  "checkpoint": {"enabled": false},
+  "input": {"skip_binary": false}
+}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Patterns.Enabled || cfg.Checkpoint.Enabled || cfg.Input.SkipBinary {
+		t.Errorf("配置文件中关闭的选项应保持关闭: patterns=%v checkpoint=%v skip_binary=%v",
+			cfg.Patterns.Enabled, cfg.Checkpoint.Enabled, cfg.Input.SkipBinary)
+	}
+	if cfg.Patterns.Depth != 5 || cfg.Checkpoint.FlushInterval != DefaultConfig.Checkpoint.FlushInterval {
+		t.Errorf("其他选项应正常合并: depth=%d flush=%s", cfg.Patterns.Depth, cfg.Checkpoint.FlushInterval)
+	}
+
+	// 未填写时使用默认值
+	if err := os.WriteFile(path, []byte(`{"patterns": {"depth": 5}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Patterns.Enabled || !cfg.Checkpoint.Enabled || !cfg.Input.SkipBinary {
+		t.Error("未填写的选项应使用默认值")
+	}
+}
+
+func TestSaveRulesPreservesOtherFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aipipe.json")
+	original := `{
+  "token": "secret",
+  "ai_endpoint": "http://localhost/v1",
+  "rules": [],
+  "notifiers": {
+    "slack": {"enabled": true, "url": "https://hooks.example.com/x"}
+  }
+}
+`
+	if err := os.WriteFile(path, []byte(original), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	rules := []FilterRule{{ID: "noise", Pattern: "healthz", Action: "ignore", Enabled: true}}
+	if err := saveRulesTo(path, rules); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved Config
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("保存的配置不是合法 JSON: %v\n%s", err, data)
+	}
+	if len(saved.Rules) != 1 || saved.Rules[0].ID != "noise" || saved.Token != "secret" || !saved.Notifiers.Slack.Enabled {
+		t.Errorf("保存结果 = %s", data)
+	}
+	// 其他字段保持原有顺序和写法
+	text := string(data)
+	if !strings.Contains(text, `"slack": {"enabled": true, "url": "https://hooks.example.com/x"}`) ||
+		strings.Index(text, `"token"`) > strings.Index(text, `"ai_endpoint"`) {
+		t.Errorf("其他配置项被改写:\n%s", text)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("文件权限 = %v, 期望保持 0600", info.Mode().Perm())
+	}
+
+	// 配置文件不存在时只写入规则
+	missing := filepath.Join(t.TempDir(), "sub", "aipipe.json")
+	if err := saveRulesTo(missing, rules); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(missing); !strings.Contains(string(data), `"noise"`) {
+		t.Errorf("新配置文件 = %s", data)
+	}
+}
+
+func TestSaveRulesConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "aipipe.json")
+	if err := os.WriteFile(path, []byte(`{"token": "secret"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// 同时保存时每次都写入完整的配置，不会因共用临时文件而失败或写坏
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rules := []FilterRule{{ID: fmt.Sprintf("rule_%d", i), Pattern: "x", Action: "ignore", Enabled: true}}
+			errs <- saveRulesTo(path, rules)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved Config
+	if err := json.Unmarshal(data, &saved); err != nil || len(saved.Rules) != 1 || saved.Token != "secret" {
+		t.Errorf("保存结果 = %s, %v", data, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("目录中残留临时文件: %v", entries)
+	}
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// 保存过滤规则到配置文件：只替换 rules 字段，其他配置项保持原有顺序和内容，先写临时文件再重命名
+func SaveRules(rules []FilterRule) error {
+	return saveRulesTo(ConfigPath(), rules)
+}
+
+func saveRulesTo(path string, rules []FilterRule) error {
+	if rules == nil {
+		rules = []FilterRule{}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	updated, err := replaceTopLevelField(data, "rules", rules)
+	if err != nil {
+		return fmt.Errorf("更新配置文件失败: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("创建配置目录失败: %w", err)
+	}
+	return writeFileAtomic(path, updated, mode)
+}
+
+// 原子写入文件：在同一目录创建唯一的临时文件，写入并同步到磁盘后重命名，
+// 多个进程同时写入时不会互相覆盖临时文件，中途崩溃也不会留下不完整的配置
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	tmpFile := tmp.Name()
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(mode)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("写入配置文件失败: %w", err)
+	}
+
+	if err := os.Rename(tmpFile, path); err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("保存配置文件失败: %w", err)
+	}
+	return nil
+}
+
+// JSON 对象的一个字段，值保留原始内容
+type rawField struct {
+	key   string
+	value json.RawMessage
+}
+
+// 替换 JSON 对象中的一个顶层字段（不存在时追加到末尾），其他字段按原顺序原样保留
+func replaceTopLevelField(data []byte, key string, value interface{}) ([]byte, error) {
+	var fields []rawField
+	if len(bytes.TrimSpace(data)) > 0 {
+		var err error
+		if fields, err = parseObjectFields(data); err != nil {
+			return nil, err
+		}
+	}
+
+	encoded, err := json.MarshalIndent(value, "  ", "  ")
+	if err != nil {
+		return nil, err
+	}
+	replaced := false
+	for i := range fields {
+		if fields[i].key == key {
+			fields[i].value = encoded
+			replaced = true
+		}
+	}
+	if !replaced {
+		fields = append(fields, rawField{key: key, value: encoded})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("{\n")
+	for i, field := range fields {
+		name, _ := json.Marshal(field.key)
+		fmt.Fprintf(&buf, "  %s: %s", name, field.value)
+		if i < len(fields)-1 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
+
+// 按顺序解析 JSON 对象的顶层字段
+func parseObjectFields(data []byte) ([]rawField, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil, fmt.Errorf("配置文件不是 JSON 对象")
+	}
+
+	var fields []rawField
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+		fields = append(fields, rawField{key: token.(string), value: value})
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("配置文件在 JSON 对象之后还有多余内容")
+	}
+	return fields, nil
+}
@@ -0,0 +1,247 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// 支持的数据源类型
+var SourceTypes = []string{
+	"file", "journalctl", "journald", "syslog", "command",
+	"http", "otlp", "forward", "docker", "cri", "kubernetes",
+}
+
+// 多源配置文件的默认文件名（位于 ~/.config），按顺序查找
+var defaultSourcesFiles = []string{
+	"aipipe-sources.json", "aipipe-sources.yaml", "aipipe-sources.yml", "aipipe-sources.toml",
+	"aipipe-multi.json", "aipipe-multi.yaml", "aipipe-multi.yml", "aipipe-multi.toml",
+}
+
+// 以字符串书写时按 time.ParseDuration 解析的字段，如 "30s"、"5m"
+var durationKeys = map[string]bool{
+	"grace_period":      true,
+	"poll_interval":     true,
+	"restart_delay":     true,
+	"max_restart_delay": true,
+}
+
+// 查找默认的多源配置文件，不存在时返回空字符串
+func FindSourcesFile() string {
+	dir := filepath.Join(os.Getenv("HOME"), ".config")
+	for _, name := range defaultSourcesFiles {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// 根据扩展名判断配置文件格式 (yaml, toml, json)，未知扩展名时根据内容判断
+func DetectConfigFormat(path string, data []byte) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	case ".json":
+		return "json"
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		return "json"
+	}
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		return "toml"
+	}
+	return "yaml"
+}
+
+// 加载多源配置文件 (YAML, TOML 或 JSON) 并校验
+func LoadMultiSourceConfig(path string) (*MultiSourceConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取多源配置文件失败: %w", err)
+	}
+
+	cfg, err := ParseMultiSourceConfig(data, DetectConfigFormat(path, data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// 解析多源配置：YAML 和 TOML 先解码为通用结构再按 JSON 字段名映射，三种格式共用同一套字段
+func ParseMultiSourceConfig(data []byte, format string) (*MultiSourceConfig, error) {
+	var raw interface{}
+	switch format {
+	case "yaml":
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("解析 YAML 失败: %w", err)
+		}
+	case "toml":
+		var table map[string]interface{}
+		if _, err := toml.Decode(string(data), &table); err != nil {
+			return nil, fmt.Errorf("解析 TOML 失败: %w", err)
+		}
+		raw = table
+	case "json":
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("解析 JSON 失败: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("不支持的配置格式: %s", format)
+	}
+
+	normalized, err := normalizeSourceValue("", raw)
+	if err != nil {
+		return nil, err
+	}
+	expandCommandShorthand(normalized)
+	encoded, err := json.Marshal(normalized)
+	if err != nil {
+		return nil, fmt.Errorf("转换配置失败: %w", err)
+	}
+
+	var cfg MultiSourceConfig
+	if err := json.Unmarshal(encoded, &cfg); err != nil {
+		return nil, fmt.Errorf("解析数据源配置失败: %w", err)
+	}
+	// 配置文件中定义了数据源即视为启用多源
+	if len(cfg.Sources) > 0 {
+		cfg.Enabled = true
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// 规范化通用结构：时长字段支持 "30s" 写法
+func normalizeSourceValue(key string, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			normalized, err := normalizeSourceValue(k, item)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = normalized
+		}
+		return v, nil
+	case []interface{}:
+		for i, item := range v {
+			normalized, err := normalizeSourceValue("", item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = normalized
+		}
+		return v, nil
+	case string:
+		if durationKeys[key] {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s 不是有效的时长: %s", key, v)
+			}
+			return int64(d), nil
+		}
+	}
+	return value, nil
+}
+
+// 数据源的 command 可以直接写命令行字符串，等同于 command: {command: "..."}
+func expandCommandShorthand(raw interface{}) {
+	root, ok := raw.(map[string]interface{})
+	if !ok {
+		return
+	}
+	sources, _ := root["sources"].([]interface{})
+	for _, item := range sources {
+		if src, ok := item.(map[string]interface{}); ok {
+			if command, ok := src["command"].(string); ok {
+				src["command"] = map[string]interface{}{"command": command}
+			}
+		}
+	}
+}
+
+// 校验多源配置：名称唯一、类型受支持、各类型的必填项已配置
+func (c *MultiSourceConfig) Validate() error {
+	if len(c.Sources) == 0 {
+		return fmt.Errorf("没有配置任何数据源")
+	}
+
+	var errs []string
+	names := make(map[string]bool)
+	for i, src := range c.Sources {
+		label := fmt.Sprintf("sources[%d]", i)
+		if src.Name == "" {
+			errs = append(errs, label+": name 不能为空")
+		} else {
+			label = fmt.Sprintf("sources[%d] (%s)", i, src.Name)
+			if names[src.Name] {
+				errs = append(errs, label+": 名称重复")
+			}
+			names[src.Name] = true
+		}
+		if err := src.Validate(); err != nil {
+			errs = append(errs, label+": "+err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("数据源配置无效:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// 校验单个数据源的类型和必填项
+func (s SourceConfig) Validate() error {
+	switch s.Type {
+	case "file":
+		if s.Path == "" {
+			return fmt.Errorf("file 类型需要配置 path")
+		}
+	case "command":
+		if s.Command.Command == "" && s.Path == "" {
+			return fmt.Errorf("command 类型需要配置 command")
+		}
+	case "syslog":
+		if s.Syslog.Listen == "" && s.Path == "" {
+			return fmt.Errorf("syslog 类型需要配置 syslog.listen")
+		}
+	case "http":
+		if s.HTTP.Listen == "" && s.Path == "" {
+			return fmt.Errorf("http 类型需要配置 http.listen")
+		}
+	case "journalctl", "journald", "otlp", "forward", "docker", "cri", "kubernetes":
+	case "":
+		return fmt.Errorf("type 不能为空 (可选: %s)", strings.Join(SourceTypes, ", "))
+	default:
+		return fmt.Errorf("不支持的数据源类型 %s (可选: %s)", s.Type, strings.Join(SourceTypes, ", "))
+	}
+
+	if s.Priority < 0 {
+		return fmt.Errorf("priority 不能为负数")
+	}
+	if s.PollInterval < 0 {
+		return fmt.Errorf("poll_interval 不能为负数")
+	}
+	for _, tf := range s.Forward.TagFormats {
+		if tf.Tag == "" || tf.Format == "" {
+			return fmt.Errorf("forward.tag_formats 的 tag 和 format 不能为空")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadMultiSourceExamples(t *testing.T) {
+	var loaded []*MultiSourceConfig
+	for _, name := range []string{"multi-source-example.json", "multi-source-example.yaml", "multi-source-example.toml"} {
+		cfg, err := LoadMultiSourceConfig(filepath.Join("..", "..", name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		loaded = append(loaded, cfg)
+	}
+
+	cfg := loaded[0]
+	if len(cfg.Sources) != 6 || !cfg.Enabled {
+		t.Fatalf("unexpected sources: %+v", cfg)
+	}
+	journal := cfg.Sources[3]
+	if journal.Type != "journalctl" || journal.Journal.Priority != "err" ||
+		!reflect.DeepEqual(journal.Journal.Services, []string{"nginx", "docker", "postgresql"}) {
+		t.Errorf("unexpected journal source: %+v", journal)
+	}
+	// 三种格式描述的是同一份配置
+	for i, other := range loaded[1:] {
+		if !reflect.DeepEqual(cfg, other) {
+			t.Errorf("format %d differs:\n%+v\n%+v", i+1, cfg, other)
+		}
+	}
+}
+
+func TestParseMultiSourceConfig(t *testing.T) {
+	cfg, err := ParseMultiSourceConfig([]byte(`
+sources:
+  - name: api
+    type: command
+    command: kubectl logs -f deploy/api
+    enabled: true
+  - name: app
+    type: file
+    path: /var/log/app
+    grace_period: 2m
+    enabled: true
+`), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Sources[0].Command.Command != "kubectl logs -f deploy/api" {
+		t.Errorf("command = %q", cfg.Sources[0].Command.Command)
+	}
+	if cfg.Sources[1].GracePeriod != 2*time.Minute {
+		t.Errorf("grace_period = %v", cfg.Sources[1].GracePeriod)
+	}
+
+	_, err = ParseMultiSourceConfig([]byte(`
+[[sources]]
+name = "a"
+type = "file"
+
+[[sources]]
+name = "a"
+type = "kafka"
+`), "toml")
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{"需要配置 path", "名称重复", "不支持的数据源类型 kafka"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
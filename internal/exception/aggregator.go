@@ -0,0 +1,101 @@
+package exception
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// 按指纹归并的异常
+type Group struct {
+	Exception
+	Count     int64     `json:"count"`      // 出现次数
+	FirstSeen time.Time `json:"first_seen"` // 首次出现时间
+	LastSeen  time.Time `json:"last_seen"`  // 最后出现时间
+	Example   string    `json:"example"`    // 首次出现的完整事件
+
+	lastAlert time.Time // 最后一次告警的时间
+}
+
+// 异常统计器：按指纹计数并记录首次/最后出现时间
+type Aggregator struct {
+	groups map[string]*Group
+	mutex  sync.Mutex
+}
+
+// 创建异常统计器
+func NewAggregator() *Aggregator {
+	return &Aggregator{groups: make(map[string]*Group)}
+}
+
+// 记录一次异常，返回该指纹的统计副本
+func (a *Aggregator) Add(exc *Exception, at time.Time, event string) Group {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	group, exists := a.groups[exc.Fingerprint]
+	if !exists {
+		group = &Group{
+			Exception: *exc,
+			FirstSeen: at,
+			Example:   event,
+		}
+		a.groups[exc.Fingerprint] = group
+	}
+
+	group.Count++
+	if !at.IsZero() {
+		// 没有时间戳的事件不影响首次/最后出现时间
+		if group.FirstSeen.IsZero() || at.Before(group.FirstSeen) {
+			group.FirstSeen = at
+		}
+		if at.After(group.LastSeen) {
+			group.LastSeen = at
+		}
+	}
+
+	return *group
+}
+
+// 判断异常是否需要告警：从未告警或距上次告警超过 window 时返回 true 并记录告警时间。
+// 分析可能并发乱序完成，按时间差的绝对值判断；window 不大于 0 时总是告警
+func (a *Aggregator) ShouldAlert(fingerprint string, at time.Time, window time.Duration) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	group, exists := a.groups[fingerprint]
+	if !exists || window <= 0 {
+		return true
+	}
+	if !group.lastAlert.IsZero() {
+		elapsed := at.Sub(group.lastAlert)
+		if elapsed < 0 {
+			elapsed = -elapsed
+		}
+		if elapsed < window {
+			return false
+		}
+	}
+	group.lastAlert = at
+	return true
+}
+
+// 获取所有异常统计（按出现次数降序）
+func (a *Aggregator) Groups() []Group {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	groups := make([]Group, 0, len(a.groups))
+	for _, group := range a.groups {
+		groups = append(groups, *group)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].FirstSeen.Before(groups[j].FirstSeen)
+	})
+
+	return groups
+}
@@ -0,0 +1,117 @@
+package exception
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/xurenlu/aipipe/internal/record"
+)
+
+// 默认单个多行事件的最大行数
+const DefaultMaxLines = 500
+
+// 不带缩进的 Java 异常头（如 logger.error 之后单独一行输出的异常）
+var javaHeaderLinePattern = regexp.MustCompile(`^(?:[a-zA-Z_$][\w$]*\.)+[A-Z][\w$]*(?:Exception|Error|Throwable)(?::|$)`)
+
+// 续行前缀
+var continuationPrefixes = []string{
+	"Caused by:",
+	"Traceback (most recent call last):",
+	"During handling of the above exception",
+	"The above exception was the direct cause",
+}
+
+// 多行事件组装器：把堆栈、Traceback、goroutine dump 等续行合并到前一条日志
+type Assembler struct {
+	maxLines  int
+	lines     []string
+	traceback bool // 正在读取 Python Traceback
+	excLine   bool // Python 异常行已读取，Traceback 结束
+	goDump    bool // 正在读取 Go panic 输出
+}
+
+// 创建多行事件组装器
+func NewAssembler(maxLines int) *Assembler {
+	if maxLines <= 0 {
+		maxLines = DefaultMaxLines
+	}
+	return &Assembler{maxLines: maxLines}
+}
+
+// 添加一行日志，新事件开始时返回已完整的上一个事件
+func (a *Assembler) Add(line string) (string, bool) {
+	if len(a.lines) > 0 && len(a.lines) < a.maxLines && a.isContinuation(line) {
+		a.lines = append(a.lines, line)
+		return "", false
+	}
+
+	event, ok := a.Flush()
+	a.start(line)
+	return event, ok
+}
+
+// 取出尚未输出的事件
+func (a *Assembler) Flush() (string, bool) {
+	if len(a.lines) == 0 {
+		return "", false
+	}
+
+	event := strings.TrimRight(strings.Join(a.lines, "\n"), "\n")
+	a.lines = a.lines[:0]
+	a.traceback, a.excLine, a.goDump = false, false, false
+	return event, true
+}
+
+// 是否有尚未输出的事件
+func (a *Assembler) Pending() bool {
+	return len(a.lines) > 0
+}
+
+// 开始新事件
+func (a *Assembler) start(line string) {
+	a.lines = append(a.lines, line)
+	a.traceback = strings.HasPrefix(line, "Traceback (most recent call last):")
+	a.goDump = strings.HasPrefix(line, "panic: ") || strings.HasPrefix(line, "fatal error: ")
+}
+
+// 判断是否为当前事件的续行
+func (a *Assembler) isContinuation(line string) bool {
+	// 带时间戳的行总是新事件
+	if _, ok := record.ExtractTimestamp(line); ok {
+		return false
+	}
+
+	// Go panic 输出直到下一条带时间戳的日志为止
+	if a.goDump {
+		return true
+	}
+	if strings.HasPrefix(line, "goroutine ") && strings.HasSuffix(strings.TrimSpace(line), ":") {
+		a.goDump = true
+		return true
+	}
+
+	if line == "" {
+		return a.traceback
+	}
+
+	for _, prefix := range continuationPrefixes {
+		if strings.HasPrefix(line, prefix) {
+			if prefix == "Traceback (most recent call last):" {
+				a.traceback, a.excLine = true, false
+			}
+			return true
+		}
+	}
+
+	if line[0] == ' ' || line[0] == '\t' {
+		return !a.excLine
+	}
+
+	// Python Traceback 最后一行是不带缩进的异常行
+	if a.traceback && !a.excLine {
+		a.excLine = true
+		return true
+	}
+
+	return !a.traceback && javaHeaderLinePattern.MatchString(line)
+}
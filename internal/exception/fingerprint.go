@@ -0,0 +1,338 @@
+package exception
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/xurenlu/aipipe/internal/config"
+)
+
+// 异常信息
+type Exception struct {
+	Language    string   `json:"language,omitempty"` // 语言: java, python, go（无堆栈时为空）
+	Class       string   `json:"class"`              // 异常类型
+	Message     string   `json:"message"`            // 异常消息
+	Template    string   `json:"template"`           // 去掉变量后的消息模板
+	Frames      []string `json:"frames,omitempty"`   // 参与指纹计算的应用堆栈帧
+	Fingerprint string   `json:"fingerprint"`        // 异常指纹
+}
+
+var (
+	// Java 异常头：java.lang.NullPointerException: message
+	javaHeaderPattern = regexp.MustCompile(`(?:^|[\s:"])((?:[a-zA-Z_$][\w$]*\.)+[A-Z][\w$]*(?:Exception|Error|Throwable))(?::\s*(.*))?$`)
+	// Java 堆栈帧：at com.example.OrderService.create(OrderService.java:88)
+	javaFramePattern = regexp.MustCompile(`^\s*at\s+([\w$.<>/]+)\(`)
+
+	// Python 堆栈帧：File "/app/orders.py", line 42, in create
+	pythonFramePattern = regexp.MustCompile(`^\s+File "([^"]+)", line \d+, in (\S+)`)
+	// Python 异常行：ZeroDivisionError: division by zero
+	pythonExceptionPattern = regexp.MustCompile(`^([A-Za-z_][\w.]*(?:Error|Exception|Warning|Interrupt|Exit)|[A-Z]\w*)(?::\s*(.*))?$`)
+
+	// Go panic 头：panic: runtime error: ... / fatal error: ...
+	goPanicPattern = regexp.MustCompile(`^(panic|fatal error): (.*)$`)
+	// Go 函数帧：main.(*OrderService).Create(0xc000010000)
+	goFramePattern = regexp.MustCompile(`^(\S+)\(.*\)$`)
+
+	// 单行异常（无堆栈）：SomethingException: message
+	plainHeaderPattern = regexp.MustCompile(`(?:^|[\s:"])([A-Z][\w$]*(?:Exception|Error))(?::\s*(.*))?$`)
+)
+
+// 消息中的变量：引号字符串、UUID、十六进制、数字
+var messageVariablePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`'[^']*'|"[^"]*"`),
+	regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`),
+	regexp.MustCompile(`0[xX][0-9a-fA-F]+|\b[0-9a-fA-F]{16,}\b`),
+	regexp.MustCompile(`\d+(?:\.\d+)*`),
+}
+
+// Java 动态生成类名中的变量部分（如 $$EnhancerBySpringCGLIB$$1a2b3c、lambda$create$0）
+var javaGeneratedPattern = regexp.MustCompile(`\$\$[0-9a-fA-F]+\b|\$\d+\b`)
+
+// 未配置应用包名时视为框架/标准库的前缀
+var libraryPrefixes = map[string][]string{
+	"java": {
+		"java.", "javax.", "jdk.", "sun.", "com.sun.", "kotlin.", "scala.",
+		"org.springframework.", "org.apache.", "org.hibernate.", "io.netty.",
+		"com.fasterxml.", "org.junit.", "reactor.", "io.grpc.",
+	},
+	"python": {"site-packages/", "dist-packages/", "/lib/python", "<frozen"},
+}
+
+// 异常指纹生成器
+type Fingerprinter struct {
+	maxFrames   int
+	appPackages []string
+}
+
+// 创建异常指纹生成器
+func NewFingerprinter(cfg config.ExceptionConfig) *Fingerprinter {
+	maxFrames := cfg.MaxFrames
+	if maxFrames <= 0 {
+		maxFrames = 3
+	}
+	return &Fingerprinter{
+		maxFrames:   maxFrames,
+		appPackages: cfg.AppPackages,
+	}
+}
+
+// 从日志事件（可能是多行）中解析异常，不包含异常时返回 false
+func (f *Fingerprinter) Parse(event string) (*Exception, bool) {
+	if !mayContainException(event) {
+		return nil, false
+	}
+
+	lines := strings.Split(strings.ReplaceAll(event, "\r\n", "\n"), "\n")
+
+	var exc *Exception
+	switch {
+	case strings.Contains(event, "Traceback (most recent call last):"):
+		exc = f.parsePython(lines)
+	case strings.Contains(event, "goroutine ") && goPanicIndex(lines) >= 0:
+		exc = f.parseGo(lines)
+	default:
+		exc = f.parseJava(lines)
+	}
+	if exc == nil {
+		exc = parsePlain(lines[0])
+	}
+	if exc == nil {
+		return nil, false
+	}
+
+	exc.Template = messageTemplate(exc.Message)
+	exc.Fingerprint = fingerprint(exc)
+	return exc, true
+}
+
+// 快速判断是否可能包含异常，避免对普通日志逐行匹配正则
+func mayContainException(event string) bool {
+	return strings.Contains(event, "Exception") ||
+		strings.Contains(event, "Error") ||
+		strings.Contains(event, "Throwable") ||
+		strings.Contains(event, "Traceback") ||
+		strings.Contains(event, "panic: ") ||
+		strings.Contains(event, "fatal error: ")
+}
+
+// 解析 Java 异常：使用第一个异常头及其堆栈帧（Caused by 之前）
+func (f *Fingerprinter) parseJava(lines []string) *Exception {
+	var exc *Exception
+	var frames []string
+
+	for _, line := range lines {
+		if exc == nil {
+			if m := javaHeaderPattern.FindStringSubmatch(strings.TrimRight(line, " \t")); m != nil {
+				exc = &Exception{Language: "java", Class: m[1], Message: strings.TrimSpace(m[2])}
+			}
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "Caused by:") || strings.HasPrefix(trimmed, "Suppressed:") {
+			break
+		}
+		if m := javaFramePattern.FindStringSubmatch(line); m != nil {
+			frames = append(frames, javaGeneratedPattern.ReplaceAllLiteralString(m[1], "$<*>"))
+		}
+	}
+
+	if exc == nil {
+		return nil
+	}
+	if len(frames) == 0 && !strings.Contains(exc.Class, ".") {
+		// 没有堆栈的非限定类名无法确定语言
+		exc.Language = ""
+	}
+	exc.Frames = f.selectFrames("java", frames)
+	return exc
+}
+
+// 解析 Python 异常：使用最后一个 Traceback（实际抛出的异常），堆栈帧从最内层开始
+func (f *Fingerprinter) parsePython(lines []string) *Exception {
+	var exc *Exception
+	var frames []string
+	inTraceback := false
+
+	for _, line := range lines {
+		if strings.HasPrefix(line, "Traceback (most recent call last):") {
+			frames = frames[:0]
+			inTraceback = true
+			continue
+		}
+		if !inTraceback {
+			continue
+		}
+		if m := pythonFramePattern.FindStringSubmatch(line); m != nil {
+			frames = append(frames, path.Base(m[1])+":"+m[2])
+			continue
+		}
+		if line == "" || line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		if m := pythonExceptionPattern.FindStringSubmatch(line); m != nil {
+			inner := make([]string, len(frames))
+			for i, frame := range frames {
+				inner[len(frames)-1-i] = frame
+			}
+			exc = &Exception{Language: "python", Class: m[1], Message: strings.TrimSpace(m[2])}
+			exc.Frames = f.selectPythonFrames(lines, inner)
+		}
+		inTraceback = false
+	}
+
+	return exc
+}
+
+// 选择 Python 应用堆栈帧（按文件路径判断是否为第三方库）
+func (f *Fingerprinter) selectPythonFrames(lines []string, frames []string) []string {
+	if len(f.appPackages) > 0 {
+		return f.selectFrames("python", frames)
+	}
+
+	// 帧中只保留了文件名，需要根据原始路径过滤第三方库
+	library := make(map[string]bool)
+	for _, line := range lines {
+		if m := pythonFramePattern.FindStringSubmatch(line); m != nil && hasAnyPrefix(m[1], libraryPrefixes["python"], true) {
+			library[path.Base(m[1])+":"+m[2]] = true
+		}
+	}
+
+	app := make([]string, 0, f.maxFrames)
+	for _, frame := range frames {
+		if !library[frame] {
+			app = append(app, frame)
+		}
+	}
+	return f.limitFrames(app, frames)
+}
+
+// 解析 Go panic：使用第一个 goroutine 的调用栈
+func (f *Fingerprinter) parseGo(lines []string) *Exception {
+	start := goPanicIndex(lines)
+	m := goPanicPattern.FindStringSubmatch(strings.TrimSpace(lines[start]))
+	exc := &Exception{Language: "go", Class: m[1], Message: strings.TrimSpace(m[2])}
+
+	// runtime error 作为异常类型更有区分度
+	if strings.HasPrefix(exc.Message, "runtime error: ") {
+		exc.Class = "runtime error"
+		exc.Message = strings.TrimPrefix(exc.Message, "runtime error: ")
+	}
+
+	var frames []string
+	inGoroutine := false
+loop:
+	for _, line := range lines[start+1:] {
+		switch {
+		case strings.HasPrefix(line, "goroutine "):
+			if inGoroutine {
+				break loop
+			}
+			inGoroutine = true
+		case !inGoroutine:
+		case line == "":
+			break loop
+		case line[0] == '\t' || line[0] == ' ' || strings.HasPrefix(line, "created by "):
+			// 文件位置行和 created by 行不参与指纹
+		default:
+			if fm := goFramePattern.FindStringSubmatch(line); fm != nil {
+				frames = append(frames, fm[1])
+			}
+		}
+	}
+
+	exc.Frames = f.selectFrames("go", frames)
+	return exc
+}
+
+// 查找 Go panic 头所在行
+func goPanicIndex(lines []string) int {
+	for i, line := range lines {
+		if goPanicPattern.MatchString(strings.TrimSpace(line)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// 解析没有堆栈的单行异常
+func parsePlain(line string) *Exception {
+	line = strings.TrimRight(line, " \t")
+	if m := javaHeaderPattern.FindStringSubmatch(line); m != nil {
+		return &Exception{Language: "java", Class: m[1], Message: strings.TrimSpace(m[2])}
+	}
+	if m := plainHeaderPattern.FindStringSubmatch(line); m != nil {
+		return &Exception{Class: m[1], Message: strings.TrimSpace(m[2])}
+	}
+	return nil
+}
+
+// 选择前 N 个应用堆栈帧，没有应用帧时退回使用前 N 个帧
+func (f *Fingerprinter) selectFrames(language string, frames []string) []string {
+	app := make([]string, 0, f.maxFrames)
+	for _, frame := range frames {
+		if f.isAppFrame(language, frame) {
+			app = append(app, frame)
+		}
+	}
+	return f.limitFrames(app, frames)
+}
+
+func (f *Fingerprinter) limitFrames(app, all []string) []string {
+	if len(app) == 0 {
+		app = all
+	}
+	if len(app) > f.maxFrames {
+		app = app[:f.maxFrames]
+	}
+	if len(app) == 0 {
+		return nil
+	}
+	return append([]string(nil), app...)
+}
+
+// 判断是否为应用代码的堆栈帧
+func (f *Fingerprinter) isAppFrame(language, frame string) bool {
+	if len(f.appPackages) > 0 {
+		return hasAnyPrefix(frame, f.appPackages, false)
+	}
+
+	if language == "go" {
+		// 标准库的包路径第一段不包含点号（如 runtime、net/http），main 包除外
+		if i := strings.Index(frame, "/"); i >= 0 {
+			return strings.Contains(frame[:i], ".")
+		}
+		return strings.HasPrefix(frame, "main.")
+	}
+
+	return !hasAnyPrefix(frame, libraryPrefixes[language], language == "python")
+}
+
+// 前缀匹配，contains 为 true 时只要包含即可（用于文件路径）
+func hasAnyPrefix(s string, prefixes []string, contains bool) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) || (contains && strings.Contains(s, prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// 去掉消息中的变量，生成消息模板
+func messageTemplate(message string) string {
+	for _, p := range messageVariablePatterns {
+		message = p.ReplaceAllString(message, "<*>")
+	}
+	return message
+}
+
+// 计算异常指纹：语言 + 异常类型 + 消息模板 + 应用堆栈帧（不含行号，避免代码变更后指纹变化）
+func fingerprint(exc *Exception) string {
+	parts := []string{exc.Language, exc.Class, exc.Template}
+	parts = append(parts, exc.Frames...)
+	hash := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return fmt.Sprintf("%x", hash[:8])
+}
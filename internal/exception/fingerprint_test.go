@@ -0,0 +1,120 @@
+package exception
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xurenlu/aipipe/internal/config"
+)
+
+// 组装日志行为事件
+func assemble(lines []string) []string {
+	assembler := NewAssembler(0)
+	var events []string
+	for _, line := range lines {
+		if event, ok := assembler.Add(line); ok {
+			events = append(events, event)
+		}
+	}
+	if event, ok := assembler.Flush(); ok {
+		events = append(events, event)
+	}
+	return events
+}
+
+// 测试多行事件组装
+func TestAssembler(t *testing.T) {
+	lines := strings.Split(`2025-10-17 10:00:01 ERROR Failed to create order
+java.lang.NullPointerException: order is null
+	at com.example.OrderService.create(OrderService.java:88)
+Caused by: java.lang.IllegalStateException: boom
+	... 3 more
+2025-10-17 10:06:00 ERROR Request failed
+Traceback (most recent call last):
+  File "/app/orders.py", line 42, in create
+    total = order.total / count
+ZeroDivisionError: division by zero
+plain output
+panic: runtime error: index out of range [3] with length 3
+
+goroutine 1 [running]:
+main.main()
+	/app/main.go:12 +0x1d
+2025-10-17 10:07:00 INFO ok`, "\n")
+
+	events := assemble(lines)
+	if len(events) != 5 {
+		t.Fatalf("期望 5 个事件, 实际 %d: %q", len(events), events)
+	}
+	if !strings.HasSuffix(events[0], "... 3 more") {
+		t.Errorf("Java 堆栈未合并: %q", events[0])
+	}
+	if !strings.HasSuffix(events[1], "ZeroDivisionError: division by zero") {
+		t.Errorf("Python Traceback 未合并: %q", events[1])
+	}
+	if events[2] != "plain output" {
+		t.Errorf("Traceback 之后的普通行应为新事件: %q", events[2])
+	}
+	if !strings.HasPrefix(events[3], "panic: ") || !strings.Contains(events[3], "main.main()") {
+		t.Errorf("Go panic 未合并: %q", events[3])
+	}
+}
+
+// 测试指纹在行号和消息变量变化时保持稳定
+func TestFingerprint(t *testing.T) {
+	f := NewFingerprinter(config.ExceptionConfig{MaxFrames: 2})
+
+	java := func(line int, id string) string {
+		return "2025-10-17 10:00:01 ERROR Failed\n" +
+			"java.lang.NullPointerException: order " + id + " is null\n" +
+			"\tat com.example.OrderService.create(OrderService.java:" + strings.Repeat("8", line) + ")\n" +
+			"\tat org.springframework.web.servlet.FrameworkServlet.service(FrameworkServlet.java:897)\n" +
+			"\tat com.example.OrderController.post(OrderController.java:42)\n"
+	}
+
+	a, ok := f.Parse(java(1, "1001"))
+	if !ok {
+		t.Fatal("未能解析 Java 异常")
+	}
+	b, _ := f.Parse(java(2, "2002"))
+	if a.Fingerprint != b.Fingerprint {
+		t.Errorf("相同异常的指纹不同: %s != %s", a.Fingerprint, b.Fingerprint)
+	}
+	if a.Class != "java.lang.NullPointerException" || a.Template != "order <*> is null" {
+		t.Errorf("Java 异常解析错误: %+v", a)
+	}
+	if strings.Join(a.Frames, ",") != "com.example.OrderService.create,com.example.OrderController.post" {
+		t.Errorf("应用堆栈帧错误: %v", a.Frames)
+	}
+
+	python, ok := f.Parse(`Traceback (most recent call last):
+  File "/app/orders.py", line 42, in create
+    total = order.total / count
+  File "/usr/lib/python3.11/site-packages/flask/app.py", line 1, in dispatch
+    return f()
+ZeroDivisionError: division by zero`)
+	if !ok || python.Language != "python" || python.Class != "ZeroDivisionError" {
+		t.Fatalf("Python 异常解析错误: %+v", python)
+	}
+	if strings.Join(python.Frames, ",") != "orders.py:create" {
+		t.Errorf("Python 应用堆栈帧错误: %v", python.Frames)
+	}
+
+	goPanic, ok := f.Parse(`panic: runtime error: invalid memory address or nil pointer dereference
+
+goroutine 1 [running]:
+main.(*OrderService).Create(0x0, 0xc000012345)
+	/app/order.go:88 +0x26
+runtime.goexit()
+	/usr/local/go/src/runtime/asm.go:1 +0x1`)
+	if !ok || goPanic.Class != "runtime error" {
+		t.Fatalf("Go panic 解析错误: %+v", goPanic)
+	}
+	if strings.Join(goPanic.Frames, ",") != "main.(*OrderService).Create" {
+		t.Errorf("Go 应用堆栈帧错误: %v", goPanic.Frames)
+	}
+
+	if _, ok := f.Parse("2025-10-17 10:00:00 INFO request completed in 12ms"); ok {
+		t.Error("普通日志不应解析出异常")
+	}
+}
@@ -0,0 +1,301 @@
+package input
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/xurenlu/aipipe/internal/record"
+)
+
+// 压缩格式的魔数
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	bzip2Magic = []byte("BZh")
+)
+
+// 轮转文件后缀：app.log.1、app.log.2.gz
+var rotationIndexPattern = regexp.MustCompile(`\.(\d+)(?:\.(?:gz|zst|zstd|bz2))?$`)
+
+// 日期轮转后缀：app.log-20251017、app-2025-10-17.log.gz
+var rotationDatePattern = regexp.MustCompile(`(\d{4})-?(\d{2})-?(\d{2})`)
+
+// 待分析的归档文件
+type ArchiveFile struct {
+	Path        string    `json:"path"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time"`
+	Compression string    `json:"compression"` // gzip, zstd, bzip2 或空
+	Start       time.Time `json:"start"`       // 文件中第一条日志的时间
+	HasTime     bool      `json:"has_time"`    // 是否解析到起始时间
+	Rotation    int       `json:"rotation"`    // 轮转序号，越大越旧
+}
+
+// 展开文件路径和通配符，返回去重后的文件列表
+func ExpandPaths(patterns []string) ([]string, error) {
+	seen := make(map[string]bool)
+	paths := make([]string, 0)
+
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("无效的文件模式 %s: %w", p, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("没有匹配的文件: %s", p)
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil || info.IsDir() || seen[match] {
+				continue
+			}
+			seen[match] = true
+			paths = append(paths, match)
+		}
+	}
+
+	return paths, nil
+}
+
+// 收集文件信息并按时间顺序排序（最旧的在前）
+func SortChronologically(paths []string) ([]ArchiveFile, error) {
+	files := make([]ArchiveFile, 0, len(paths))
+	for _, path := range paths {
+		file, err := inspectFile(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	allHaveTime := true
+	for _, file := range files {
+		if !file.HasTime {
+			allHaveTime = false
+			break
+		}
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if allHaveTime && !files[i].Start.Equal(files[j].Start) {
+			return files[i].Start.Before(files[j].Start)
+		}
+		// 无法解析时间时按轮转序号：app.log.3 早于 app.log.1 早于 app.log
+		if files[i].Rotation != files[j].Rotation {
+			return files[i].Rotation > files[j].Rotation
+		}
+		return files[i].ModTime.Before(files[j].ModTime)
+	})
+
+	return files, nil
+}
+
+// 读取文件信息和起始时间
+func inspectFile(path string) (ArchiveFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ArchiveFile{}, fmt.Errorf("获取文件信息失败: %w", err)
+	}
+
+	file := ArchiveFile{
+		Path:     path,
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		Rotation: rotationIndex(path),
+	}
+
+	reader, err := Open(path)
+	if err != nil {
+		return file, err
+	}
+	defer reader.Close()
+	file.Compression = reader.Compression
+
+	// 只检查前若干行
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for i := 0; i < 20 && scanner.Scan(); i++ {
+		if t, ok := record.ExtractTimestamp(scanner.Text()); ok {
+			file.Start = t
+			file.HasTime = true
+			return file, nil
+		}
+	}
+
+	// 退而使用文件名中的日期
+	if m := rotationDatePattern.FindStringSubmatch(filepath.Base(path)); m != nil {
+		if t, err := time.ParseInLocation("20060102", m[1]+m[2]+m[3], time.Local); err == nil {
+			file.Start = t
+			file.HasTime = true
+		}
+	}
+
+	return file, nil
+}
+
+// 解析轮转序号，当前文件为 0
+func rotationIndex(path string) int {
+	m := rotationIndexPattern.FindStringSubmatch(filepath.Base(path))
+	if m == nil {
+		return 0
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// 打开文件，根据魔数透明解压 gzip/zstd/bzip2
+func Open(path string) (*Reader, error) {
+	return OpenSince(path, time.Time{})
+}
+
+// 打开文件，对较大的未压缩文件按时间二分查找，直接定位到 since 附近
+func OpenSince(path string, since time.Time) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开文件失败: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("获取文件信息失败: %w", err)
+	}
+
+	var offset int64
+	if !since.IsZero() && info.Size() > seekMinSize && !isCompressed(file) {
+		if offset, err = SeekTime(file, info.Size(), since); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("定位文件失败 %s: %w", path, err)
+		}
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("定位文件失败 %s: %w", path, err)
+	}
+
+	counter := NewCountingReader(file)
+	counter.count = offset
+	reader, compression, err := decompress(counter)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("解压文件失败 %s: %w", path, err)
+	}
+
+	return &Reader{
+		Reader:      reader,
+		Compression: compression,
+		size:        info.Size(),
+		counter:     counter,
+		closers:     []io.Closer{reader, file},
+	}, nil
+}
+
+// 打开的（可能已解压的）日志文件
+type Reader struct {
+	io.Reader
+	Compression string // gzip, zstd, bzip2 或空
+
+	size    int64
+	counter *CountingReader
+	closers []io.Closer
+}
+
+// 读取进度（按原始文件字节数计算，0-1）
+func (r *Reader) Progress() float64 {
+	if r.size <= 0 {
+		return 1
+	}
+	progress := float64(r.counter.Count()) / float64(r.size)
+	if progress > 1 {
+		progress = 1
+	}
+	return progress
+}
+
+// 关闭解压器和底层文件
+func (r *Reader) Close() error {
+	var firstErr error
+	for _, c := range r.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// 检查文件开头是否为压缩格式的魔数
+func isCompressed(file *os.File) bool {
+	header := make([]byte, 4)
+	n, _ := file.ReadAt(header, 0)
+	header = header[:n]
+	return bytes.HasPrefix(header, gzipMagic) || bytes.HasPrefix(header, zstdMagic) || bytes.HasPrefix(header, bzip2Magic)
+}
+
+// 根据魔数选择解压器
+func decompress(r io.Reader) (io.ReadCloser, string, error) {
+	buffered := bufio.NewReaderSize(r, 64*1024)
+	header, _ := buffered.Peek(4)
+
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, "", err
+		}
+		return gz, "gzip", nil
+	case bytes.HasPrefix(header, zstdMagic):
+		zr, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, "", err
+		}
+		return zr.IOReadCloser(), "zstd", nil
+	case bytes.HasPrefix(header, bzip2Magic):
+		return io.NopCloser(bzip2.NewReader(buffered)), "bzip2", nil
+	}
+
+	return io.NopCloser(buffered), "", nil
+}
+
+// 统计已读取字节数的 Reader，用于显示进度
+type CountingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+// 创建计数 Reader
+func NewCountingReader(r io.Reader) *CountingReader {
+	return &CountingReader{reader: r}
+}
+
+func (c *CountingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	atomic.AddInt64(&c.count, int64(n))
+	return n, err
+}
+
+// 已读取字节数
+func (c *CountingReader) Count() int64 {
+	return atomic.LoadInt64(&c.count)
+}
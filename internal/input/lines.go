@@ -0,0 +1,336 @@
+package input
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xurenlu/aipipe/internal/config"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// 超长行处理策略
+const (
+	LongLineTruncate = "truncate" // 截断并添加标记
+	LongLineSplit    = "split"    // 拆分为多行
+	LongLineSkip     = "skip"     // 整行丢弃
+)
+
+// 默认单行最大字节数
+const DefaultMaxLineSize = 1024 * 1024
+
+// 行读取选项
+type LineOptions struct {
+	Encoding       string // auto, utf-8, gbk, gb18030, latin1
+	MaxLineSize    int    // 单行最大字节数
+	LongLinePolicy string // truncate, split, skip
+	SkipBinary     bool   // 是否跳过二进制行
+}
+
+// 默认行读取选项
+func DefaultLineOptions() LineOptions {
+	return LineOptions{
+		Encoding:       "auto",
+		MaxLineSize:    DefaultMaxLineSize,
+		LongLinePolicy: LongLineTruncate,
+		SkipBinary:     true,
+	}
+}
+
+// 根据全局输入配置和数据源编码生成行读取选项
+func NewLineOptions(cfg config.InputConfig, encoding string) LineOptions {
+	opts := DefaultLineOptions()
+	if cfg.Encoding != "" {
+		opts.Encoding = cfg.Encoding
+	}
+	if encoding != "" {
+		opts.Encoding = encoding
+	}
+	if cfg.MaxLineSize > 0 {
+		opts.MaxLineSize = cfg.MaxLineSize
+	}
+	if cfg.LongLinePolicy != "" {
+		opts.LongLinePolicy = cfg.LongLinePolicy
+	}
+	opts.SkipBinary = cfg.SkipBinary
+	return opts
+}
+
+// 校验行读取选项
+func (o LineOptions) Validate() error {
+	if _, err := lookupEncoding(o.Encoding); err != nil {
+		return err
+	}
+	switch o.LongLinePolicy {
+	case "", LongLineTruncate, LongLineSplit, LongLineSkip:
+		return nil
+	}
+	return fmt.Errorf("不支持的超长行策略: %s (可选: truncate, split, skip)", o.LongLinePolicy)
+}
+
+// 行读取统计
+type LineStats struct {
+	Lines      int64 `json:"lines"`      // 输出行数
+	Transcoded int64 `json:"transcoded"` // 转码的行数
+	Truncated  int64 `json:"truncated"`  // 截断的行数
+	Split      int64 `json:"split"`      // 被拆分的超长行数
+	Skipped    int64 `json:"skipped"`    // 丢弃的超长行数
+	Binary     int64 `json:"binary"`     // 丢弃的二进制行数
+}
+
+// 逐行读取器：支持任意长度的行、编码转换和二进制行检测，不会因单行过长而中断
+type LineReader struct {
+	reader   *bufio.Reader
+	options  LineOptions
+	decoder  *encoding.Decoder // 指定编码时非 UTF-8 行使用的解码器，auto 模式下逐行检测
+	auto     bool
+	pending  []byte // split 策略下已读取、尚未输出的部分
+	lineEnd  bool   // pending 已包含行尾
+	split    bool   // 正在拆分超长行
+	consumed int64  // 已消费的原始字节数
+	offset   int64  // 已完整输出的行之后的原始字节位置
+	stats    LineStats
+}
+
+// 创建逐行读取器
+func NewLineReader(r io.Reader, opts LineOptions) *LineReader {
+	if opts.MaxLineSize <= 0 {
+		opts.MaxLineSize = DefaultMaxLineSize
+	}
+	if opts.LongLinePolicy == "" {
+		opts.LongLinePolicy = LongLineTruncate
+	}
+
+	lr := &LineReader{
+		reader:  bufio.NewReaderSize(r, 64*1024),
+		options: opts,
+	}
+
+	if enc, err := lookupEncoding(opts.Encoding); err == nil && enc != nil {
+		lr.decoder = enc.NewDecoder()
+	}
+	lr.auto = opts.Encoding == "" || strings.EqualFold(opts.Encoding, "auto")
+
+	return lr
+}
+
+// 读取下一行（已转换为 UTF-8，不含换行符），读完返回 io.EOF
+func (lr *LineReader) ReadLine() (string, error) {
+	for {
+		raw, skipped, err := lr.readRaw()
+		if skipped {
+			continue
+		}
+		if raw == nil {
+			return "", err
+		}
+
+		if lr.options.SkipBinary && isBinary(raw) {
+			lr.stats.Binary++
+			continue
+		}
+
+		lr.stats.Lines++
+		return lr.decode(raw), nil
+	}
+}
+
+// 读取统计
+func (lr *LineReader) Stats() LineStats {
+	return lr.stats
+}
+
+// 已消费的原始字节数（用于记录读取位置）
+func (lr *LineReader) Consumed() int64 {
+	return lr.consumed
+}
+
+// 最后一个完整输出（或跳过）的行之后的原始字节位置：split 策略下超长行的最后一段输出后才前进，
+// 从这里恢复读取不会从行中间开始
+func (lr *LineReader) Offset() int64 {
+	return lr.offset
+}
+
+// 读取一行原始字节，按超长行策略处理；没有更多数据时返回 nil
+func (lr *LineReader) readRaw() ([]byte, bool, error) {
+	max := lr.options.MaxLineSize
+	if lr.options.LongLinePolicy == LongLineSplit {
+		return lr.readSplit(max)
+	}
+
+	var line []byte
+	overflow := 0
+
+	for {
+		chunk, err := lr.reader.ReadSlice('\n')
+		lr.consumed += int64(len(chunk))
+
+		if len(line) < max {
+			line = append(line, chunk...)
+		} else {
+			overflow += len(chunk)
+		}
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && len(line) == 0 && overflow == 0 {
+			return nil, false, err
+		}
+		break
+	}
+	lr.offset = lr.consumed
+
+	line = trimLineEnding(line)
+	if len(line) <= max && overflow == 0 {
+		return line, false, nil
+	}
+
+	switch lr.options.LongLinePolicy {
+	case LongLineSkip:
+		lr.stats.Skipped++
+		return nil, true, nil
+	default:
+		lr.stats.Truncated++
+		dropped := len(line) - max + overflow
+		line = trimToRuneBoundary(line[:max])
+		return append(line, []byte(fmt.Sprintf(" …[已截断 %d 字节]", dropped))...), false, nil
+	}
+}
+
+// split 策略：超长行每读满 max 字节就输出一段，内存中不保留整行
+func (lr *LineReader) readSplit(max int) ([]byte, bool, error) {
+	line, lineEnd := lr.pending, lr.lineEnd
+	lr.pending, lr.lineEnd = nil, false
+
+	for !lineEnd && len(line) <= max {
+		chunk, err := lr.reader.ReadSlice('\n')
+		lr.consumed += int64(len(chunk))
+		line = append(line, chunk...)
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && len(line) == 0 {
+			return nil, false, err
+		}
+		line, lineEnd = trimLineEnding(line), true
+	}
+
+	if len(line) <= max {
+		lr.split = false
+		lr.offset = lr.consumed
+		return line, false, nil
+	}
+
+	if !lr.split {
+		lr.split = true
+		lr.stats.Split++
+	}
+	part := trimToRuneBoundary(line[:max])
+	if len(part) == 0 {
+		part = line[:max]
+	}
+	lr.pending = append([]byte(nil), line[len(part):]...)
+	lr.lineEnd = lineEnd
+	return part, false, nil
+}
+
+// 将原始字节转换为 UTF-8
+func (lr *LineReader) decode(raw []byte) string {
+	decoder := lr.decoder
+	if lr.auto {
+		if utf8.Valid(raw) {
+			return string(raw)
+		}
+		// 同一文件中可能混有不同编码的行（如个别 Latin-1 行），每行单独检测
+		decoder = detectEncoding(raw).NewDecoder()
+	}
+
+	if decoder == nil {
+		return strings.ToValidUTF8(string(raw), "�")
+	}
+
+	decoded, err := decoder.Bytes(raw)
+	if err != nil {
+		return strings.ToValidUTF8(string(raw), "�")
+	}
+	lr.stats.Transcoded++
+	return string(decoded)
+}
+
+// 根据名称查找编码，UTF-8 和 auto 返回 nil
+func lookupEncoding(name string) (encoding.Encoding, error) {
+	switch strings.ToLower(strings.ReplaceAll(name, "_", "-")) {
+	case "", "auto", "utf-8", "utf8":
+		return nil, nil
+	case "gbk", "cp936":
+		return simplifiedchinese.GBK, nil
+	case "gb18030":
+		return simplifiedchinese.GB18030, nil
+	case "gb2312", "euc-cn":
+		// GBK 是 GB2312 的超集
+		return simplifiedchinese.GBK, nil
+	case "latin1", "latin-1", "iso-8859-1", "iso8859-1":
+		return charmap.ISO8859_1, nil
+	case "windows-1252", "cp1252":
+		return charmap.Windows1252, nil
+	}
+	return nil, fmt.Errorf("不支持的编码: %s (可选: auto, utf-8, gbk, gb18030, latin1)", name)
+}
+
+// 检测非 UTF-8 行的编码：能按 GB18030 完整解码且包含中文时视为 GB18030，否则视为 Latin-1
+func detectEncoding(raw []byte) encoding.Encoding {
+	decoded, err := simplifiedchinese.GB18030.NewDecoder().Bytes(raw)
+	if err == nil && !bytes.ContainsRune(decoded, utf8.RuneError) {
+		for _, r := range string(decoded) {
+			if r >= 0x4E00 && r <= 0x9FFF {
+				return simplifiedchinese.GB18030
+			}
+		}
+	}
+	return charmap.ISO8859_1
+}
+
+// 判断是否为二进制数据：包含 NUL 或控制字符比例过高
+func isBinary(raw []byte) bool {
+	if len(raw) == 0 {
+		return false
+	}
+
+	control := 0
+	for _, b := range raw {
+		if b == 0 {
+			return true
+		}
+		// 保留制表符、换页符和 ANSI 转义序列
+		if b < 0x20 && b != '\t' && b != '\f' && b != 0x1b && b != '\r' {
+			control++
+		}
+	}
+	return control*10 > len(raw)*3
+}
+
+// 去掉行尾的 \n 和 \r\n
+func trimLineEnding(line []byte) []byte {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	return bytes.TrimSuffix(line, []byte("\r"))
+}
+
+// 截断到完整的 UTF-8 字符边界，避免切断多字节字符
+func trimToRuneBoundary(b []byte) []byte {
+	if utf8.Valid(b) {
+		return b
+	}
+	for k := 1; k < utf8.UTFMax && k < len(b); k++ {
+		if utf8.Valid(b[:len(b)-k]) {
+			return b[:len(b)-k]
+		}
+	}
+	return b
+}
@@ -0,0 +1,93 @@
+package input
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func readAll(t *testing.T, lr *LineReader) []string {
+	var lines []string
+	for {
+		line, err := lr.ReadLine()
+		if err == io.EOF {
+			return lines
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+}
+
+// 测试 split 策略边读边拆分，每段不超过最大长度
+func TestLineReaderSplit(t *testing.T) {
+	long := strings.Repeat("a", 250)
+	opts := DefaultLineOptions()
+	opts.MaxLineSize = 100
+	opts.LongLinePolicy = LongLineSplit
+
+	lr := NewLineReader(strings.NewReader("short\n"+long+"\r\nafter\n"), opts)
+	lines := readAll(t, lr)
+
+	want := []string{"short", long[:100], long[100:200], long[200:], "after"}
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Fatalf("拆分结果 = %q", lines)
+	}
+	if lr.Stats().Split != 1 {
+		t.Errorf("拆分行数 = %d, 期望 1", lr.Stats().Split)
+	}
+}
+
+// 测试读取位置只在整行输出后前进，超长行拆分到一半时停留在行首
+func TestLineReaderOffset(t *testing.T) {
+	opts := DefaultLineOptions()
+	opts.MaxLineSize = 4
+	opts.LongLinePolicy = LongLineSplit
+
+	lr := NewLineReader(strings.NewReader("ab\nabcdefghij\nxy\n"), opts)
+	want := []struct {
+		line   string
+		offset int64
+	}{{"ab", 3}, {"abcd", 3}, {"efgh", 3}, {"ij", 14}, {"xy", 17}}
+	for _, w := range want {
+		line, err := lr.ReadLine()
+		if err != nil || line != w.line || lr.Offset() != w.offset {
+			t.Fatalf("读取 %q 后位置 = %d (%v), 期望 %q 和 %d", line, lr.Offset(), err, w.line, w.offset)
+		}
+	}
+}
+
+// 测试 split 策略不缓存整行：读取第一段时只消费了有限的输入
+func TestLineReaderSplitStreaming(t *testing.T) {
+	opts := DefaultLineOptions()
+	opts.MaxLineSize = 1024
+	opts.LongLinePolicy = LongLineSplit
+
+	huge := strings.Repeat("x", 10*1024*1024)
+	lr := NewLineReader(strings.NewReader(huge+"\n"), opts)
+	part, err := lr.ReadLine()
+	if err != nil || len(part) != 1024 {
+		t.Fatalf("第一段长度 = %d, %v", len(part), err)
+	}
+	if lr.Consumed() > 128*1024 {
+		t.Errorf("输出第一段前已读取 %d 字节", lr.Consumed())
+	}
+}
+
+// 测试自动检测编码时，个别 Latin-1 行不影响之后 GBK 行的解码
+func TestLineReaderAutoEncodingPerLine(t *testing.T) {
+	latin1, _ := charmap.ISO8859_1.NewEncoder().String("café au lait")
+	gbk, _ := simplifiedchinese.GBK.NewEncoder().String("数据库连接失败")
+
+	lr := NewLineReader(strings.NewReader(latin1+"\n"+gbk+"\nplain\n"), DefaultLineOptions())
+	lines := readAll(t, lr)
+
+	want := []string{"café au lait", "数据库连接失败", "plain"}
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Errorf("解码结果 = %q", lines)
+	}
+}
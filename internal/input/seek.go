@@ -0,0 +1,73 @@
+package input
+
+import (
+	"bufio"
+	"io"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/record"
+)
+
+// 小于该大小的文件直接顺序读取，不做二分查找
+const seekMinSize = 1024 * 1024
+
+// 二分查找收敛到该范围后改为顺序扫描
+const seekWindow = 64 * 1024
+
+// 每次探测最多读取的行数（跳过无时间戳的续行）
+const seekProbeLines = 64
+
+// 在按时间排序的纯文本日志中二分查找 since，返回应开始读取的行首偏移
+// 返回的位置保证不晚于第一条时间 >= since 的日志
+func SeekTime(r io.ReadSeeker, size int64, since time.Time) (int64, error) {
+	lo, hi := int64(0), size
+
+	for hi-lo > seekWindow {
+		mid := lo + (hi-lo)/2
+
+		offset, t, ok, err := probeTimestamp(r, mid, hi)
+		if err != nil {
+			return 0, err
+		}
+
+		if ok && t.Before(since) {
+			lo = offset
+		} else {
+			hi = mid
+		}
+	}
+
+	return lo, nil
+}
+
+// 从 pos 之后的第一个完整行开始，查找第一条带时间戳的日志
+func probeTimestamp(r io.ReadSeeker, pos, limit int64) (int64, time.Time, bool, error) {
+	if _, err := r.Seek(pos, io.SeekStart); err != nil {
+		return 0, time.Time{}, false, err
+	}
+
+	reader := bufio.NewReader(r)
+	offset := pos
+
+	// 跳过 pos 所在的半行
+	if pos > 0 {
+		skipped, err := reader.ReadString('\n')
+		offset += int64(len(skipped))
+		if err != nil {
+			return 0, time.Time{}, false, nil
+		}
+	}
+
+	for i := 0; i < seekProbeLines && offset < limit; i++ {
+		line, err := reader.ReadString('\n')
+		if t, ok := record.ExtractTimestamp(line); ok {
+			return offset, t, true, nil
+		}
+		offset += int64(len(line))
+		if err != nil {
+			break
+		}
+	}
+
+	return 0, time.Time{}, false, nil
+}
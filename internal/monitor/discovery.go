@@ -0,0 +1,320 @@
+package monitor
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/input"
+)
+
+// 默认删除文件的宽限期：期间重新创建的文件视为轮转，继续监控
+const DefaultGracePeriod = 30 * time.Second
+
+// 目录源默认排除的压缩归档文件
+var defaultDirectoryExcludes = []string{"*.gz", "*.zst", "*.bz2", "*.xz", "*.zip"}
+
+// 动态文件源：通配符或目录，自动监控新创建的匹配文件
+type FileSource struct {
+	Pattern     string            // 文件路径、通配符（支持 ** 匹配多级目录）或目录
+	Recursive   bool              // 目录源是否包含子目录
+	Exclude     []string          // 排除模式，匹配文件名或完整路径
+	GracePeriod time.Duration     // 文件删除后继续等待的时间，超时后停止监控
+	Poll        bool              // 强制轮询（用于 NFS、CIFS 等不支持 fsnotify 的文件系统）
+	Options     input.LineOptions // 编码和超长行处理选项
+	OnRemove    func(path string) // 文件停止监控时调用（在该文件已读取的行都投递之后）
+
+	root     string   // 需要监控的根目录
+	segments []string // 匹配模式按路径分隔符拆分后的各段
+	callback func(string, string)
+}
+
+// 路径是否包含通配符
+func IsPattern(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// 规范化文件源：目录转换为 dir/* 或 dir/**，并计算需要监控的根目录
+func (s *FileSource) normalize() error {
+	pattern := filepath.Clean(s.Pattern)
+
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+		s.root = pattern
+		if s.Recursive {
+			pattern = filepath.Join(pattern, "**")
+		} else {
+			pattern = filepath.Join(pattern, "*")
+		}
+		s.Exclude = append(append([]string{}, defaultDirectoryExcludes...), s.Exclude...)
+	} else {
+		// 根目录为第一个包含通配符的路径段之前的部分
+		s.root = filepath.Dir(pattern)
+		for IsPattern(s.root) {
+			s.root = filepath.Dir(s.root)
+		}
+	}
+
+	for _, exclude := range s.Exclude {
+		if _, err := filepath.Match(exclude, ""); err != nil {
+			return fmt.Errorf("无效的排除模式 %s: %w", exclude, err)
+		}
+	}
+	if _, err := filepath.Match(filepath.Base(pattern), ""); err != nil {
+		return fmt.Errorf("无效的文件模式 %s: %w", s.Pattern, err)
+	}
+
+	if s.GracePeriod <= 0 {
+		s.GracePeriod = DefaultGracePeriod
+	}
+	s.segments = splitPath(pattern)
+	return nil
+}
+
+// 文件是否匹配该源（且未被排除）
+func (s *FileSource) matches(path string) bool {
+	if !matchSegments(s.segments, splitPath(path)) {
+		return false
+	}
+
+	for _, exclude := range s.Exclude {
+		if ok, _ := filepath.Match(exclude, filepath.Base(path)); ok {
+			return false
+		}
+		if matchSegments(splitPath(exclude), splitPath(path)) {
+			return false
+		}
+	}
+	return true
+}
+
+// 目录下是否可能存在匹配的文件（需要监控该目录）
+func (s *FileSource) watchesDir(dir string) bool {
+	return matchPrefix(s.segments, splitPath(dir))
+}
+
+func splitPath(path string) []string {
+	return strings.Split(filepath.ToSlash(filepath.Clean(path)), "/")
+}
+
+// 按路径段匹配，** 匹配零个或多个路径段
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := filepath.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
+
+// 目录路径能否作为匹配路径的前缀
+func matchPrefix(pattern, segments []string) bool {
+	if len(segments) == 0 {
+		return len(pattern) > 0
+	}
+	if len(pattern) == 0 {
+		return false
+	}
+	if pattern[0] == "**" {
+		return true
+	}
+	if ok, _ := filepath.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchPrefix(pattern[1:], segments[1:])
+}
+
+// 添加动态文件源，返回启动时匹配到的文件数
+// 启动时已存在的文件按 SetStartFrom 的设置读取，之后新创建的文件从头读取
+func (fm *FileMonitor) AddSource(source FileSource, callback func(string, string)) (int, error) {
+	if err := source.Options.Validate(); err != nil {
+		return 0, err
+	}
+	if err := source.normalize(); err != nil {
+		return 0, err
+	}
+	if _, err := os.Stat(source.root); err != nil {
+		return 0, fmt.Errorf("目录不存在: %s", source.root)
+	}
+	source.callback = callback
+
+	fm.readMu.Lock()
+	defer fm.readMu.Unlock()
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	src := &source
+	fm.sources = append(fm.sources, src)
+	fm.sweepOnce.Do(func() { go fm.sweep() })
+
+	before := len(fm.files)
+	if err := fm.scanDir(src, src.root, fm.startFrom); err != nil {
+		return 0, err
+	}
+	return len(fm.files) - before, nil
+}
+
+// 扫描目录：监控可能包含匹配文件的子目录，并添加已存在的匹配文件
+func (fm *FileMonitor) scanDir(src *FileSource, root, startFrom string) error {
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// 无权限等错误只跳过该目录
+			return nil
+		}
+
+		if entry.IsDir() {
+			if path != src.root && !src.watchesDir(path) {
+				return filepath.SkipDir
+			}
+			fm.watchDir(path, src.Poll || fm.forcePoll)
+			return nil
+		}
+
+		if entry.Type().IsRegular() && src.matches(path) {
+			fm.addDiscoveredFile(src, path, startFrom)
+		}
+		return nil
+	})
+}
+
+// 添加目录监控（重复添加会被忽略），poll 为 true 或 fsnotify 注册失败时改为轮询
+func (fm *FileMonitor) watchDir(dir string, poll bool) {
+	if _, polled := fm.polledDirs[dir]; polled || fm.watchedDirs[dir] {
+		return
+	}
+	if !poll {
+		err := fm.watcher.Add(dir)
+		if err == nil {
+			fm.watchedDirs[dir] = true
+			return
+		}
+		fmt.Printf("⚠️  无法监听目录 %s (%v)，改为每 %s 轮询一次\n", dir, err, fm.pollEvery)
+	}
+	// 已有的文件由调用方扫描，轮询只处理之后新出现的文件
+	fm.polledDirs[dir] = listDir(dir)
+}
+
+// 处理新创建的路径：新目录继续扫描，匹配的新文件开始监控
+func (fm *FileMonitor) discover(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+
+	for _, src := range fm.sources {
+		if info.IsDir() {
+			if src.watchesDir(path) {
+				// 新目录中的文件可能在添加监控之前就已创建，从头读取
+				fm.scanDir(src, path, StartFromBeginning)
+			}
+			continue
+		}
+
+		if info.Mode().IsRegular() && src.matches(path) {
+			if fm.tracking(info) {
+				// 轮转时重命名的旧文件（如 app.log -> app.log.1）由原路径负责读完
+				return
+			}
+			fm.addDiscoveredFile(src, path, StartFromBeginning)
+			return
+		}
+	}
+}
+
+// 文件是否正在被某个路径读取
+func (fm *FileMonitor) tracking(info os.FileInfo) bool {
+	for _, monitoredFile := range fm.files {
+		if monitoredFile.handle == nil {
+			continue
+		}
+		if current, err := monitoredFile.handle.Stat(); err == nil && os.SameFile(info, current) {
+			return true
+		}
+	}
+	return false
+}
+
+// 添加动态发现的文件
+func (fm *FileMonitor) addDiscoveredFile(src *FileSource, path, startFrom string) {
+	if _, exists := fm.files[path]; exists {
+		return
+	}
+
+	if err := fm.addFile(path, src.Options, src.callback, startFrom); err != nil {
+		fmt.Printf("⚠️  添加文件监控失败: %s - %v\n", path, err)
+		return
+	}
+
+	monitoredFile := fm.files[path]
+	monitoredFile.gracePeriod = src.GracePeriod
+	monitoredFile.onRemove = src.OnRemove
+	monitoredFile.Polling = monitoredFile.Polling || src.Poll
+	if startFrom == StartFromBeginning {
+		fmt.Printf("📄 发现新文件，开始监控: %s\n", path)
+	}
+}
+
+// 定期清理已删除且超过宽限期的动态文件
+func (fm *FileMonitor) sweep() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			fm.removeExpiredFiles()
+		case <-fm.stopChan:
+			return
+		}
+	}
+}
+
+func (fm *FileMonitor) removeExpiredFiles() {
+	fm.readMu.Lock()
+	defer fm.readMu.Unlock()
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	for path, monitoredFile := range fm.files {
+		if monitoredFile.gracePeriod == 0 || monitoredFile.RemovedAt.IsZero() {
+			continue
+		}
+
+		if _, err := os.Stat(path); err == nil {
+			// 文件已重新创建（轮转），继续监控
+			monitoredFile.RemovedAt = time.Time{}
+			fm.checkFile(monitoredFile)
+			continue
+		}
+
+		if time.Since(monitoredFile.RemovedAt) < monitoredFile.gracePeriod {
+			continue
+		}
+
+		// 读完已删除文件的剩余内容后停止监控
+		if monitoredFile.handle != nil {
+			fm.readNewLines(monitoredFile, true)
+		}
+		monitoredFile.close()
+		delete(fm.files, path)
+		delete(fm.callbacks, path)
+		fm.enqueue(fileLine{path: path, removed: true, positions: fm.positions, onRemove: monitoredFile.onRemove})
+		fmt.Printf("🗑️  文件已删除，停止监控: %s\n", path)
+	}
+}
@@ -1,33 +1,88 @@
 package monitor
 
 import (
-	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/xurenlu/aipipe/internal/input"
+)
+
+// 新添加文件的起始读取位置
+const (
+	StartFromBeginning  = "beginning"  // 从文件开头读取
+	StartFromEnd        = "end"        // 只读取之后新写入的内容
+	StartFromCheckpoint = "checkpoint" // 从上次保存的位置继续，没有检查点时从末尾开始
 )
 
 // 文件监控器
 type FileMonitor struct {
-	watcher   *fsnotify.Watcher
-	files     map[string]*MonitoredFile
-	callbacks map[string]func(string, string) // filepath -> callback
-	mutex     sync.RWMutex
-	stopChan  chan bool
+	watcher     *fsnotify.Watcher
+	files       map[string]*MonitoredFile
+	callbacks   map[string]func(string, string) // filepath -> callback
+	positions   *PositionStore                  // 读取位置检查点（可选）
+	startFrom   string
+	sources     []*FileSource              // 动态文件源（通配符、目录）
+	watchedDirs map[string]bool            // 已添加 fsnotify 监控的目录
+	polledDirs  map[string]map[string]bool // 改为轮询的目录 -> 上次轮询时目录中的文件名
+	forcePoll   bool                       // 所有文件和目录都使用轮询
+	pollEvery   time.Duration              // 轮询间隔
+	sweepOnce   sync.Once
+	mutex       sync.RWMutex
+	readMu      sync.Mutex // 串行化文件读取和文件列表的修改，先于 mutex 获取
+	stopChan    chan bool
+	lines       chan fileLine // 读取到的行，由投递协程在锁外调用回调
+	delivered   chan struct{} // 投递协程退出时关闭
 }
 
+// 等待投递给回调的一行日志；callback 为空时只用于推进检查点
+type fileLine struct {
+	path     string
+	line     string
+	callback func(string, string)
+
+	// 文件停止监控：排在该文件之前读取的行之后，删除检查点并通知数据源
+	removed  bool
+	onRemove func(string)
+
+	// 回调处理完这一行后记录的读取位置
+	positions *PositionStore
+	device    uint64
+	inode     uint64
+	offset    int64
+}
+
+// 读取协程和投递协程之间的缓冲行数
+const lineBufferSize = 1024
+
 // 被监控的文件
 type MonitoredFile struct {
-	Path      string    `json:"path"`
-	LastPos   int64     `json:"last_pos"`
-	LastMod   time.Time `json:"last_mod"`
-	Size      int64     `json:"size"`
-	IsActive  bool      `json:"is_active"`
-	CreatedAt time.Time `json:"created_at"`
+	Path      string            `json:"path"`
+	LastPos   int64             `json:"last_pos"`
+	LastMod   time.Time         `json:"last_mod"`
+	Size      int64             `json:"size"`
+	IsActive  bool              `json:"is_active"`
+	CreatedAt time.Time         `json:"created_at"`
+	Device    uint64            `json:"device"`     // 当前读取文件的设备号
+	Inode     uint64            `json:"inode"`      // 当前读取文件的 inode
+	Rotations int               `json:"rotations"`  // 检测到的轮转/截断次数
+	RemovedAt time.Time         `json:"removed_at"` // 文件被删除/移走的时间（动态文件超过宽限期后停止监控）
+	Polling   bool              `json:"polling"`    // 是否通过轮询检查变化（fsnotify 不可用时）
+	Options   input.LineOptions `json:"-"`          // 编码和超长行处理选项
+
+	// 当前读取的文件句柄；文件被轮转后仍指向旧文件，直到旧文件读完
+	handle *os.File
+	// 动态发现的文件被删除后的宽限期，为 0 表示静态添加的文件
+	gracePeriod time.Duration
+	// 动态发现的文件停止监控时的通知
+	onRemove func(string)
+	// 轮询发现文件有变化但一直没有收到 fsnotify 事件的起始时间
+	staleSince time.Time
 }
 
 // 创建新的文件监控器
@@ -38,62 +93,141 @@ func NewFileMonitor() (*FileMonitor, error) {
 	}
 
 	fm := &FileMonitor{
-		watcher:   watcher,
-		files:     make(map[string]*MonitoredFile),
-		callbacks: make(map[string]func(string, string)),
-		stopChan:  make(chan bool),
+		watcher:     watcher,
+		files:       make(map[string]*MonitoredFile),
+		callbacks:   make(map[string]func(string, string)),
+		startFrom:   StartFromBeginning,
+		watchedDirs: make(map[string]bool),
+		polledDirs:  make(map[string]map[string]bool),
+		pollEvery:   DefaultPollInterval,
+		stopChan:    make(chan bool),
+		lines:       make(chan fileLine, lineBufferSize),
+		delivered:   make(chan struct{}),
 	}
 
-	// 启动监控协程
+	// 启动监控协程、轮询协程和投递协程
 	go fm.watch()
+	go fm.poll()
+	go fm.deliver()
 
 	return fm, nil
 }
 
+// 设置新添加文件的起始读取位置 (beginning, end, checkpoint)
+func (fm *FileMonitor) SetStartFrom(from string) error {
+	switch from {
+	case StartFromBeginning, StartFromEnd, StartFromCheckpoint:
+	default:
+		return fmt.Errorf("不支持的起始位置: %s (可选: beginning, end, checkpoint)", from)
+	}
+
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	fm.startFrom = from
+	return nil
+}
+
+// 启用读取位置检查点，按 interval 定期保存，停止监控时再保存一次
+func (fm *FileMonitor) EnableCheckpoints(store *PositionStore, interval time.Duration) {
+	fm.mutex.Lock()
+	fm.positions = store
+	fm.mutex.Unlock()
+
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := store.Save(); err != nil {
+					fmt.Printf("⚠️  保存读取位置失败: %v\n", err)
+				}
+			case <-fm.stopChan:
+				return
+			}
+		}
+	}()
+}
+
 // 添加文件监控
 func (fm *FileMonitor) AddFile(filePath string, callback func(string, string)) error {
+	return fm.AddFileWithOptions(filePath, input.DefaultLineOptions(), callback)
+}
+
+// 添加文件监控，并指定编码和超长行处理选项
+func (fm *FileMonitor) AddFileWithOptions(filePath string, options input.LineOptions, callback func(string, string)) error {
+	if err := options.Validate(); err != nil {
+		return err
+	}
+
+	fm.readMu.Lock()
+	defer fm.readMu.Unlock()
 	fm.mutex.Lock()
 	defer fm.mutex.Unlock()
 
+	return fm.addFile(filePath, options, callback, fm.startFrom)
+}
+
+// 添加文件监控（调用方需持有 readMu 和 mutex）
+func (fm *FileMonitor) addFile(filePath string, options input.LineOptions, callback func(string, string), startFrom string) error {
 	// 检查文件是否存在
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		return fmt.Errorf("文件不存在: %s", filePath)
 	}
 
-	// 获取文件信息
-	info, err := os.Stat(filePath)
-	if err != nil {
-		return fmt.Errorf("获取文件信息失败: %w", err)
-	}
-
-	// 添加文件到监控列表
-	fm.files[filePath] = &MonitoredFile{
+	monitoredFile := &MonitoredFile{
 		Path:      filePath,
 		LastPos:   0,
-		LastMod:   info.ModTime(),
-		Size:      info.Size(),
 		IsActive:  true,
 		CreatedAt: time.Now(),
+		Options:   options,
+	}
+
+	// 打开文件并记录 inode，用于检测轮转
+	if err := monitoredFile.open(); err != nil {
+		return err
 	}
+	monitoredFile.LastPos = fm.startOffset(monitoredFile, startFrom)
+	fm.recordPosition(monitoredFile)
+
+	// 重复添加时关闭之前的句柄
+	if old, exists := fm.files[filePath]; exists {
+		old.close()
+	}
+
+	// 添加文件到监控列表
+	monitoredFile.Polling = fm.forcePoll
+	fm.files[filePath] = monitoredFile
 
 	// 添加回调函数
 	fm.callbacks[filePath] = callback
 
-	// 添加文件到 fsnotify
-	dir := filepath.Dir(filePath)
-	if err := fm.watcher.Add(dir); err != nil {
-		return fmt.Errorf("添加目录监控失败: %w", err)
-	}
+	// 添加文件所在目录到 fsnotify（失败时改为轮询）
+	fm.watchDir(filepath.Dir(filePath), fm.forcePoll)
+
+	// 立即处理起始位置之后已有的内容，不必等到下一次写入
+	fm.readNewLines(monitoredFile, false)
 
 	return nil
 }
 
 // 移除文件监控
 func (fm *FileMonitor) RemoveFile(filePath string) error {
+	fm.readMu.Lock()
+	defer fm.readMu.Unlock()
 	fm.mutex.Lock()
 	defer fm.mutex.Unlock()
 
 	// 从监控列表移除
+	if file, exists := fm.files[filePath]; exists {
+		file.close()
+	}
 	delete(fm.files, filePath)
 	delete(fm.callbacks, filePath)
 
@@ -116,68 +250,298 @@ func (fm *FileMonitor) watch() {
 
 // 处理文件事件
 func (fm *FileMonitor) handleEvent(event fsnotify.Event) {
-	fm.mutex.RLock()
-	defer fm.mutex.RUnlock()
+	fm.readMu.Lock()
+	defer fm.readMu.Unlock()
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
 
 	// 查找匹配的文件
-	for filePath, monitoredFile := range fm.files {
-		if !monitoredFile.IsActive {
-			continue
+	monitoredFile, exists := fm.files[event.Name]
+	if !exists {
+		// 通配符/目录源中新创建的文件或目录
+		if event.Op&fsnotify.Create != 0 {
+			fm.discover(event.Name)
 		}
-
-		// 检查是否是目标文件的事件
-		if event.Name == filePath {
-			if event.Op&fsnotify.Write == fsnotify.Write {
-				fm.handleFileWrite(filePath, monitoredFile)
-			}
+		// 被删除的目录会自动移除监控，重新创建时需要再次添加
+		if event.Op&(fsnotify.Rename|fsnotify.Remove) != 0 {
+			delete(fm.watchedDirs, event.Name)
 		}
+		return
+	}
+	monitoredFile.staleSince = time.Time{}
+
+	if event.Op&(fsnotify.Rename|fsnotify.Remove) != 0 && monitoredFile.RemovedAt.IsZero() {
+		monitoredFile.RemovedAt = time.Now()
+	}
+	if event.Op&fsnotify.Create != 0 {
+		monitoredFile.RemovedAt = time.Time{}
+	}
+
+	// Write 读取新增内容；Create/Rename/Remove 可能是日志轮转
+	if monitoredFile.IsActive && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) != 0 {
+		fm.checkFile(monitoredFile)
 	}
 }
 
-// 处理文件写入事件
-func (fm *FileMonitor) handleFileWrite(filePath string, monitoredFile *MonitoredFile) {
-	// 获取文件当前大小
-	info, err := os.Stat(filePath)
+// 检查文件变化：读取新增内容，并处理截断（copytruncate）和轮转（rename + create）
+func (fm *FileMonitor) checkFile(monitoredFile *MonitoredFile) {
+	if monitoredFile.handle == nil {
+		if err := monitoredFile.open(); err != nil {
+			return
+		}
+		monitoredFile.LastPos = 0
+	}
+
+	fm.readNewLines(monitoredFile, false)
+
+	// 路径不存在说明文件已被移走，保留旧句柄等待新文件创建
+	info, err := os.Stat(monitoredFile.Path)
 	if err != nil {
 		return
 	}
+	current, err := monitoredFile.handle.Stat()
+	if err == nil && os.SameFile(info, current) {
+		return
+	}
 
-	currentSize := info.Size()
-	if currentSize <= monitoredFile.LastPos {
+	// 路径指向了新文件：先把旧文件读到末尾（包括最后不完整的行），再从头读取新文件
+	fm.readNewLines(monitoredFile, true)
+	monitoredFile.close()
+	monitoredFile.Rotations++
+
+	if err := monitoredFile.open(); err != nil {
 		return
 	}
+	monitoredFile.LastPos = 0
+	fm.readNewLines(monitoredFile, false)
+}
 
-	// 读取新增内容
-	file, err := os.Open(filePath)
+// 从上次位置读取新增的完整行，final 为 true 时连同末尾不完整的行一起读取
+func (fm *FileMonitor) readNewLines(monitoredFile *MonitoredFile, final bool) {
+	info, err := monitoredFile.handle.Stat()
 	if err != nil {
 		return
 	}
-	defer file.Close()
 
-	// 定位到上次读取位置
-	file.Seek(monitoredFile.LastPos, 0)
+	currentSize := info.Size()
+	if currentSize < monitoredFile.LastPos {
+		// 文件变小说明被截断（copytruncate），从头开始读取
+		monitoredFile.LastPos = 0
+		monitoredFile.Rotations++
+	}
+
+	end := currentSize
+	if !final {
+		// 只读取到最后一个换行符，不完整的行留到下次写入后再读
+		end = lastLineEnd(monitoredFile.handle, monitoredFile.LastPos, currentSize, monitoredFile.Options.MaxLineSize)
+	}
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line != "" {
-			// 调用回调函数
-			if callback, exists := fm.callbacks[filePath]; exists {
-				callback(filePath, line)
+	if end > monitoredFile.LastPos {
+		start := monitoredFile.LastPos
+		section := io.NewSectionReader(monitoredFile.handle, start, end-start)
+		reader := input.NewLineReader(section, monitoredFile.Options)
+		delivered := true
+		for delivered {
+			line, err := reader.ReadLine()
+			if err != nil {
+				break
+			}
+			if line != "" {
+				if callback, exists := fm.callbacks[monitoredFile.Path]; exists {
+					next := fm.positionOf(monitoredFile, start+reader.Offset())
+					next.line, next.callback = line, callback
+					delivered = fm.enqueue(next)
+				}
 			}
 		}
+		monitoredFile.LastPos = end
+		if delivered {
+			fm.recordPosition(monitoredFile)
+		}
 	}
 
 	// 更新文件状态
-	monitoredFile.LastPos = currentSize
 	monitoredFile.LastMod = info.ModTime()
 	monitoredFile.Size = currentSize
 }
 
-// 停止监控
+// 把一行交给投递协程，停止监控时放弃并返回 false
+// 调用方持有 readMu 和 mutex；缓冲区满时先释放 mutex 再等待（回调处理慢时读取也随之放慢），
+// 等待期间状态查询、暂停/恢复不受影响，而文件读取和文件列表的修改仍由 readMu 串行化
+func (fm *FileMonitor) enqueue(line fileLine) bool {
+	select {
+	case fm.lines <- line:
+		return true
+	default:
+	}
+
+	fm.mutex.Unlock()
+	defer fm.mutex.Lock()
+
+	select {
+	case fm.lines <- line:
+		return true
+	case <-fm.stopChan:
+		return false
+	}
+}
+
+// 投递协程：在锁外按读取顺序调用回调，回调阻塞不会影响文件事件处理和状态查询
+func (fm *FileMonitor) deliver() {
+	defer close(fm.delivered)
+
+	for {
+		select {
+		case line := <-fm.lines:
+			line.deliver()
+		case <-fm.stopChan:
+			// 投递已读取的剩余行
+			for {
+				select {
+				case line := <-fm.lines:
+					line.deliver()
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// 调用回调，处理完成后才把检查点推进到这一行之后，回调处理前退出的行在重启后会重新读取
+func (line fileLine) deliver() {
+	if line.removed {
+		if line.positions != nil {
+			line.positions.Delete(line.path)
+		}
+		if line.onRemove != nil {
+			line.onRemove(line.path)
+		}
+		return
+	}
+
+	if line.callback != nil {
+		line.callback(line.path, line.line)
+	}
+	if line.positions != nil {
+		line.positions.Set(line.path, line.device, line.inode, line.offset)
+	}
+}
+
+// 计算新添加文件的起始读取位置
+func (fm *FileMonitor) startOffset(monitoredFile *MonitoredFile, startFrom string) int64 {
+	switch startFrom {
+	case StartFromEnd:
+		return lastLineEnd(monitoredFile.handle, 0, monitoredFile.Size, 0)
+	case StartFromCheckpoint:
+		if fm.positions != nil {
+			if offset, ok := fm.positions.Get(monitoredFile.Path, monitoredFile.Device, monitoredFile.Inode); ok {
+				if offset > monitoredFile.Size {
+					// 停止期间文件被截断
+					return 0
+				}
+				return offset
+			}
+		}
+		// 第一次运行（没有检查点）或停止期间文件被轮转（新文件的内容都没有处理过）时从头读取
+	}
+	return 0
+}
+
+// 记录当前读取位置到检查点：和日志行一起经过投递协程，排在之前读取的行都处理完之后
+func (fm *FileMonitor) recordPosition(monitoredFile *MonitoredFile) {
+	if fm.positions != nil {
+		fm.enqueue(fm.positionOf(monitoredFile, monitoredFile.LastPos))
+	}
+}
+
+// 文件在 offset 处的检查点
+func (fm *FileMonitor) positionOf(monitoredFile *MonitoredFile, offset int64) fileLine {
+	return fileLine{
+		path:      monitoredFile.Path,
+		positions: fm.positions,
+		device:    monitoredFile.Device,
+		inode:     monitoredFile.Inode,
+		offset:    offset,
+	}
+}
+
+// 查找 [start, end) 范围内最后一个换行符之后的位置
+// 没有换行符时返回 start；若不完整的行已超过最大行长度则返回 end，避免一直等待
+func lastLineEnd(r io.ReaderAt, start, end int64, maxLineSize int) int64 {
+	const blockSize = 64 * 1024
+	buf := make([]byte, blockSize)
+
+	for pos := end; pos > start; {
+		n := int64(blockSize)
+		if pos-start < n {
+			n = pos - start
+		}
+		pos -= n
+
+		if _, err := r.ReadAt(buf[:n], pos); err != nil && err != io.EOF {
+			return start
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			return pos + int64(i) + 1
+		}
+	}
+
+	if maxLineSize > 0 && end-start > int64(maxLineSize) {
+		return end
+	}
+	return start
+}
+
+// 打开文件并记录 inode/设备号
+func (mf *MonitoredFile) open() error {
+	file, err := os.Open(mf.Path)
+	if err != nil {
+		return fmt.Errorf("打开文件失败: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("获取文件信息失败: %w", err)
+	}
+
+	mf.handle = file
+	mf.Device, mf.Inode = fileID(info)
+	mf.LastMod = info.ModTime()
+	mf.Size = info.Size()
+	return nil
+}
+
+// 关闭文件句柄
+func (mf *MonitoredFile) close() {
+	if mf.handle != nil {
+		mf.handle.Close()
+		mf.handle = nil
+	}
+}
+
+// 停止监控，等待已读取的行投递给回调后返回
 func (fm *FileMonitor) Stop() {
-	fm.stopChan <- true
+	close(fm.stopChan)
 	fm.watcher.Close()
+
+	<-fm.delivered
+
+	fm.readMu.Lock()
+	defer fm.readMu.Unlock()
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+	for _, file := range fm.files {
+		file.close()
+	}
+
+	// 保存最终读取位置
+	if fm.positions != nil {
+		if err := fm.positions.Save(); err != nil {
+			fmt.Printf("⚠️  保存读取位置失败: %v\n", err)
+		}
+	}
 }
 
 // 获取监控状态
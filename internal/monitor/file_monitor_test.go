@@ -0,0 +1,388 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 启动监控并收集回调收到的日志行
+func startMonitor(t *testing.T, path string) (*FileMonitor, chan string) {
+	t.Helper()
+
+	fm, err := NewFileMonitor()
+	if err != nil {
+		t.Fatalf("创建文件监控器失败: %v", err)
+	}
+	t.Cleanup(fm.Stop)
+
+	lines := make(chan string, 100)
+	if err := fm.AddFile(path, func(_, line string) {
+		lines <- line
+	}); err != nil {
+		t.Fatalf("添加文件监控失败: %v", err)
+	}
+
+	return fm, lines
+}
+
+// 等待并校验收到的日志行
+func expectLines(t *testing.T, lines chan string, want ...string) {
+	t.Helper()
+
+	for _, w := range want {
+		select {
+		case got := <-lines:
+			if got != w {
+				t.Fatalf("期望日志行 %q, 实际 %q", w, got)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("等待日志行超时: %q", w)
+		}
+	}
+}
+
+func appendFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 测试只输出完整的行
+func TestFileMonitorPartialLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, path, "")
+
+	_, lines := startMonitor(t, path)
+
+	appendFile(t, path, "first ha")
+	time.Sleep(200 * time.Millisecond)
+	appendFile(t, path, "lf\nsecond\n")
+
+	expectLines(t, lines, "first half", "second")
+}
+
+// 测试 rename + create 方式的日志轮转
+func TestFileMonitorRenameRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "")
+
+	fm, lines := startMonitor(t, path)
+
+	appendFile(t, path, "before rotation\n")
+	expectLines(t, lines, "before rotation")
+
+	rotated := filepath.Join(dir, "app.log.1")
+	if err := os.Rename(path, rotated); err != nil {
+		t.Fatal(err)
+	}
+	// 轮转后应用仍可能向旧文件写入，切换前需要读完
+	appendFile(t, rotated, "late write to old file\n")
+	time.Sleep(200 * time.Millisecond)
+	appendFile(t, path, "after rotation\n")
+
+	expectLines(t, lines, "late write to old file", "after rotation")
+
+	appendFile(t, path, "more\n")
+	expectLines(t, lines, "more")
+
+	files := fm.GetFiles()
+	if len(files) != 1 || files[0].Rotations != 1 {
+		t.Errorf("期望检测到 1 次轮转, 实际: %+v", files)
+	}
+}
+
+// 测试 copytruncate 方式的日志轮转
+func TestFileMonitorCopyTruncate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, path, "")
+
+	_, lines := startMonitor(t, path)
+
+	appendFile(t, path, "a fairly long line before truncation\n")
+	expectLines(t, lines, "a fairly long line before truncation")
+
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	appendFile(t, path, "short\n")
+
+	expectLines(t, lines, "short")
+}
+
+// 测试重启后从检查点继续读取
+func TestFileMonitorCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	positionFile := filepath.Join(dir, "positions.json")
+	appendFile(t, path, "old line\n")
+
+	start := func() (*FileMonitor, chan string) {
+		store, err := LoadPositionStore(positionFile)
+		if err != nil {
+			t.Fatalf("加载检查点失败: %v", err)
+		}
+
+		fm, err := NewFileMonitor()
+		if err != nil {
+			t.Fatalf("创建文件监控器失败: %v", err)
+		}
+		fm.EnableCheckpoints(store, time.Hour)
+		if err := fm.SetStartFrom(StartFromCheckpoint); err != nil {
+			t.Fatal(err)
+		}
+
+		lines := make(chan string, 100)
+		if err := fm.AddFile(path, func(_, line string) { lines <- line }); err != nil {
+			t.Fatalf("添加文件监控失败: %v", err)
+		}
+		return fm, lines
+	}
+
+	// 没有检查点时从头读取已有内容
+	fm, lines := start()
+	appendFile(t, path, "first run\n")
+	expectLines(t, lines, "old line", "first run")
+	fm.Stop()
+
+	// 停止期间写入的内容在重启后继续读取
+	appendFile(t, path, "while stopped\n")
+	fm, lines = start()
+	defer fm.Stop()
+	appendFile(t, path, "second run\n")
+	expectLines(t, lines, "while stopped", "second run")
+}
+
+// 测试已删除文件的检查点被清理
+func TestPositionStorePrune(t *testing.T) {
+	dir := t.TempDir()
+	kept := filepath.Join(dir, "kept.log")
+	gone := filepath.Join(dir, "gone.log")
+	stopped := filepath.Join(dir, "stopped.log")
+	appendFile(t, kept, "")
+	appendFile(t, stopped, "")
+
+	positionFile := filepath.Join(dir, "positions.json")
+	store, err := LoadPositionStore(positionFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Set(kept, 1, 1, 10)
+	store.Set(gone, 1, 2, 20)
+	store.Set(stopped, 1, 3, 30)
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 停止监控的文件删除检查点，停止期间删除的文件在加载时清理
+	store.Delete(stopped)
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+	store, err = LoadPositionStore(positionFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.Get(kept, 1, 1); !ok {
+		t.Error("期望保留现有文件的检查点")
+	}
+	if _, ok := store.Get(gone, 1, 2); ok {
+		t.Error("期望删除停止期间已删除文件的检查点")
+	}
+	if _, ok := store.Get(stopped, 1, 3); ok {
+		t.Error("期望删除停止监控文件的检查点")
+	}
+}
+
+// 测试检查点只在回调处理完一行后推进
+func TestFileMonitorCheckpointAfterDelivery(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "first\nsecond\n")
+
+	store, err := LoadPositionStore(filepath.Join(dir, "positions.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm, err := NewFileMonitor()
+	if err != nil {
+		t.Fatalf("创建文件监控器失败: %v", err)
+	}
+	defer fm.Stop()
+	fm.EnableCheckpoints(store, time.Hour)
+
+	release := make(chan struct{})
+	handled := make(chan string, 2)
+	if err := fm.AddFile(path, func(_, line string) {
+		<-release
+		handled <- line
+	}); err != nil {
+		t.Fatalf("添加文件监控失败: %v", err)
+	}
+
+	file := fm.GetFiles()[0]
+	offset := func() int64 {
+		pos, _ := store.Get(path, file.Device, file.Inode)
+		return pos
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if pos := offset(); pos != 0 {
+		t.Fatalf("回调处理前检查点已推进到 %d", pos)
+	}
+
+	close(release)
+	expectLines(t, handled, "first", "second")
+	deadline := time.Now().Add(3 * time.Second)
+	for offset() != int64(len("first\nsecond\n")) {
+		if time.Now().After(deadline) {
+			t.Fatalf("处理完成后检查点 = %d", offset())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// 测试通配符源自动发现新文件、排除模式和删除宽限期
+func TestFileMonitorSourceDiscovery(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "pod-a", "app.log")
+	if err := os.MkdirAll(filepath.Dir(existing), 0755); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, existing, "")
+
+	fm, err := NewFileMonitor()
+	if err != nil {
+		t.Fatalf("创建文件监控器失败: %v", err)
+	}
+	t.Cleanup(fm.Stop)
+
+	lines := make(chan string, 100)
+	removed := make(chan string, 10)
+	count, err := fm.AddSource(FileSource{
+		Pattern:     filepath.Join(dir, "**", "*.log"),
+		Exclude:     []string{"debug-*.log"},
+		GracePeriod: 100 * time.Millisecond,
+		OnRemove:    func(path string) { removed <- path },
+	}, func(path, line string) {
+		lines <- filepath.Base(filepath.Dir(path)) + ": " + line
+	})
+	if err != nil {
+		t.Fatalf("添加文件源失败: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("期望启动时匹配 1 个文件, 实际 %d", count)
+	}
+
+	appendFile(t, existing, "existing\n")
+	expectLines(t, lines, "pod-a: existing")
+
+	// 新创建的目录和文件
+	created := filepath.Join(dir, "pod-b", "app.log")
+	if err := os.MkdirAll(filepath.Dir(created), 0755); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	appendFile(t, filepath.Join(dir, "pod-b", "debug-1.log"), "excluded\n")
+	appendFile(t, created, "created\n")
+	expectLines(t, lines, "pod-b: created")
+
+	// 删除的文件在宽限期后停止监控
+	if err := os.Remove(existing); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if len(fm.GetFiles()) == 1 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	files := fm.GetFiles()
+	if len(files) != 1 || files[0].Path != created {
+		t.Errorf("期望只剩下 %s, 实际: %+v", created, files)
+	}
+	select {
+	case path := <-removed:
+		if path != existing {
+			t.Errorf("期望通知停止监控 %s, 实际 %s", existing, path)
+		}
+	case <-time.After(3 * time.Second):
+		t.Error("等待停止监控通知超时")
+	}
+
+	select {
+	case line := <-lines:
+		t.Errorf("不应收到被排除文件的日志: %q", line)
+	default:
+	}
+}
+
+// 测试回调阻塞、缓冲区已满时状态查询不被阻塞，放开后所有行按顺序投递
+func TestFileMonitorSlowCallback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, path, "")
+
+	fm, err := NewFileMonitor()
+	if err != nil {
+		t.Fatalf("创建文件监控器失败: %v", err)
+	}
+	defer fm.Stop()
+
+	release := make(chan struct{})
+	var received []string
+	done := make(chan struct{})
+	total := lineBufferSize * 2
+	if err := fm.AddFile(path, func(_, line string) {
+		<-release
+		received = append(received, line)
+		if len(received) == total {
+			close(done)
+		}
+	}); err != nil {
+		t.Fatalf("添加文件监控失败: %v", err)
+	}
+
+	var content strings.Builder
+	for i := 0; i < total; i++ {
+		fmt.Fprintf(&content, "line %d\n", i)
+	}
+	appendFile(t, path, content.String())
+	time.Sleep(300 * time.Millisecond)
+
+	status := make(chan map[string]interface{})
+	go func() { status <- fm.GetStatus() }()
+	select {
+	case s := <-status:
+		if s["total_files"] != 1 {
+			t.Errorf("状态不符: %v", s)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("缓冲区已满时状态查询被阻塞")
+	}
+
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("等待投递超时，已收到 %d 行", len(received))
+	}
+	for i, line := range received {
+		if want := fmt.Sprintf("line %d", i); line != want {
+			t.Fatalf("第 %d 行 = %q, 期望 %q", i, line, want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 默认轮询间隔
+const DefaultPollInterval = time.Second
+
+// 设置轮询间隔：轮询的文件和目录按此间隔检查变化，使用 fsnotify 的文件也按此间隔确认事件是否正常送达
+func (fm *FileMonitor) SetPollInterval(interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("轮询间隔必须大于 0: %s", interval)
+	}
+
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	fm.pollEvery = interval
+	return nil
+}
+
+// 强制所有之后添加的文件和目录使用轮询（用于 NFS、CIFS、部分 FUSE 和容器 overlay 文件系统）
+func (fm *FileMonitor) SetForcePoll(force bool) {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	fm.forcePoll = force
+}
+
+// 轮询协程
+func (fm *FileMonitor) poll() {
+	for {
+		fm.mutex.RLock()
+		interval := fm.pollEvery
+		fm.mutex.RUnlock()
+
+		select {
+		case <-time.After(interval):
+			fm.pollOnce()
+		case <-fm.stopChan:
+			return
+		}
+	}
+}
+
+// 检查一次所有文件和轮询的目录
+func (fm *FileMonitor) pollOnce() {
+	fm.readMu.Lock()
+	defer fm.readMu.Unlock()
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	// 先检查目录再检查文件：轮转时重命名的旧文件在原路径切换到新文件之前出现，
+	// 此时仍能识别出它正在被原路径读取
+	for dir := range fm.polledDirs {
+		fm.pollDir(dir)
+	}
+
+	for _, monitoredFile := range fm.files {
+		if !monitoredFile.IsActive {
+			continue
+		}
+		if _, polled := fm.polledDirs[filepath.Dir(monitoredFile.Path)]; polled || monitoredFile.Polling {
+			fm.pollFile(monitoredFile)
+		} else {
+			fm.verifyEvents(monitoredFile)
+		}
+	}
+}
+
+// 轮询文件：读取新增内容，处理截断和轮转，并记录文件被删除的时间
+func (fm *FileMonitor) pollFile(monitoredFile *MonitoredFile) {
+	if _, err := os.Stat(monitoredFile.Path); err != nil {
+		if monitoredFile.RemovedAt.IsZero() {
+			monitoredFile.RemovedAt = time.Now()
+		}
+	} else {
+		monitoredFile.RemovedAt = time.Time{}
+	}
+	fm.checkFile(monitoredFile)
+}
+
+// 确认 fsnotify 事件正常送达：文件已有变化但超过一个轮询间隔仍没有收到事件时，改为轮询该文件
+func (fm *FileMonitor) verifyEvents(monitoredFile *MonitoredFile) {
+	info, err := os.Stat(monitoredFile.Path)
+	if err != nil || monitoredFile.handle == nil {
+		return
+	}
+
+	changed := info.Size() != monitoredFile.Size || !info.ModTime().Equal(monitoredFile.LastMod)
+	if current, err := monitoredFile.handle.Stat(); err == nil && !os.SameFile(info, current) {
+		changed = true
+	}
+	if !changed {
+		monitoredFile.staleSince = time.Time{}
+		return
+	}
+
+	// 第一次发现变化时事件可能还在路上，等到下一次轮询再判断
+	if monitoredFile.staleSince.IsZero() {
+		monitoredFile.staleSince = time.Now()
+		return
+	}
+
+	fmt.Printf("⚠️  %s 有变化但没有收到文件事件，改为每 %s 轮询一次\n", monitoredFile.Path, fm.pollEvery)
+	monitoredFile.Polling = true
+	monitoredFile.staleSince = time.Time{}
+	fm.checkFile(monitoredFile)
+}
+
+// 轮询目录：与上次轮询相比新出现的文件和子目录按新创建处理，每个路径只处理一次
+func (fm *FileMonitor) pollDir(dir string) {
+	if _, err := os.Stat(dir); err != nil {
+		// 目录已被删除，重新创建时由上级目录发现
+		delete(fm.polledDirs, dir)
+		return
+	}
+
+	seen := fm.polledDirs[dir]
+	current := listDir(dir)
+	fm.polledDirs[dir] = current
+	for name := range current {
+		if !seen[name] {
+			fm.discover(filepath.Join(dir, name))
+		}
+	}
+}
+
+// 目录中的文件名集合
+func listDir(dir string) map[string]bool {
+	names := make(map[string]bool)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return names
+	}
+	for _, entry := range entries {
+		names[entry.Name()] = true
+	}
+	return names
+}
+
+// 强制轮询指定文件
+func (fm *FileMonitor) PollFile(filePath string) error {
+	fm.readMu.Lock()
+	defer fm.readMu.Unlock()
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	if file, exists := fm.files[filePath]; exists {
+		file.Polling = true
+		return nil
+	}
+
+	return fmt.Errorf("文件未找到: %s", filePath)
+}
@@ -0,0 +1,85 @@
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 测试强制轮询：不使用 fsnotify，也能发现新文件、读取新增内容和处理轮转
+func TestFileMonitorForcePoll(t *testing.T) {
+	dir := t.TempDir()
+
+	fm, err := NewFileMonitor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(fm.Stop)
+	if err := fm.SetPollInterval(50 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := make(chan string, 100)
+	if _, err := fm.AddSource(FileSource{Pattern: filepath.Join(dir, "*.log"), Poll: true}, func(_, line string) {
+		lines <- line
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	fm.mutex.RLock()
+	watched := len(fm.watchedDirs)
+	fm.mutex.RUnlock()
+	if watched != 0 {
+		t.Fatalf("强制轮询时不应添加 fsnotify 监控: %v", fm.watchedDirs)
+	}
+
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "first\n")
+	expectLines(t, lines, "first")
+
+	appendFile(t, path, "second\n")
+	expectLines(t, lines, "second")
+
+	// rename + create 轮转：旧文件的剩余内容和新文件都只读取一次
+	appendFile(t, path, "before rotate\n")
+	if err := os.Rename(path, filepath.Join(dir, "app.1.log")); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "after rotate\n")
+	expectLines(t, lines, "before rotate", "after rotate")
+
+	select {
+	case line := <-lines:
+		t.Fatalf("重复读取: %q", line)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+// 测试收不到 fsnotify 事件时自动改为轮询
+func TestFileMonitorPollFallback(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "")
+
+	fm, lines := startMonitor(t, path)
+	if err := fm.SetPollInterval(50 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟网络文件系统：目录监控存在但不再送达事件
+	if err := fm.watcher.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	appendFile(t, path, "no event\n")
+	expectLines(t, lines, "no event")
+
+	files := fm.GetFiles()
+	if len(files) != 1 || !files[0].Polling {
+		t.Fatalf("文件应改为轮询: %+v", files)
+	}
+
+	appendFile(t, path, "polled\n")
+	expectLines(t, lines, "polled")
+}
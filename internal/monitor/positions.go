@@ -0,0 +1,160 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 文件读取位置（检查点）
+type Position struct {
+	Path      string    `json:"path"`
+	Device    uint64    `json:"device"`
+	Inode     uint64    `json:"inode"`
+	Offset    int64     `json:"offset"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// 读取位置存储：按路径 + inode 记录每个文件已处理到的位置，重启后从检查点继续
+type PositionStore struct {
+	file      string
+	positions map[string]*Position // path -> position
+	dirty     bool
+	mutex     sync.Mutex
+}
+
+// 默认检查点文件路径
+func DefaultPositionFile() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "aipipe", "positions.json")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".local", "state", "aipipe", "positions.json")
+}
+
+// 加载读取位置存储，文件不存在时返回空存储
+func LoadPositionStore(file string) (*PositionStore, error) {
+	if file == "" {
+		file = DefaultPositionFile()
+	}
+
+	ps := &PositionStore{
+		file:      file,
+		positions: make(map[string]*Position),
+	}
+
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return ps, nil
+	}
+	if err != nil {
+		return ps, fmt.Errorf("读取检查点文件失败: %w", err)
+	}
+
+	var positions []*Position
+	if err := json.Unmarshal(data, &positions); err != nil {
+		return ps, fmt.Errorf("解析检查点文件失败: %w", err)
+	}
+	for _, p := range positions {
+		if p.Path == "" {
+			continue
+		}
+		// 停止期间已删除的文件不再保留检查点
+		if _, err := os.Stat(p.Path); os.IsNotExist(err) {
+			ps.dirty = true
+			continue
+		}
+		ps.positions[p.Path] = p
+	}
+
+	return ps, nil
+}
+
+// 获取文件的读取位置，inode 或设备号不一致（文件已被轮转替换）时返回 false
+func (ps *PositionStore) Get(path string, device, inode uint64) (int64, bool) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	p, exists := ps.positions[path]
+	if !exists || p.Device != device || p.Inode != inode {
+		return 0, false
+	}
+	return p.Offset, true
+}
+
+// 删除文件的读取位置（文件已删除，停止监控）
+func (ps *PositionStore) Delete(path string) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	if _, exists := ps.positions[path]; exists {
+		delete(ps.positions, path)
+		ps.dirty = true
+	}
+}
+
+// 更新文件的读取位置
+func (ps *PositionStore) Set(path string, device, inode uint64, offset int64) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	p, exists := ps.positions[path]
+	if exists && p.Device == device && p.Inode == inode && p.Offset == offset {
+		return
+	}
+
+	ps.positions[path] = &Position{
+		Path:      path,
+		Device:    device,
+		Inode:     inode,
+		Offset:    offset,
+		UpdatedAt: time.Now(),
+	}
+	ps.dirty = true
+}
+
+// 保存检查点（先写临时文件再重命名，避免崩溃时写坏文件）
+func (ps *PositionStore) Save() error {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	if !ps.dirty {
+		return nil
+	}
+
+	positions := make([]*Position, 0, len(ps.positions))
+	for _, p := range ps.positions {
+		positions = append(positions, p)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		return positions[i].Path < positions[j].Path
+	})
+
+	data, err := json.MarshalIndent(positions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化检查点失败: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(ps.file), 0755); err != nil {
+		return fmt.Errorf("创建检查点目录失败: %w", err)
+	}
+
+	tmpFile := ps.file + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return fmt.Errorf("写入检查点文件失败: %w", err)
+	}
+	if err := os.Rename(tmpFile, ps.file); err != nil {
+		return fmt.Errorf("保存检查点文件失败: %w", err)
+	}
+
+	ps.dirty = false
+	return nil
+}
+
+// 获取检查点文件路径
+func (ps *PositionStore) File() string {
+	return ps.file
+}
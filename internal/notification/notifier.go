@@ -288,8 +288,9 @@ func (s *SystemNotifier) sendLinuxNotification(message *NotificationMessage) err
 	return cmd.Run()
 }
 
+// 没有 osascript 和 notify-send（如服务器上）时不启用，避免每次通知都报错
 func (s *SystemNotifier) IsEnabled() bool {
-	return s.enabled
+	return s.enabled && (s.isMacOS() || s.isLinux())
 }
 
 func (s *SystemNotifier) GetName() string {
@@ -0,0 +1,418 @@
+package pattern
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/config"
+)
+
+// 模板中的变量占位符
+const Wildcard = "<*>"
+
+// 变量类 token 的正则模式，匹配到的 token 在挖掘前被视为变量
+var variablePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`), // UUID
+	regexp.MustCompile(`^\d{1,3}(\.\d{1,3}){3}(:\d+)?$`),                                                // IPv4[:port]
+	regexp.MustCompile(`^0[xX][0-9a-fA-F]+$`),                                                           // 十六进制
+	regexp.MustCompile(`^[0-9a-fA-F]{16,}$`),                                                            // 长哈希
+	regexp.MustCompile(`^[-+]?\d+(\.\d+)?[a-zA-Z%µ]*$`),                                                 // 数字及带单位数字
+	regexp.MustCompile(`^[\d:.\-/TZ+,]*\d[\d:.\-/TZ+,]*$`),                                              // 日期时间
+}
+
+// 日志模板
+type Template struct {
+	ID        string    `json:"id"`         // 模板ID，创建后保持不变
+	Tokens    []string  `json:"tokens"`     // 模板 token 序列
+	Count     int64     `json:"count"`      // 匹配次数
+	FirstSeen time.Time `json:"first_seen"` // 首次出现时间
+	LastSeen  time.Time `json:"last_seen"`  // 最后出现时间
+	Examples  []string  `json:"examples"`   // 示例日志行
+	Path      []string  `json:"path"`       // 在前缀树中的路由路径
+}
+
+// 模板文本
+func (t *Template) String() string {
+	return strings.Join(t.Tokens, " ")
+}
+
+// 匹配结果
+type MatchResult struct {
+	TemplateID string   `json:"template_id"` // 模板ID
+	Template   string   `json:"template"`    // 模板文本
+	Params     []string `json:"params"`      // 变量参数
+	IsNew      bool     `json:"is_new"`      // 是否新模板
+	MaskedID   string   `json:"masked_id"`   // 日志行只替换变量 token 后的ID，其余 token 完全相同的日志才相同
+}
+
+// 前缀树节点
+type treeNode struct {
+	children  map[string]*treeNode
+	templates []*Template
+}
+
+func newTreeNode() *treeNode {
+	return &treeNode{children: make(map[string]*treeNode)}
+}
+
+// 模板挖掘器（Drain 算法）
+type TemplateMiner struct {
+	config    config.PatternConfig
+	root      *treeNode
+	templates map[string]*Template
+	stateFile string
+	dirty     bool
+	mutex     sync.Mutex
+}
+
+// 创建新的模板挖掘器
+func NewTemplateMiner(cfg config.PatternConfig) *TemplateMiner {
+	if cfg.Depth < 3 {
+		cfg.Depth = 3
+	}
+	if cfg.SimilarityThreshold <= 0 {
+		cfg.SimilarityThreshold = 0.4
+	}
+	if cfg.MaxChildren <= 0 {
+		cfg.MaxChildren = 100
+	}
+	if cfg.MaxExamples <= 0 {
+		cfg.MaxExamples = 3
+	}
+
+	stateFile := cfg.StateFile
+	if stateFile == "" {
+		stateFile = DefaultStateFile()
+	}
+
+	return &TemplateMiner{
+		config:    cfg,
+		root:      newTreeNode(),
+		templates: make(map[string]*Template),
+		stateFile: stateFile,
+	}
+}
+
+// 默认模板持久化文件路径
+func DefaultStateFile() string {
+	return filepath.Join(os.Getenv("HOME"), ".config", "aipipe-patterns.json")
+}
+
+// 加载模板挖掘器（从持久化文件恢复模板树）
+func LoadTemplateMiner(cfg config.PatternConfig) (*TemplateMiner, error) {
+	tm := NewTemplateMiner(cfg)
+
+	data, err := os.ReadFile(tm.stateFile)
+	if os.IsNotExist(err) {
+		return tm, nil
+	}
+	if err != nil {
+		return tm, fmt.Errorf("读取模板文件失败: %w", err)
+	}
+
+	var templates []*Template
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return tm, fmt.Errorf("解析模板文件失败: %w", err)
+	}
+
+	for _, t := range templates {
+		if t.ID == "" || len(t.Tokens) == 0 {
+			continue
+		}
+		tm.insert(t)
+	}
+
+	return tm, nil
+}
+
+// 匹配日志行，必要时创建或泛化模板
+func (tm *TemplateMiner) Match(line string) *MatchResult {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	tokens := strings.Fields(line)
+	masked := maskTokens(tokens)
+	now := time.Now()
+
+	leaf := tm.route(masked, false)
+	template, isNew := tm.bestMatch(leaf, masked), false
+	if template == nil {
+		template = &Template{
+			ID:        generateTemplateID(masked),
+			Tokens:    masked,
+			FirstSeen: now,
+			Path:      tm.routePath(masked),
+		}
+		// 极少数情况下初始模板相同但路由不同，追加序号保证ID唯一
+		for i := 1; tm.templates[template.ID] != nil; i++ {
+			template.ID = fmt.Sprintf("%s-%d", generateTemplateID(masked), i)
+		}
+		tm.insert(template)
+		isNew = true
+	} else {
+		template.Tokens = mergeTokens(template.Tokens, masked)
+	}
+
+	template.Count++
+	template.LastSeen = now
+	if len(template.Examples) < tm.config.MaxExamples {
+		template.Examples = append(template.Examples, line)
+	}
+	tm.dirty = true
+
+	return &MatchResult{
+		TemplateID: template.ID,
+		Template:   template.String(),
+		Params:     extractParams(template.Tokens, tokens),
+		IsNew:      isNew,
+		MaskedID:   generateTemplateID(masked),
+	}
+}
+
+// 计算路由路径：token 数量 + 前若干个 token
+func (tm *TemplateMiner) routePath(tokens []string) []string {
+	path := []string{strconv.Itoa(len(tokens))}
+	for i := 0; i < tm.config.Depth-2 && i < len(tokens); i++ {
+		token := tokens[i]
+		if hasDigit(token) {
+			token = Wildcard
+		}
+		path = append(path, token)
+	}
+	return path
+}
+
+// 沿路由路径找到叶子节点，create 为 true 时创建缺失节点
+func (tm *TemplateMiner) route(tokens []string, create bool) *treeNode {
+	return tm.walk(tm.routePath(tokens), create)
+}
+
+func (tm *TemplateMiner) walk(path []string, create bool) *treeNode {
+	node := tm.root
+	for depth, key := range path {
+		child, ok := node.children[key]
+		if !ok {
+			if create && (depth == 0 || len(node.children) < tm.config.MaxChildren) {
+				child = newTreeNode()
+				node.children[key] = child
+			} else if child, ok = node.children[Wildcard]; !ok {
+				// 子节点过多时统一归入通配节点
+				if !create {
+					return nil
+				}
+				child = newTreeNode()
+				node.children[Wildcard] = child
+			}
+		}
+		node = child
+	}
+	return node
+}
+
+// 将模板插入前缀树
+func (tm *TemplateMiner) insert(t *Template) {
+	if len(t.Path) == 0 {
+		t.Path = tm.routePath(t.Tokens)
+	}
+	leaf := tm.walk(t.Path, true)
+	leaf.templates = append(leaf.templates, t)
+	tm.templates[t.ID] = t
+}
+
+// 在叶子节点中找到最相似的模板
+func (tm *TemplateMiner) bestMatch(leaf *treeNode, tokens []string) *Template {
+	if leaf == nil {
+		return nil
+	}
+
+	var best *Template
+	bestSim, bestParams := -1.0, -1
+	for _, t := range leaf.templates {
+		sim, params := similarity(t.Tokens, tokens)
+		if sim > bestSim || (sim == bestSim && params > bestParams) {
+			best, bestSim, bestParams = t, sim, params
+		}
+	}
+
+	if best == nil || bestSim < tm.config.SimilarityThreshold {
+		return nil
+	}
+	return best
+}
+
+// 计算模板与日志 token 的相似度，返回相似度和通配符数量
+func similarity(template, tokens []string) (float64, int) {
+	if len(template) != len(tokens) || len(tokens) == 0 {
+		return 0, 0
+	}
+
+	same, params := 0, 0
+	for i, token := range template {
+		if token == tokens[i] {
+			same++
+		} else if token == Wildcard {
+			params++
+		}
+	}
+	return float64(same) / float64(len(tokens)), params
+}
+
+// 泛化模板：不同位置替换为通配符
+func mergeTokens(template, tokens []string) []string {
+	merged := make([]string, len(template))
+	for i, token := range template {
+		if token == tokens[i] {
+			merged[i] = token
+		} else {
+			merged[i] = Wildcard
+		}
+	}
+	return merged
+}
+
+// 预处理：将明显的变量 token 替换为通配符
+func maskTokens(tokens []string) []string {
+	masked := make([]string, len(tokens))
+	for i, token := range tokens {
+		masked[i] = token
+		for _, p := range variablePatterns {
+			if p.MatchString(token) {
+				masked[i] = Wildcard
+				break
+			}
+		}
+	}
+	return masked
+}
+
+// 提取通配符位置对应的原始参数
+func extractParams(template, tokens []string) []string {
+	params := make([]string, 0)
+	for i, token := range template {
+		if token == Wildcard && i < len(tokens) {
+			params = append(params, tokens[i])
+		}
+	}
+	return params
+}
+
+// 生成模板ID
+func generateTemplateID(tokens []string) string {
+	hash := sha256.Sum256([]byte(strings.Join(tokens, " ")))
+	return fmt.Sprintf("%x", hash[:6])
+}
+
+func hasDigit(s string) bool {
+	return strings.ContainsAny(s, "0123456789")
+}
+
+// 根据ID获取模板
+func (tm *TemplateMiner) GetTemplate(id string) (*Template, bool) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	t, exists := tm.templates[id]
+	if !exists {
+		return nil, false
+	}
+	copied := *t
+	return &copied, true
+}
+
+// 获取所有模板（按匹配次数降序）
+func (tm *TemplateMiner) GetTemplates() []Template {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	templates := make([]Template, 0, len(tm.templates))
+	for _, t := range tm.templates {
+		templates = append(templates, *t)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		if templates[i].Count != templates[j].Count {
+			return templates[i].Count > templates[j].Count
+		}
+		return templates[i].ID < templates[j].ID
+	})
+	return templates
+}
+
+// 清空所有模板
+func (tm *TemplateMiner) Clear() {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	tm.root = newTreeNode()
+	tm.templates = make(map[string]*Template)
+	tm.dirty = true
+}
+
+// 持久化模板到文件（原子写入）
+func (tm *TemplateMiner) Save() error {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	if !tm.dirty {
+		return nil
+	}
+
+	templates := make([]*Template, 0, len(tm.templates))
+	for _, t := range tm.templates {
+		templates = append(templates, t)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].ID < templates[j].ID
+	})
+
+	data, err := json.MarshalIndent(templates, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化模板失败: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(tm.stateFile), 0755); err != nil {
+		return fmt.Errorf("创建模板目录失败: %w", err)
+	}
+
+	// 在同一目录创建唯一的临时文件，同步到磁盘后再重命名，多个进程同时保存时不会互相覆盖临时文件
+	tmp, err := os.CreateTemp(filepath.Dir(tm.stateFile), "."+filepath.Base(tm.stateFile)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	tmpFile := tmp.Name()
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("写入模板文件失败: %w", err)
+	}
+	if err := os.Rename(tmpFile, tm.stateFile); err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("保存模板文件失败: %w", err)
+	}
+
+	tm.dirty = false
+	return nil
+}
+
+// 获取持久化文件路径
+func (tm *TemplateMiner) StateFile() string {
+	return tm.stateFile
+}
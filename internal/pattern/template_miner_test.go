@@ -0,0 +1,93 @@
+package pattern
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/xurenlu/aipipe/internal/config"
+)
+
+func newTestMiner(t *testing.T) *TemplateMiner {
+	return NewTemplateMiner(config.PatternConfig{
+		Depth:               4,
+		SimilarityThreshold: 0.4,
+		StateFile:           filepath.Join(t.TempDir(), "patterns.json"),
+	})
+}
+
+// 测试仅变量不同的日志归入同一模板
+func TestTemplateMinerMatch(t *testing.T) {
+	miner := newTestMiner(t)
+
+	first := miner.Match("Connection to 10.0.0.12:5432 timed out after 3012ms")
+	second := miner.Match("Connection to 10.0.0.13:6379 timed out after 12ms")
+
+	if !first.IsNew || second.IsNew {
+		t.Fatalf("期望第一行创建模板、第二行复用模板: %v %v", first.IsNew, second.IsNew)
+	}
+	if first.TemplateID != second.TemplateID {
+		t.Fatalf("模板ID不一致: %s != %s", first.TemplateID, second.TemplateID)
+	}
+	if second.Template != "Connection to <*> timed out after <*>" {
+		t.Errorf("模板错误: %s", second.Template)
+	}
+	if len(second.Params) != 2 || second.Params[0] != "10.0.0.13:6379" || second.Params[1] != "12ms" {
+		t.Errorf("参数错误: %v", second.Params)
+	}
+
+	other := miner.Match("Disk /dev/sda1 is almost full")
+	if other.TemplateID == first.TemplateID {
+		t.Error("不同日志不应归入同一模板")
+	}
+}
+
+// 测试模板泛化后ID保持不变，且持久化后可以恢复
+func TestTemplateMinerPersistence(t *testing.T) {
+	miner := newTestMiner(t)
+
+	id := miner.Match("order created for user alice").TemplateID
+	if got := miner.Match("order created for user bob").TemplateID; got != id {
+		t.Fatalf("模板泛化后ID变化: %s != %s", got, id)
+	}
+
+	if err := miner.Save(); err != nil {
+		t.Fatalf("保存模板失败: %v", err)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(miner.StateFile()), "*.tmp")); len(leftovers) != 0 {
+		t.Errorf("保存后不应留下临时文件: %v", leftovers)
+	}
+
+	loaded, err := LoadTemplateMiner(miner.config)
+	if err != nil {
+		t.Fatalf("加载模板失败: %v", err)
+	}
+
+	result := loaded.Match("order created for user carol")
+	if result.IsNew || result.TemplateID != id {
+		t.Errorf("恢复后应匹配已有模板 %s, 实际: %s (new=%v)", id, result.TemplateID, result.IsNew)
+	}
+
+	templates := loaded.GetTemplates()
+	if len(templates) != 1 || templates[0].Count != 3 {
+		t.Errorf("模板统计错误: %+v", templates)
+	}
+}
+
+// 测试同一模板下的日志只有变量不同时掩码ID才相同
+func TestTemplateMinerMaskedID(t *testing.T) {
+	miner := newTestMiner(t)
+
+	failed := miner.Match("Payment for order 1 failed")
+	succeeded := miner.Match("Payment for order 2 succeeded")
+	again := miner.Match("Payment for order 3 failed")
+
+	if failed.TemplateID != succeeded.TemplateID {
+		t.Fatalf("期望归入同一模板: %s != %s", failed.TemplateID, succeeded.TemplateID)
+	}
+	if failed.MaskedID == succeeded.MaskedID {
+		t.Error("非变量 token 不同的日志掩码ID不应相同")
+	}
+	if failed.MaskedID != again.MaskedID {
+		t.Error("只有变量不同的日志掩码ID应相同")
+	}
+}
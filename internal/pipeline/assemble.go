@@ -0,0 +1,164 @@
+package pipeline
+
+import (
+	"sync"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/exception"
+	"github.com/xurenlu/aipipe/internal/record"
+)
+
+// 默认空闲时间：数据源超过这个时间没有新的行时输出暂存的多行事件
+const DefaultAssembleIdle = time.Second
+
+// 多行事件组装：同一数据源、同一来源中堆栈、Traceback 等续行合并到前一条日志后再输出。
+// 事件是否结束要等到下一条日志才能确定，数据源空闲超过 idle 时也输出暂存的事件
+type EventAssembler struct {
+	maxLines int
+	idle     time.Duration
+	emit     func(Entry)
+	sources  map[string]*assemblyRun // 数据源和来源 -> 正在组装的事件
+	closed   bool
+	mutex    sync.Mutex
+}
+
+// 单个数据源正在组装的事件，持有 mutex 时输出以保证同一数据源的顺序
+type assemblyRun struct {
+	assembler *exception.Assembler
+	entry     Entry  // 事件第一行的日志，输出时替换为整个事件
+	header    string // 事件第一行记录的头部，输出时加在事件之前
+	last      time.Time
+	mutex     sync.Mutex
+}
+
+// 创建多行事件组装，emit 接收组装好的事件，可能在多个协程中调用，但同一数据源的事件依次调用
+func NewEventAssembler(maxLines int, idle time.Duration, emit func(Entry)) *EventAssembler {
+	if idle <= 0 {
+		idle = DefaultAssembleIdle
+	}
+	return &EventAssembler{
+		maxLines: maxLines,
+		idle:     idle,
+		emit:     emit,
+		sources:  make(map[string]*assemblyRun),
+	}
+}
+
+// 加入一行日志：续行合并到暂存的事件，新事件开始时输出上一个事件；关闭后直接输出
+func (a *EventAssembler) Add(entry Entry, now time.Time) {
+	a.add(entry, "", now)
+}
+
+// 加入数据源的一条记录：按日志内容而不是渲染后的行判断续行（渲染后每行都以时间开头），
+// 输出的事件以第一条记录的头部开头
+func (a *EventAssembler) AddRecord(rec *record.Record, now time.Time) {
+	entry := RecordEntry(rec)
+	entry.Line = rec.Message
+	a.add(entry, rec.Header(), now)
+}
+
+func (a *EventAssembler) add(entry Entry, header string, now time.Time) {
+	a.mutex.Lock()
+	if a.closed {
+		a.mutex.Unlock()
+		entry.Line = header + entry.Line
+		a.emit(entry)
+		return
+	}
+	// 同一数据源可能包含多个文件或输出流，不同来源的行不能互相合并
+	key := entry.Source + "\x00" + entry.Origin
+	run, exists := a.sources[key]
+	if !exists {
+		run = &assemblyRun{assembler: exception.NewAssembler(a.maxLines)}
+		a.sources[key] = run
+	}
+	a.mutex.Unlock()
+
+	run.mutex.Lock()
+	defer run.mutex.Unlock()
+
+	pending := run.assembler.Pending()
+	event, ok := run.assembler.Add(entry.Line)
+	if ok {
+		run.emitEvent(a.emit, event)
+	}
+	if ok || !pending {
+		run.entry, run.header = entry, header
+	}
+	run.last = now
+}
+
+// 输出空闲超过 idle 的数据源暂存的事件，需要定期调用
+func (a *EventAssembler) Flush(now time.Time) {
+	for _, run := range a.runs() {
+		run.mutex.Lock()
+		if now.Sub(run.last) >= a.idle {
+			run.flush(a.emit)
+		}
+		run.mutex.Unlock()
+	}
+}
+
+// 定期输出空闲数据源暂存的事件，直到 stop 关闭
+func (a *EventAssembler) FlushEvery(stop <-chan struct{}) {
+	ticker := time.NewTicker(a.idle / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			a.Flush(now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// 输出所有暂存的事件，之后加入的日志不再组装
+func (a *EventAssembler) Close() {
+	a.mutex.Lock()
+	a.closed = true
+	a.mutex.Unlock()
+
+	for _, run := range a.runs() {
+		run.mutex.Lock()
+		run.flush(a.emit)
+		run.mutex.Unlock()
+	}
+}
+
+func (a *EventAssembler) runs() []*assemblyRun {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	runs := make([]*assemblyRun, 0, len(a.sources))
+	for _, run := range a.sources {
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// 输出暂存的事件，需持有 mutex
+func (r *assemblyRun) flush(emit func(Entry)) {
+	if event, ok := r.assembler.Flush(); ok {
+		r.emitEvent(emit, event)
+	}
+}
+
+func (r *assemblyRun) emitEvent(emit func(Entry), event string) {
+	entry := r.entry
+	entry.Line = r.header + event
+	emit(entry)
+}
+
+// 由数据源的记录创建日志，元数据随日志一起分析
+func RecordEntry(rec *record.Record) Entry {
+	return Entry{
+		Source:   rec.Source,
+		Priority: rec.Priority,
+		Format:   rec.Format,
+		Line:     rec.Line(),
+		Labels:   rec.Labels,
+		Origin:   rec.Origin,
+	}
+}
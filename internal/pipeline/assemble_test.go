@@ -0,0 +1,83 @@
+package pipeline
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventAssemblerPerSource(t *testing.T) {
+	var got collected
+	a := NewEventAssembler(0, time.Second, got.add)
+
+	now := time.Now()
+	a.Add(Entry{Source: "api", Priority: 1, Line: "2026-10-19 10:00:00 ERROR request failed"}, now)
+	a.Add(Entry{Source: "worker", Line: "2026-10-19 10:00:00 INFO job started"}, now)
+	a.Add(Entry{Source: "api", Priority: 2, Line: "java.lang.IllegalStateException: boom"}, now)
+	a.Add(Entry{Source: "api", Line: "\tat com.example.Api.handle(Api.java:42)"}, now)
+	a.Add(Entry{Source: "worker", Line: "2026-10-19 10:00:01 INFO job done"}, now)
+	a.Add(Entry{Source: "api", Line: "2026-10-19 10:00:01 INFO recovered"}, now)
+	a.Close()
+
+	if len(got.entries) != 4 {
+		t.Fatalf("事件数 = %d, 期望 4: %s", len(got.entries), got.String())
+	}
+	// Close 时各数据源的输出顺序不确定，只检查前两个事件
+	if got.entries[0].Source != "worker" || got.entries[1].Source != "api" {
+		t.Fatalf("输出顺序不符: %s", got.String())
+	}
+	if got.entries[1].Line != "2026-10-19 10:00:00 ERROR request failed\njava.lang.IllegalStateException: boom\n\tat com.example.Api.handle(Api.java:42)" {
+		t.Errorf("续行未合并: %q", got.entries[1].Line)
+	}
+	// 事件保留第一行的元数据
+	if got.entries[1].Priority != 1 {
+		t.Errorf("优先级 = %d, 期望 1", got.entries[1].Priority)
+	}
+}
+
+func TestEventAssemblerIdleFlush(t *testing.T) {
+	var got collected
+	a := NewEventAssembler(0, time.Second, got.add)
+
+	now := time.Now()
+	a.Add(Entry{Source: "app", Line: "panic: runtime error"}, now)
+	a.Add(Entry{Source: "app", Line: "goroutine 1 [running]:"}, now.Add(100*time.Millisecond))
+	a.Flush(now.Add(900 * time.Millisecond))
+	if len(got.entries) != 0 {
+		t.Fatalf("未空闲不应输出: %s", got.String())
+	}
+
+	a.Flush(now.Add(1100 * time.Millisecond))
+	if len(got.entries) != 1 || got.entries[0].Line != "panic: runtime error\ngoroutine 1 [running]:" {
+		t.Fatalf("空闲后应输出暂存的事件: %s", got.String())
+	}
+
+	// 关闭后直接输出
+	a.Close()
+	a.Add(Entry{Source: "app", Line: "late"}, now.Add(2*time.Second))
+	if len(got.entries) != 2 || got.entries[1].Line != "late" {
+		t.Errorf("关闭后应直接输出: %s", got.String())
+	}
+}
+
+func TestEventAssemblerPerOrigin(t *testing.T) {
+	var got collected
+	a := NewEventAssembler(0, time.Second, got.add)
+
+	// 同一数据源中的两个文件交替写入，续行只合并到同一文件的事件
+	now := time.Now()
+	a.Add(Entry{Source: "app", Origin: "/var/log/a.log", Line: "2026-10-19 10:00:00 ERROR a failed"}, now)
+	a.Add(Entry{Source: "app", Origin: "/var/log/b.log", Line: "2026-10-19 10:00:00 ERROR b failed"}, now)
+	a.Add(Entry{Source: "app", Origin: "/var/log/a.log", Line: "\tat com.example.A.run(A.java:1)"}, now)
+	a.Add(Entry{Source: "app", Origin: "/var/log/b.log", Line: "\tat com.example.B.run(B.java:2)"}, now)
+	a.Close()
+
+	lines := map[string]string{}
+	for _, entry := range got.entries {
+		lines[entry.Origin] = entry.Line
+	}
+	if len(got.entries) != 2 ||
+		lines["/var/log/a.log"] != "2026-10-19 10:00:00 ERROR a failed\n\tat com.example.A.run(A.java:1)" ||
+		lines["/var/log/b.log"] != "2026-10-19 10:00:00 ERROR b failed\n\tat com.example.B.run(B.java:2)" {
+		t.Errorf("不同来源的行不应互相合并: %q", lines)
+	}
+}
@@ -0,0 +1,168 @@
+package pipeline
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/rule"
+)
+
+// 重复日志的判断方式
+const (
+	DedupeExact    = "exact"    // 内容完全相同
+	DedupeTemplate = "template" // 只有变量不同（模板挖掘的掩码ID相同）
+)
+
+// 默认折叠窗口
+const DefaultDedupeWindow = 2 * time.Second
+
+// 重复日志折叠：同一数据源中连续重复的日志折叠为一条，类似 syslog 的 "last message repeated N times"。
+// 每个数据源暂存最近一条日志，出现不同的日志、超过折叠窗口或关闭时才输出，输出的日志带有重复次数和时间范围
+type Deduper struct {
+	window  time.Duration
+	match   string
+	emit    func(Entry)
+	sources map[string]*dedupeRun
+	closed  bool
+	mutex   sync.Mutex
+}
+
+// 单个数据源暂存的日志，持有 mutex 时输出以保证同一数据源的顺序
+type dedupeRun struct {
+	entry Entry
+	key   string
+	held  bool
+	mutex sync.Mutex
+}
+
+// 创建重复日志折叠，emit 接收折叠后的日志，可能在多个协程中调用，但同一数据源的日志依次调用
+func NewDeduper(window time.Duration, match string, emit func(Entry)) (*Deduper, error) {
+	if window <= 0 {
+		window = DefaultDedupeWindow
+	}
+	switch match {
+	case "":
+		match = DedupeExact
+	case DedupeExact, DedupeTemplate:
+	default:
+		return nil, fmt.Errorf("不支持的重复判断方式: %s (可选: exact, template)", match)
+	}
+
+	return &Deduper{
+		window:  window,
+		match:   match,
+		emit:    emit,
+		sources: make(map[string]*dedupeRun),
+	}, nil
+}
+
+// 折叠窗口
+func (d *Deduper) Window() time.Duration {
+	return d.window
+}
+
+// 加入一条日志：与暂存的日志重复时只计数，否则输出暂存的日志并暂存这一条；关闭后直接输出。
+// alert 规则匹配的日志不参与折叠，输出暂存的日志后直接输出，不会被并入之前的日志
+func (d *Deduper) Add(entry Entry, now time.Time) {
+	d.mutex.Lock()
+	if d.closed {
+		d.mutex.Unlock()
+		d.emit(entry)
+		return
+	}
+	run, exists := d.sources[entry.Source]
+	if !exists {
+		run = &dedupeRun{}
+		d.sources[entry.Source] = run
+	}
+	d.mutex.Unlock()
+
+	key := entry.Line
+	if d.match == DedupeTemplate && entry.Template != nil {
+		// 折叠后只保留第一条的内容，按掩码ID而不是聚类模板判断，措辞不同的日志不会被合并
+		key = entry.Template.MaskedID
+	}
+
+	run.mutex.Lock()
+	defer run.mutex.Unlock()
+
+	if entry.Rule != nil && entry.Rule.Action == rule.ActionAlert {
+		if run.held {
+			d.emit(run.entry)
+			run.held = false
+		}
+		d.emit(entry)
+		return
+	}
+
+	if run.held && run.key == key && now.Sub(run.entry.FirstSeen) < d.window {
+		run.entry.Repeats++
+		run.entry.LastSeen = now
+		return
+	}
+
+	if run.held {
+		d.emit(run.entry)
+	}
+	entry.Repeats = 1
+	entry.FirstSeen = now
+	entry.LastSeen = now
+	run.entry = entry
+	run.key = key
+	run.held = true
+}
+
+// 输出暂存超过折叠窗口的日志，需要定期调用
+func (d *Deduper) Flush(now time.Time) {
+	for _, run := range d.runs() {
+		run.mutex.Lock()
+		if run.held && now.Sub(run.entry.FirstSeen) >= d.window {
+			d.emit(run.entry)
+			run.held = false
+		}
+		run.mutex.Unlock()
+	}
+}
+
+// 定期输出暂存超过折叠窗口的日志，直到 stop 关闭
+func (d *Deduper) FlushEvery(stop <-chan struct{}) {
+	ticker := time.NewTicker(d.window / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			d.Flush(now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// 输出所有暂存的日志，之后加入的日志不再折叠
+func (d *Deduper) Close() {
+	d.mutex.Lock()
+	d.closed = true
+	d.mutex.Unlock()
+
+	for _, run := range d.runs() {
+		run.mutex.Lock()
+		if run.held {
+			d.emit(run.entry)
+			run.held = false
+		}
+		run.mutex.Unlock()
+	}
+}
+
+func (d *Deduper) runs() []*dedupeRun {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	runs := make([]*dedupeRun, 0, len(d.sources))
+	for _, run := range d.sources {
+		runs = append(runs, run)
+	}
+	return runs
+}
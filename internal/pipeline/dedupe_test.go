@@ -0,0 +1,146 @@
+package pipeline
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/pattern"
+	"github.com/xurenlu/aipipe/internal/rule"
+)
+
+type collected struct {
+	mutex   sync.Mutex
+	entries []Entry
+}
+
+func (c *collected) add(entry Entry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries = append(c.entries, entry)
+}
+
+func (c *collected) String() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var s []string
+	for _, entry := range c.entries {
+		s = append(s, fmt.Sprintf("%s:%s x%d", entry.Source, entry.Line, entry.Repeats))
+	}
+	return fmt.Sprint(s)
+}
+
+func TestDeduperCollapsesConsecutive(t *testing.T) {
+	var got collected
+	d, err := NewDeduper(time.Minute, DedupeExact, got.add)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i, line := range []string{"a", "a", "a", "b", "a", "a"} {
+		d.Add(Entry{Source: "app", Line: line}, now.Add(time.Duration(i)*time.Second))
+	}
+	// 其他数据源的日志不打断折叠
+	d.Add(Entry{Source: "db", Line: "a"}, now.Add(time.Second))
+	d.Add(Entry{Source: "app", Line: "c"}, now.Add(7*time.Second))
+	d.Add(Entry{Source: "db", Line: "b"}, now.Add(8*time.Second))
+
+	want := "[app:a x3 app:b x1 app:a x2 db:a x1]"
+	if got.String() != want {
+		t.Errorf("输出 %s, 期望 %s", got.String(), want)
+	}
+	first := got.entries[0]
+	if first.LastSeen.Sub(first.FirstSeen) != 2*time.Second {
+		t.Errorf("时间范围 %s - %s", first.FirstSeen, first.LastSeen)
+	}
+
+	// 关闭时输出暂存的日志，之后的日志直接输出
+	d.Close()
+	d.Add(Entry{Source: "app", Line: "late"}, now)
+	if len(got.entries) != 7 {
+		t.Errorf("关闭后的日志应直接输出，共 %d 条", len(got.entries))
+	}
+}
+
+func TestDeduperTemplate(t *testing.T) {
+	var got collected
+	d, err := NewDeduper(time.Minute, DedupeTemplate, got.add)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refused := &pattern.MatchResult{TemplateID: "t1", MaskedID: "m1"}
+	now := time.Now()
+	d.Add(Entry{Source: "app", Line: "connection refused to 10.0.0.1:5432", Template: refused}, now)
+	d.Add(Entry{Source: "app", Line: "connection refused to 10.0.0.2:5432", Template: refused}, now)
+	// 同一聚类模板但掩码ID不同
+	d.Add(Entry{Source: "app", Line: "connection reset by 10.0.0.2:5432", Template: &pattern.MatchResult{TemplateID: "t1", MaskedID: "m2"}}, now)
+	// 没有模板时按内容判断
+	d.Add(Entry{Source: "app", Line: "disk full"}, now)
+	d.Add(Entry{Source: "app", Line: "disk full"}, now)
+	d.Close()
+
+	want := "[app:connection refused to 10.0.0.1:5432 x2 app:connection reset by 10.0.0.2:5432 x1 app:disk full x2]"
+	if got.String() != want {
+		t.Errorf("输出 %s, 期望 %s", got.String(), want)
+	}
+}
+
+func TestDeduperWindow(t *testing.T) {
+	var got collected
+	d, err := NewDeduper(time.Second, DedupeExact, got.add)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	d.Add(Entry{Source: "app", Line: "a"}, now)
+	d.Add(Entry{Source: "app", Line: "a"}, now.Add(500*time.Millisecond))
+	d.Flush(now.Add(900 * time.Millisecond))
+	if len(got.entries) != 0 {
+		t.Fatalf("未超过折叠窗口不应输出: %s", got.String())
+	}
+
+	// 超过窗口后输出，之后的重复日志重新开始折叠
+	d.Flush(now.Add(time.Second))
+	d.Add(Entry{Source: "app", Line: "a"}, now.Add(1100*time.Millisecond))
+	d.Add(Entry{Source: "app", Line: "a"}, now.Add(2500*time.Millisecond))
+	d.Close()
+
+	want := "[app:a x2 app:a x1 app:a x1]"
+	if got.String() != want {
+		t.Errorf("输出 %s, 期望 %s", got.String(), want)
+	}
+}
+
+func TestDeduperAlertNotFolded(t *testing.T) {
+	var got collected
+	d, err := NewDeduper(time.Minute, DedupeTemplate, got.add)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 掩码ID相同，但第二条匹配了 alert 规则（如 latency_ms > 2000 的条件），不能并入第一条
+	slow := &pattern.MatchResult{TemplateID: "t1", MaskedID: "m1"}
+	alert := &rule.FilterResult{Rule: config.FilterRule{ID: "slow"}, Action: rule.ActionAlert}
+	now := time.Now()
+	d.Add(Entry{Source: "app", Line: "latency_ms=120", Template: slow}, now)
+	d.Add(Entry{Source: "app", Line: "latency_ms=2500", Template: slow, Rule: alert}, now)
+	d.Add(Entry{Source: "app", Line: "latency_ms=130", Template: slow}, now)
+	d.Add(Entry{Source: "app", Line: "latency_ms=140", Template: slow}, now)
+	d.Close()
+
+	want := "[app:latency_ms=120 x1 app:latency_ms=2500 x0 app:latency_ms=130 x2]"
+	if got.String() != want {
+		t.Errorf("输出 %s, 期望 %s", got.String(), want)
+	}
+}
+
+func TestNewDeduperInvalidMatch(t *testing.T) {
+	if _, err := NewDeduper(time.Second, "fuzzy", func(Entry) {}); err == nil {
+		t.Error("未知的重复判断方式应返回错误")
+	}
+}
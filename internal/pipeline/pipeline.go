@@ -0,0 +1,296 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/config"
+)
+
+// 默认队列容量
+const DefaultQueueSize = 1000
+
+// 处理一条日志（如 AI 分析），在工作协程中并发调用
+type Processor func(ctx context.Context, entry Entry) (interface{}, error)
+
+// 接收处理结果（如输出到终端、发送通知），在单个协程中调用；同一数据源的结果按入队顺序送达
+type Sink func(Result)
+
+// 处理结果
+type Result struct {
+	Entry Entry
+	Value interface{}   // Processor 的返回值
+	Err   error         // Processor 返回的错误
+	Wait  time.Duration // 在队列中等待的时间
+}
+
+// 流水线配置
+type Config struct {
+	Workers       int           // 工作协程数
+	QueueSize     int           // 队列容量
+	JobTimeout    time.Duration // 单条日志的最长处理时间，0 表示不限制
+	Overflow      string        // 队列满时的策略
+	QueueTimeout  time.Duration // block 策略下的最长等待时间
+	SpillDir      string        // spill 策略的溢写目录
+	SpillMaxBytes int64         // 溢写文件上限
+}
+
+// 根据全局配置生成流水线配置：工作协程数、队列容量和单条超时取 worker_pool，
+// 启用并发控制时工作协程数不超过 concurrency.max_concurrency，队列容量以 concurrency.backpressure_limit 为准
+func ConfigFrom(cfg *config.Config) Config {
+	c := Config{
+		Workers:   1,
+		QueueSize: DefaultQueueSize,
+		Overflow:  OverflowBlock,
+	}
+	if cfg.WorkerPool.Enabled {
+		if cfg.WorkerPool.MaxWorkers > 0 {
+			c.Workers = cfg.WorkerPool.MaxWorkers
+		}
+		if cfg.WorkerPool.QueueSize > 0 {
+			c.QueueSize = cfg.WorkerPool.QueueSize
+		}
+		c.JobTimeout = cfg.WorkerPool.Timeout
+	}
+
+	if cfg.Concurrency.Enabled {
+		if cfg.Concurrency.MaxConcurrency > 0 && c.Workers > cfg.Concurrency.MaxConcurrency {
+			c.Workers = cfg.Concurrency.MaxConcurrency
+		}
+		if cfg.Concurrency.BackpressureLimit > 0 {
+			c.QueueSize = cfg.Concurrency.BackpressureLimit
+		}
+		if cfg.Concurrency.OverflowPolicy != "" {
+			c.Overflow = cfg.Concurrency.OverflowPolicy
+		}
+		c.QueueTimeout = cfg.Concurrency.QueueTimeout
+		c.SpillDir = cfg.Concurrency.SpillDir
+		c.SpillMaxBytes = cfg.Concurrency.SpillMaxBytes
+	}
+	return c
+}
+
+// 流水线统计
+type Stats struct {
+	QueueStats
+	Workers   int    `json:"workers"`
+	InFlight  int64  `json:"in_flight"` // 正在处理的日志数
+	Processed uint64 `json:"processed"` // 已处理的日志数
+	Failed    uint64 `json:"failed"`    // 处理出错的日志数
+}
+
+// 日志处理流水线：数据源 -> 有界队列 -> 工作协程 -> 输出
+// 数据源只负责入队，不会被慢速的 AI 调用阻塞（block 策略下队列满时才等待）；
+// 多个工作协程并发处理，输出前按数据源重新排序
+type Pipeline struct {
+	queue   *Queue
+	workers int
+	timeout time.Duration
+	process Processor
+	sinks   []Sink
+	results chan sequenced
+
+	// 取出日志时按数据源分配序号，输出时按序号排序
+	popMu   sync.Mutex
+	nextSeq map[string]uint64
+
+	inFlight  int64
+	processed uint64
+	failed    uint64
+
+	workerWg  sync.WaitGroup
+	sinkDone  chan struct{}
+	closed    chan struct{}
+	startOnce sync.Once
+	closeOnce sync.Once
+}
+
+// 带序号的处理结果
+type sequenced struct {
+	Result
+	seq uint64
+}
+
+// 创建流水线
+func New(cfg Config, process Processor, sinks ...Sink) (*Pipeline, error) {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+
+	queue, err := NewQueue(cfg.QueueSize, cfg.Overflow, cfg.QueueTimeout, cfg.SpillDir, cfg.SpillMaxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pipeline{
+		queue:    queue,
+		workers:  cfg.Workers,
+		timeout:  cfg.JobTimeout,
+		process:  process,
+		sinks:    sinks,
+		results:  make(chan sequenced, cfg.Workers*2),
+		nextSeq:  make(map[string]uint64),
+		sinkDone: make(chan struct{}),
+		closed:   make(chan struct{}),
+	}, nil
+}
+
+// 启动工作协程和输出协程；ctx 取消后正在处理的日志被中止，队列停止接收新日志，工作协程退出
+func (p *Pipeline) Start(ctx context.Context) {
+	p.startOnce.Do(func() {
+		for i := 0; i < p.workers; i++ {
+			p.workerWg.Add(1)
+			go p.work(ctx)
+		}
+		go p.sink()
+
+		// 取消后关闭队列，唤醒等待队列空位的数据源
+		go func() {
+			select {
+			case <-ctx.Done():
+				p.queue.Close()
+			case <-p.closed:
+			}
+		}()
+	})
+}
+
+func (p *Pipeline) work(ctx context.Context) {
+	defer p.workerWg.Done()
+
+	for {
+		entry, seq, ok := p.pop(ctx)
+		if !ok {
+			return
+		}
+
+		atomic.AddInt64(&p.inFlight, 1)
+		wait := time.Since(entry.Enqueued)
+		value, err := p.run(ctx, entry)
+		atomic.AddInt64(&p.inFlight, -1)
+
+		atomic.AddUint64(&p.processed, 1)
+		if err != nil {
+			atomic.AddUint64(&p.failed, 1)
+		}
+		p.results <- sequenced{Result: Result{Entry: entry, Value: value, Err: err, Wait: wait}, seq: seq}
+	}
+}
+
+// 取出一条日志并分配该数据源的下一个序号
+func (p *Pipeline) pop(ctx context.Context) (Entry, uint64, bool) {
+	p.popMu.Lock()
+	defer p.popMu.Unlock()
+
+	entry, ok := p.queue.Pop(ctx)
+	if !ok {
+		return Entry{}, 0, false
+	}
+	seq := p.nextSeq[entry.Source]
+	p.nextSeq[entry.Source] = seq + 1
+	return entry, seq, true
+}
+
+// 处理一条日志；超过单条超时后不再等待 Processor 返回，避免阻塞同一数据源后续日志的输出
+func (p *Pipeline) run(ctx context.Context, entry Entry) (interface{}, error) {
+	if p.timeout <= 0 {
+		return p.process(ctx, entry)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	type outcome struct {
+		value interface{}
+		err   error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		value, err := p.process(ctx, entry)
+		done <- outcome{value, err}
+	}()
+
+	select {
+	case o := <-done:
+		return o.value, o.err
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("处理超时 (%s): %w", p.timeout, ctx.Err())
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// 输出协程：同一数据源的结果按序号输出，先完成的结果等待前面的结果
+func (p *Pipeline) sink() {
+	defer close(p.sinkDone)
+
+	pending := make(map[string]map[uint64]Result)
+	next := make(map[string]uint64)
+	for result := range p.results {
+		source := result.Entry.Source
+		if result.seq != next[source] {
+			if pending[source] == nil {
+				pending[source] = make(map[uint64]Result)
+			}
+			pending[source][result.seq] = result.Result
+			continue
+		}
+
+		p.emit(result.Result)
+		seq := result.seq + 1
+		for {
+			r, ok := pending[source][seq]
+			if !ok {
+				break
+			}
+			delete(pending[source], seq)
+			p.emit(r)
+			seq++
+		}
+		next[source] = seq
+		if len(pending[source]) == 0 {
+			delete(pending, source)
+		}
+	}
+}
+
+func (p *Pipeline) emit(result Result) {
+	for _, sink := range p.sinks {
+		sink(result)
+	}
+}
+
+// 提交一条日志，返回 false 表示按溢出策略被丢弃
+func (p *Pipeline) Submit(entry Entry) bool {
+	return p.queue.Push(entry)
+}
+
+// 停止接收新日志，等待队列中的日志处理完成并输出（ctx 已取消时只等待正在处理的日志）
+func (p *Pipeline) Close() {
+	p.closeOnce.Do(func() {
+		p.Start(context.Background())
+		close(p.closed)
+		p.queue.Close()
+		p.workerWg.Wait()
+		close(p.results)
+		<-p.sinkDone
+	})
+}
+
+// 流水线统计
+func (p *Pipeline) Stats() Stats {
+	return Stats{
+		QueueStats: p.queue.Stats(),
+		Workers:    p.workers,
+		InFlight:   atomic.LoadInt64(&p.inFlight),
+		Processed:  atomic.LoadUint64(&p.processed),
+		Failed:     atomic.LoadUint64(&p.failed),
+	}
+}
@@ -0,0 +1,350 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func drain(t *testing.T, q *Queue) []string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var lines []string
+	for {
+		entry, ok := q.Pop(ctx)
+		if !ok {
+			if ctx.Err() != nil {
+				t.Fatalf("等待队列关闭超时，已取出 %v", lines)
+			}
+			return lines
+		}
+		lines = append(lines, entry.Line)
+	}
+}
+
+func pushLines(q *Queue, n int) {
+	for i := 0; i < n; i++ {
+		q.Push(Entry{Source: "test", Line: fmt.Sprintf("line-%d", i)})
+	}
+}
+
+func TestQueueOverflowPolicies(t *testing.T) {
+	tests := []struct {
+		policy  string
+		want    []string
+		dropped uint64
+	}{
+		{OverflowDropNewest, []string{"line-0", "line-1", "line-2"}, 2},
+		{OverflowDropOldest, []string{"line-2", "line-3", "line-4"}, 2},
+		{OverflowBlock, []string{"line-0", "line-1", "line-2"}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			q, err := NewQueue(3, tt.policy, 10*time.Millisecond, "", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pushLines(q, 5)
+
+			stats := q.Stats()
+			if stats.Queued != 3 || stats.Dropped != tt.dropped {
+				t.Errorf("统计 = %+v, 期望排队 3 条、丢弃 %d 条", stats, tt.dropped)
+			}
+
+			q.Close()
+			if got := drain(t, q); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("取出 %v, 期望 %v", got, tt.want)
+			}
+			if q.Push(Entry{Line: "late"}) {
+				t.Error("关闭后的 Push 应被丢弃")
+			}
+		})
+	}
+}
+
+func TestQueueBlockWaitsForSpace(t *testing.T) {
+	q, err := NewQueue(1, OverflowBlock, 0, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Push(Entry{Line: "first"})
+
+	pushed := make(chan bool)
+	go func() { pushed <- q.Push(Entry{Line: "second"}) }()
+
+	select {
+	case <-pushed:
+		t.Fatal("队列已满时 Push 应阻塞")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if entry, _ := q.Pop(context.Background()); entry.Line != "first" {
+		t.Fatalf("取出 %q, 期望 first", entry.Line)
+	}
+	if !<-pushed {
+		t.Fatal("有空位后 Push 应成功")
+	}
+}
+
+func TestQueueSpill(t *testing.T) {
+	dir := t.TempDir()
+	q, err := NewQueue(2, OverflowSpill, 0, dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pushLines(q, 10)
+	if stats := q.Stats(); stats.Queued != 10 || stats.Dropped != 0 || stats.Spilled == 0 {
+		t.Errorf("统计 = %+v, 期望 10 条全部排队且部分溢写到磁盘", stats)
+	}
+
+	// 内存和磁盘中的日志按入队顺序取出
+	q.Close()
+	got := drain(t, q)
+	var want []string
+	for i := 0; i < 10; i++ {
+		want = append(want, fmt.Sprintf("line-%d", i))
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("取出 %v, 期望 %v", got, want)
+	}
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 0 {
+		t.Errorf("关闭后溢写文件应被删除，剩余 %d 个", len(files))
+	}
+}
+
+func TestQueueSpillLimit(t *testing.T) {
+	q, err := NewQueue(1, OverflowSpill, 0, t.TempDir(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	pushLines(q, 10)
+	if stats := q.Stats(); stats.Dropped == 0 {
+		t.Errorf("统计 = %+v, 超过溢写上限后应丢弃日志", stats)
+	}
+}
+
+func TestQueuePriority(t *testing.T) {
+	q, err := NewQueue(10, OverflowBlock, 0, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Push(Entry{Source: "debug", Priority: 5, Line: "debug-1"})
+	q.Push(Entry{Source: "payments", Priority: 1, Line: "payments-1"})
+	q.Push(Entry{Source: "debug", Priority: 5, Line: "debug-2"})
+	q.Push(Entry{Source: "payments", Priority: 1, Line: "payments-2"})
+	q.Push(Entry{Source: "app", Priority: 3, Line: "app-1"})
+
+	q.Close()
+	want := []string{"payments-1", "payments-2", "app-1", "debug-1", "debug-2"}
+	if got := drain(t, q); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("取出 %v, 期望 %v", got, want)
+	}
+
+	stats := q.Stats()
+	if len(stats.Sources) != 3 || stats.Sources[0].Source != "payments" || stats.Sources[2].Dequeued != 2 || stats.Sources[2].Queued != 0 {
+		t.Errorf("数据源统计 = %+v", stats.Sources)
+	}
+}
+
+func TestQueueDropOldestLowPriorityFirst(t *testing.T) {
+	q, err := NewQueue(2, OverflowDropOldest, 0, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Push(Entry{Source: "payments", Priority: 1, Line: "payments-1"})
+	q.Push(Entry{Source: "debug", Priority: 5, Line: "debug-1"})
+	// 队列已满，丢弃低优先级的 debug-1
+	q.Push(Entry{Source: "payments", Priority: 1, Line: "payments-2"})
+	// 队列中全是更高优先级的日志，丢弃新日志
+	if q.Push(Entry{Source: "debug", Priority: 5, Line: "debug-2"}) {
+		t.Error("低优先级的新日志不应挤掉高优先级的日志")
+	}
+
+	q.Close()
+	want := []string{"payments-1", "payments-2"}
+	if got := drain(t, q); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("取出 %v, 期望 %v", got, want)
+	}
+	for _, source := range q.Stats().Sources {
+		if source.Source == "debug" && source.Dropped != 2 {
+			t.Errorf("debug 丢弃 %d 条, 期望 2", source.Dropped)
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	var mu sync.Mutex
+	active, peak := 0, 0
+	process := func(ctx context.Context, entry Entry) (interface{}, error) {
+		mu.Lock()
+		active++
+		if active > peak {
+			peak = active
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		active--
+		mu.Unlock()
+		if entry.Line == "line-3" {
+			return nil, fmt.Errorf("failed")
+		}
+		return "ok:" + entry.Line, nil
+	}
+
+	var results []Result
+	p, err := New(Config{Workers: 4, QueueSize: 100}, process, func(r Result) {
+		results = append(results, r)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Start(context.Background())
+
+	for i := 0; i < 20; i++ {
+		if !p.Submit(Entry{Source: "test", Line: fmt.Sprintf("line-%d", i)}) {
+			t.Fatalf("第 %d 条日志被丢弃", i)
+		}
+	}
+	p.Close()
+
+	if len(results) != 20 {
+		t.Fatalf("输出 %d 条结果, 期望 20", len(results))
+	}
+	if peak < 2 || peak > 4 {
+		t.Errorf("最大并发数 %d, 期望 2-4", peak)
+	}
+
+	stats := p.Stats()
+	if stats.Processed != 20 || stats.Failed != 1 || stats.Enqueued != 20 || stats.Queued != 0 {
+		t.Errorf("统计 = %+v", stats)
+	}
+}
+
+func TestNewQueueInvalidPolicy(t *testing.T) {
+	if _, err := NewQueue(10, "unknown", 0, "", 0); err == nil {
+		t.Error("未知策略应返回错误")
+	}
+}
+
+func TestPipelineOrderedPerSource(t *testing.T) {
+	// 处理时间各不相同，先入队的日志可能后完成
+	process := func(ctx context.Context, entry Entry) (interface{}, error) {
+		time.Sleep(time.Duration(len(entry.Line)%3) * time.Millisecond)
+		return nil, nil
+	}
+
+	got := make(map[string][]string)
+	p, err := New(Config{Workers: 8, QueueSize: 1000}, process, func(r Result) {
+		got[r.Entry.Source] = append(got[r.Entry.Source], r.Entry.Line)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Start(context.Background())
+
+	want := make(map[string][]string)
+	for i := 0; i < 100; i++ {
+		for _, source := range []string{"a", "b"} {
+			line := fmt.Sprintf("%s-%s", source, strings.Repeat("x", i))
+			want[source] = append(want[source], line)
+			p.Submit(Entry{Source: source, Line: line})
+		}
+	}
+	p.Close()
+
+	for _, source := range []string{"a", "b"} {
+		if fmt.Sprint(got[source]) != fmt.Sprint(want[source]) {
+			t.Errorf("数据源 %s 的输出顺序与入队顺序不一致", source)
+		}
+	}
+}
+
+func TestPipelineJobTimeout(t *testing.T) {
+	process := func(ctx context.Context, entry Entry) (interface{}, error) {
+		if entry.Line == "slow" {
+			// 不响应 ctx 的处理也不能阻塞后续输出
+			time.Sleep(time.Second)
+		}
+		return entry.Line, nil
+	}
+
+	var results []Result
+	p, err := New(Config{Workers: 2, QueueSize: 10, JobTimeout: 20 * time.Millisecond}, process, func(r Result) {
+		results = append(results, r)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Start(context.Background())
+
+	start := time.Now()
+	p.Submit(Entry{Line: "slow"})
+	p.Submit(Entry{Line: "fast"})
+	p.Close()
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("超时的日志阻塞了 %s", elapsed)
+	}
+	if len(results) != 2 || !errors.Is(results[0].Err, context.DeadlineExceeded) || results[1].Value != "fast" {
+		t.Errorf("结果 = %+v", results)
+	}
+}
+
+func TestPipelineCancel(t *testing.T) {
+	process := func(ctx context.Context, entry Entry) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	p, err := New(Config{Workers: 1, QueueSize: 1}, process)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.Start(ctx)
+
+	// 队列满后 Submit 阻塞，取消后应返回
+	submitted := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			p.Submit(Entry{Line: fmt.Sprintf("line-%d", i)})
+		}
+		close(submitted)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-submitted:
+	case <-time.After(time.Second):
+		t.Fatal("取消后 Submit 仍然阻塞")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("取消后 Close 没有返回")
+	}
+}
@@ -0,0 +1,400 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/pattern"
+	"github.com/xurenlu/aipipe/internal/rule"
+)
+
+// 队列满时的处理策略
+const (
+	OverflowBlock      = "block"       // 阻塞数据源，超过等待时间后丢弃新日志
+	OverflowDropOldest = "drop_oldest" // 丢弃队列中优先级最低的最早日志
+	OverflowDropNewest = "drop_newest" // 丢弃新日志
+	OverflowSpill      = "spill"       // 溢写到磁盘，内存队列有空位后按顺序读回
+)
+
+// 队列中的一条日志
+type Entry struct {
+	Source     string               `json:"source"`               // 数据源名称
+	Priority   int                  `json:"priority,omitempty"`   // 数据源优先级，数字越小越先处理
+	Format     string               `json:"format"`               // 日志格式
+	Line       string               `json:"line"`                 // 日志内容
+	Labels     map[string]string    `json:"labels,omitempty"`     // 数据源提供的元数据（如 OTLP 的 service.name、trace_id）
+	Origin     string               `json:"origin,omitempty"`     // 数据源中日志的来源（文件路径、输出流），多行事件按数据源和来源分别合并
+	Template   *pattern.MatchResult `json:"template,omitempty"`   // 入队前匹配的日志模板（未启用模板挖掘时为空）
+	Rule       *rule.FilterResult   `json:"rule,omitempty"`       // 入队前匹配的规则
+	Suppressed int                  `json:"suppressed,omitempty"` // 采样时在这条之前被抑制的相似日志数
+	Repeats    int                  `json:"repeats,omitempty"`    // 折叠的连续重复日志数（包括这一条），大于 1 时有效
+	FirstSeen  time.Time            `json:"first_seen"`           // 折叠的第一条日志的时间
+	LastSeen   time.Time            `json:"last_seen"`            // 折叠的最后一条日志的时间
+	Enqueued   time.Time            `json:"enqueued"`             // 入队时间
+}
+
+// 队列统计
+type QueueStats struct {
+	Queued   int           `json:"queued"`   // 当前排队数（包括溢写到磁盘的）
+	Spilled  int           `json:"spilled"`  // 当前溢写到磁盘的数量
+	Enqueued uint64        `json:"enqueued"` // 累计入队数
+	Dropped  uint64        `json:"dropped"`  // 累计丢弃数
+	Sources  []SourceStats `json:"sources"`  // 各数据源的统计，按优先级排序
+}
+
+// 单个数据源的队列统计
+type SourceStats struct {
+	Source   string        `json:"source"`
+	Priority int           `json:"priority"`
+	Queued   int           `json:"queued"`    // 当前排队数
+	Enqueued uint64        `json:"enqueued"`  // 累计入队数
+	Dropped  uint64        `json:"dropped"`   // 累计丢弃数
+	Dequeued uint64        `json:"dequeued"`  // 累计取出数
+	AvgWait  time.Duration `json:"avg_wait"`  // 取出前的平均等待时间
+	MaxWait  time.Duration `json:"max_wait"`  // 取出前的最长等待时间
+	LastWait time.Duration `json:"last_wait"` // 最近一条的等待时间
+	waitSum  time.Duration
+}
+
+// 同一优先级的日志，先进先出
+type lane struct {
+	entries []Entry
+	head    int
+}
+
+func (l *lane) len() int {
+	return len(l.entries) - l.head
+}
+
+func (l *lane) push(entry Entry) {
+	l.entries = append(l.entries, entry)
+}
+
+func (l *lane) pop() Entry {
+	entry := l.entries[l.head]
+	l.entries[l.head] = Entry{}
+	l.head++
+	// 取出过半后整理，避免底层数组只增不减
+	if l.head > len(l.entries)/2 {
+		l.entries = append(l.entries[:0], l.entries[l.head:]...)
+		l.head = 0
+	}
+	return entry
+}
+
+// 有界优先级队列：总是先取出优先级最高（数字最小）的日志，同一优先级先进先出，
+// 因此同一数据源的日志保持入队顺序。容量满时按策略阻塞、丢弃或溢写到磁盘，关闭后仍可取出剩余的日志
+type Queue struct {
+	policy   string
+	timeout  time.Duration
+	capacity int
+	spill    *spillFile
+
+	lanes      map[int]*lane
+	priorities []int // 已有的优先级，从小到大
+	size       int
+	sources    map[string]*SourceStats
+
+	enqueued   uint64
+	dropped    uint64
+	closed     bool
+	refillDone bool          // 溢写的日志已全部读回
+	changed    chan struct{} // 队列变化时关闭并替换，唤醒所有等待者
+	mutex      sync.Mutex
+}
+
+// 创建有界队列；spill 策略需要指定溢写目录
+func NewQueue(capacity int, policy string, timeout time.Duration, spillDir string, spillMaxBytes int64) (*Queue, error) {
+	if capacity <= 0 {
+		return nil, fmt.Errorf("队列容量必须大于 0: %d", capacity)
+	}
+	if policy == "" {
+		policy = OverflowBlock
+	}
+
+	q := &Queue{
+		policy:   policy,
+		timeout:  timeout,
+		capacity: capacity,
+		lanes:    make(map[int]*lane),
+		sources:  make(map[string]*SourceStats),
+		changed:  make(chan struct{}),
+	}
+
+	switch policy {
+	case OverflowBlock, OverflowDropOldest, OverflowDropNewest:
+	case OverflowSpill:
+		spill, err := newSpillFile(spillDir, spillMaxBytes)
+		if err != nil {
+			return nil, err
+		}
+		q.spill = spill
+		go q.refill()
+	default:
+		return nil, fmt.Errorf("不支持的队列溢出策略: %s (可选: block, drop_oldest, drop_newest, spill)", policy)
+	}
+
+	return q, nil
+}
+
+// 加入队列，返回 false 表示日志被丢弃
+func (q *Queue) Push(entry Entry) bool {
+	if entry.Enqueued.IsZero() {
+		entry.Enqueued = time.Now()
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		q.drop(entry)
+		return false
+	}
+
+	var ok bool
+	switch q.policy {
+	case OverflowDropNewest:
+		ok = q.tryPush(entry)
+	case OverflowDropOldest:
+		ok = q.pushDropOldest(entry)
+	case OverflowSpill:
+		ok = q.pushSpill(entry)
+	default:
+		ok = q.pushBlock(entry)
+	}
+
+	if !ok {
+		q.drop(entry)
+		return false
+	}
+	q.enqueued++
+	stats := q.source(entry)
+	stats.Enqueued++
+	stats.Queued++
+	return true
+}
+
+// 内存队列有空位时加入，需持有锁
+func (q *Queue) tryPush(entry Entry) bool {
+	if q.size >= q.capacity {
+		return false
+	}
+	q.insert(entry)
+	return true
+}
+
+func (q *Queue) insert(entry Entry) {
+	l, exists := q.lanes[entry.Priority]
+	if !exists {
+		l = &lane{}
+		q.lanes[entry.Priority] = l
+		q.priorities = append(q.priorities, entry.Priority)
+		sort.Ints(q.priorities)
+	}
+	l.push(entry)
+	q.size++
+	q.broadcast()
+}
+
+func (q *Queue) pushBlock(entry Entry) bool {
+	var timeout <-chan time.Time
+	if q.timeout > 0 {
+		timer := time.NewTimer(q.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for !q.tryPush(entry) {
+		if q.closed {
+			return false
+		}
+		changed := q.changed
+		q.mutex.Unlock()
+		select {
+		case <-changed:
+			q.mutex.Lock()
+		case <-timeout:
+			q.mutex.Lock()
+			return q.tryPush(entry)
+		}
+	}
+	return true
+}
+
+// 队列满时丢弃优先级不高于新日志的最低优先级中最早的一条；队列中全是更高优先级的日志时丢弃新日志
+func (q *Queue) pushDropOldest(entry Entry) bool {
+	if q.tryPush(entry) {
+		return true
+	}
+
+	for i := len(q.priorities) - 1; i >= 0 && q.priorities[i] >= entry.Priority; i-- {
+		l := q.lanes[q.priorities[i]]
+		if l.len() == 0 {
+			continue
+		}
+		evicted := l.pop()
+		q.size--
+		q.drop(evicted)
+		stats := q.source(evicted)
+		stats.Queued--
+		q.insert(entry)
+		return true
+	}
+	return false
+}
+
+// 内存队列满或磁盘上还有未读回的日志时写入磁盘，保证同一数据源先进先出
+func (q *Queue) pushSpill(entry Entry) bool {
+	if q.spill.Len() == 0 && q.tryPush(entry) {
+		return true
+	}
+	return q.spill.Write(entry) == nil
+}
+
+// 把溢写到磁盘的日志按顺序读回内存队列
+func (q *Queue) refill() {
+	for {
+		entry, ok := q.spill.Read()
+		if !ok {
+			q.spill.Close()
+			q.mutex.Lock()
+			q.refillDone = true
+			q.broadcast()
+			q.mutex.Unlock()
+			return
+		}
+
+		q.mutex.Lock()
+		for q.size >= q.capacity {
+			changed := q.changed
+			q.mutex.Unlock()
+			<-changed
+			q.mutex.Lock()
+		}
+		q.insert(entry)
+		q.mutex.Unlock()
+		q.spill.Ack()
+	}
+}
+
+// 取出优先级最高的一条日志；队列已关闭且为空时返回 false
+func (q *Queue) Pop(ctx context.Context) (Entry, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for {
+		if q.size > 0 {
+			return q.take(), true
+		}
+		if q.closed && (q.spill == nil || q.refillDone) {
+			return Entry{}, false
+		}
+
+		changed := q.changed
+		q.mutex.Unlock()
+		select {
+		case <-changed:
+			q.mutex.Lock()
+		case <-ctx.Done():
+			q.mutex.Lock()
+			return Entry{}, false
+		}
+	}
+}
+
+func (q *Queue) take() Entry {
+	for _, priority := range q.priorities {
+		l := q.lanes[priority]
+		if l.len() == 0 {
+			continue
+		}
+
+		entry := l.pop()
+		q.size--
+		q.broadcast()
+
+		wait := time.Since(entry.Enqueued)
+		stats := q.source(entry)
+		stats.Queued--
+		stats.Dequeued++
+		stats.waitSum += wait
+		stats.LastWait = wait
+		if wait > stats.MaxWait {
+			stats.MaxWait = wait
+		}
+		return entry
+	}
+	return Entry{}
+}
+
+// 关闭队列：之后的 Push 都会被丢弃，已在队列中（包括溢写到磁盘）的日志仍可取出
+func (q *Queue) Close() {
+	q.mutex.Lock()
+	if q.closed {
+		q.mutex.Unlock()
+		return
+	}
+	q.closed = true
+	q.broadcast()
+	q.mutex.Unlock()
+
+	if q.spill != nil {
+		// 读回协程读完磁盘上的日志后结束
+		q.spill.Finish()
+	}
+}
+
+// 唤醒所有等待队列变化的协程，需持有锁
+func (q *Queue) broadcast() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+func (q *Queue) drop(entry Entry) {
+	q.dropped++
+	q.source(entry).Dropped++
+}
+
+// 数据源统计，需持有锁
+func (q *Queue) source(entry Entry) *SourceStats {
+	stats, exists := q.sources[entry.Source]
+	if !exists {
+		stats = &SourceStats{Source: entry.Source, Priority: entry.Priority}
+		q.sources[entry.Source] = stats
+	}
+	return stats
+}
+
+// 队列统计
+func (q *Queue) Stats() QueueStats {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	stats := QueueStats{
+		Queued:   q.size,
+		Enqueued: q.enqueued,
+		Dropped:  q.dropped,
+	}
+	if q.spill != nil {
+		stats.Spilled = q.spill.Len()
+		stats.Queued += stats.Spilled
+	}
+
+	for _, source := range q.sources {
+		s := *source
+		if s.Dequeued > 0 {
+			s.AvgWait = s.waitSum / time.Duration(s.Dequeued)
+		}
+		stats.Sources = append(stats.Sources, s)
+	}
+	sort.Slice(stats.Sources, func(i, j int) bool {
+		if stats.Sources[i].Priority != stats.Sources[j].Priority {
+			return stats.Sources[i].Priority < stats.Sources[j].Priority
+		}
+		return stats.Sources[i].Source < stats.Sources[j].Source
+	})
+	return stats
+}
@@ -0,0 +1,190 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// 默认溢写文件上限
+const DefaultSpillMaxBytes = 1024 * 1024 * 1024
+
+// 默认溢写目录
+func DefaultSpillDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "aipipe", "spill")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".local", "state", "aipipe", "spill")
+}
+
+// 溢写文件：每行一条 JSON 编码的日志，全部读回后清空文件
+type spillFile struct {
+	file     *os.File
+	maxBytes int64
+	readOff  int64
+	writeOff int64
+	count    int
+	finished bool          // 不再写入，读完后 Read 返回 false
+	written  chan struct{} // 写入新日志或结束写入时发送信号
+	mutex    sync.Mutex
+}
+
+func newSpillFile(dir string, maxBytes int64) (*spillFile, error) {
+	if dir == "" {
+		dir = DefaultSpillDir()
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultSpillMaxBytes
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("创建溢写目录失败: %w", err)
+	}
+
+	file, err := os.CreateTemp(dir, fmt.Sprintf("queue-%d-*.jsonl", os.Getpid()))
+	if err != nil {
+		return nil, fmt.Errorf("创建溢写文件失败: %w", err)
+	}
+
+	return &spillFile{
+		file:     file,
+		maxBytes: maxBytes,
+		written:  make(chan struct{}, 1),
+	}, nil
+}
+
+// 未读回的日志数
+func (s *spillFile) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.count
+}
+
+// 追加一条日志
+func (s *spillFile) Write(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return fmt.Errorf("溢写文件已关闭")
+	}
+	if s.finished {
+		return fmt.Errorf("溢写文件已停止写入")
+	}
+	if s.writeOff+int64(len(data)) > s.maxBytes {
+		return fmt.Errorf("溢写文件已满")
+	}
+	if _, err := s.file.WriteAt(data, s.writeOff); err != nil {
+		return err
+	}
+	s.writeOff += int64(len(data))
+	s.count++
+	s.notify()
+	return nil
+}
+
+// 停止写入，剩余的日志读完后 Read 返回 false
+func (s *spillFile) Finish() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.finished = true
+	s.notify()
+}
+
+func (s *spillFile) notify() {
+	select {
+	case s.written <- struct{}{}:
+	default:
+	}
+}
+
+// 按写入顺序读回一条日志，没有日志时等待；停止写入且全部读完后返回 false。
+// 每条日志处理完后需要调用 Ack
+func (s *spillFile) Read() (Entry, bool) {
+	for {
+		entry, ok, done, err := s.next()
+		if err != nil {
+			fmt.Printf("⚠️  读取溢写文件失败: %v\n", err)
+			continue
+		}
+		if ok {
+			return entry, true
+		}
+		if done {
+			return Entry{}, false
+		}
+		<-s.written
+	}
+}
+
+// 读取下一条日志；done 表示已停止写入且没有剩余日志。
+// 读出的日志在 Ack 之前仍计入 Len，保证新日志不会越过它直接进入内存队列
+func (s *spillFile) next() (entry Entry, ok, done bool, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil || s.count == 0 {
+		return Entry{}, false, s.file == nil || s.finished, nil
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(s.file, s.readOff, s.writeOff-s.readOff))
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		// 无法继续读取，丢弃剩余的溢写日志
+		s.count, s.readOff, s.writeOff = 0, 0, 0
+		s.file.Truncate(0)
+		return Entry{}, false, false, err
+	}
+	s.readOff += int64(len(line))
+
+	// 损坏的行跳过，不影响后续日志
+	if err := json.Unmarshal(line, &entry); err != nil {
+		s.ack()
+		return Entry{}, false, false, err
+	}
+	return entry, true, false, nil
+}
+
+// 确认 Read 返回的日志已送入内存队列
+func (s *spillFile) Ack() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.ack()
+}
+
+func (s *spillFile) ack() {
+	if s.count == 0 {
+		return
+	}
+	s.count--
+
+	// 全部读回后清空文件，避免文件无限增长
+	if s.count == 0 && s.file != nil {
+		s.readOff, s.writeOff = 0, 0
+		s.file.Truncate(0)
+	}
+}
+
+// 关闭并删除溢写文件
+func (s *spillFile) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return
+	}
+	s.file.Close()
+	os.Remove(s.file.Name())
+	s.file = nil
+	s.count = 0
+}
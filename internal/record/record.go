@@ -0,0 +1,75 @@
+package record
+
+import (
+	"strings"
+	"time"
+)
+
+// 日志记录：各种数据源（文件、journald、syslog、HTTP 等）解析后的统一结构
+type Record struct {
+	Time     time.Time         `json:"time"`               // 日志时间
+	Source   string            `json:"source"`             // 数据源名称
+	Format   string            `json:"format"`             // 日志格式
+	Host     string            `json:"host,omitempty"`     // 主机名
+	App      string            `json:"app,omitempty"`      // 应用/单元名称
+	PID      string            `json:"pid,omitempty"`      // 进程ID
+	Severity string            `json:"severity,omitempty"` // 日志级别 (emerg, alert, crit, err, warning, notice, info, debug)
+	Message  string            `json:"message"`            // 日志内容
+	Labels   map[string]string `json:"labels,omitempty"`   // 其他元数据
+	Priority int               `json:"priority,omitempty"` // 数据源优先级，数字越小越先分析
+	Complete bool              `json:"-"`                  // 已是完整的事件（结构化数据源的记录），不再把后续的行合并为续行
+	Origin   string            `json:"-"`                  // 数据源中日志的来源（文件路径、输出流、应用），多行事件按来源分别合并
+}
+
+// syslog 严重级别名称，下标即级别数值
+var SeverityNames = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// 根据数值返回严重级别名称
+func SeverityName(level int) string {
+	if level < 0 || level >= len(SeverityNames) {
+		return ""
+	}
+	return SeverityNames[level]
+}
+
+// 设置元数据标签
+func (r *Record) SetLabel(key, value string) {
+	if value == "" {
+		return
+	}
+	if r.Labels == nil {
+		r.Labels = make(map[string]string)
+	}
+	r.Labels[key] = value
+}
+
+// 渲染为文本日志行（类似 journalctl 的 short-iso 格式），供规则和 AI 分析使用
+func (r *Record) Line() string {
+	return r.Header() + r.Message
+}
+
+// 渲染日志行的头部：时间、主机、应用和级别
+func (r *Record) Header() string {
+	var b strings.Builder
+
+	if !r.Time.IsZero() {
+		b.WriteString(r.Time.Format("2006-01-02T15:04:05.000Z07:00"))
+		b.WriteByte(' ')
+	}
+	if r.Host != "" {
+		b.WriteString(r.Host)
+		b.WriteByte(' ')
+	}
+	if r.App != "" {
+		b.WriteString(r.App)
+		if r.PID != "" {
+			b.WriteString("[" + r.PID + "]")
+		}
+		b.WriteString(": ")
+	}
+	if r.Severity != "" {
+		b.WriteString("<" + r.Severity + "> ")
+	}
+
+	return b.String()
+}
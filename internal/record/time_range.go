@@ -0,0 +1,135 @@
+package record
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 时间窗口，零值表示不限制
+type TimeRange struct {
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+}
+
+// 是否未设置任何边界
+func (r TimeRange) IsZero() bool {
+	return r.Since.IsZero() && r.Until.IsZero()
+}
+
+// 时间是否在窗口内
+func (r TimeRange) Contains(t time.Time) bool {
+	if !r.Since.IsZero() && t.Before(r.Since) {
+		return false
+	}
+	if !r.Until.IsZero() && t.After(r.Until) {
+		return false
+	}
+	return true
+}
+
+// 解析 --since/--until 参数，支持相对时间（2h、15m、1d）和绝对时间
+func ParseTimeRange(since, until string, now time.Time) (TimeRange, error) {
+	var r TimeRange
+	var err error
+
+	if since != "" {
+		if r.Since, err = ParseTimeBound(since, now); err != nil {
+			return r, fmt.Errorf("无效的 --since: %w", err)
+		}
+	}
+	if until != "" {
+		if r.Until, err = ParseTimeBound(until, now); err != nil {
+			return r, fmt.Errorf("无效的 --until: %w", err)
+		}
+	}
+	if !r.Since.IsZero() && !r.Until.IsZero() && r.Until.Before(r.Since) {
+		return r, fmt.Errorf("--until 早于 --since")
+	}
+
+	return r, nil
+}
+
+// 绝对时间格式
+var timeBoundLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// 解析单个时间边界：相对时间表示“now 之前多久”
+func ParseTimeBound(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	if value == "now" {
+		return now, nil
+	}
+
+	if d, err := parseRelativeDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+
+	for _, layout := range timeBoundLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	// 仅时间（如 14:30）表示今天
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("无法解析时间: %s", value)
+}
+
+// 解析相对时间，在 time.ParseDuration 基础上支持天 (d)
+func parseRelativeDuration(value string) (time.Duration, error) {
+	value = strings.TrimPrefix(value, "-")
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(value, "d"), 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(value)
+}
+
+// 按时间窗口过滤日志行
+// 没有时间戳的行（如堆栈、多行消息）沿用上一条带时间戳日志的时间
+type TimeFilter struct {
+	Range   TimeRange
+	last    time.Time
+	hasLast bool
+}
+
+// 创建时间窗口过滤器
+func NewTimeFilter(r TimeRange) *TimeFilter {
+	return &TimeFilter{Range: r}
+}
+
+// 检查日志行：keep 表示是否保留，past 表示已超过 until（有序日志可以停止读取）
+func (f *TimeFilter) Check(line string) (keep bool, past bool) {
+	if f.Range.IsZero() {
+		return true, false
+	}
+
+	if t, ok := ExtractTimestamp(line); ok {
+		f.last = t
+		f.hasLast = true
+	}
+
+	// 尚未遇到任何时间戳，无法判断，保留
+	if !f.hasLast {
+		return true, false
+	}
+
+	past = !f.Range.Until.IsZero() && f.last.After(f.Range.Until)
+	return f.Range.Contains(f.last), past
+}
@@ -0,0 +1,99 @@
+package record
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 时间戳格式：正则用于从日志行中定位时间戳，layouts 用于解析
+type timestampFormat struct {
+	pattern *regexp.Regexp
+	layouts []string
+	noYear  bool // 格式中不包含年份（如 syslog），使用当前年份
+}
+
+var timestampFormats = []timestampFormat{
+	{
+		// ISO 8601 / RFC 3339: 2025-10-17T08:30:00.123Z, 2025-10-17 08:30:00,123 +0800
+		pattern: regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d{1,9})?(?:Z|[+-]\d{2}:?\d{2})?`),
+		layouts: []string{
+			"2006-01-02T15:04:05.999999999Z07:00",
+			"2006-01-02T15:04:05.999999999Z0700",
+			"2006-01-02T15:04:05.999999999",
+			"2006-01-02 15:04:05.999999999Z07:00",
+			"2006-01-02 15:04:05.999999999Z0700",
+			"2006-01-02 15:04:05.999999999",
+		},
+	},
+	{
+		// Nginx/Apache: 17/Oct/2025:08:30:00 +0800
+		pattern: regexp.MustCompile(`\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2}(?: [+-]\d{4})?`),
+		layouts: []string{"02/Jan/2006:15:04:05 -0700", "02/Jan/2006:15:04:05"},
+	},
+	{
+		// Go log / Nginx error log: 2025/10/17 08:30:00
+		pattern: regexp.MustCompile(`\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(?:\.\d{1,9})?`),
+		layouts: []string{"2006/01/02 15:04:05.999999999"},
+	},
+	{
+		// Syslog: Oct 17 08:30:00
+		pattern: regexp.MustCompile(`[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}`),
+		layouts: []string{"Jan _2 15:04:05", "Jan 02 15:04:05"},
+		noYear:  true,
+	},
+}
+
+// Unix 时间戳（JSON 日志常见字段）："ts":1697531400.123
+var epochPattern = regexp.MustCompile(`"(?:ts|time|timestamp|@timestamp)"\s*:\s*(\d{10})(?:\.(\d{1,9}))?`)
+
+// 从日志行中提取时间戳
+func ExtractTimestamp(line string) (time.Time, bool) {
+	// 时间戳通常出现在行首，限制扫描范围避免长行开销
+	head := line
+	if len(head) > 256 {
+		head = head[:256]
+	}
+
+	for _, format := range timestampFormats {
+		match := format.pattern.FindString(head)
+		if match == "" {
+			continue
+		}
+
+		normalized := strings.Replace(match, ",", ".", 1)
+		for _, layout := range format.layouts {
+			t, err := time.ParseInLocation(layout, normalized, time.Local)
+			if err != nil {
+				continue
+			}
+			if format.noYear {
+				t = withCurrentYear(t)
+			}
+			return t, true
+		}
+	}
+
+	if m := epochPattern.FindStringSubmatch(head); m != nil {
+		sec, _ := strconv.ParseInt(m[1], 10, 64)
+		nsec := int64(0)
+		if m[2] != "" {
+			frac := (m[2] + "000000000")[:9]
+			nsec, _ = strconv.ParseInt(frac, 10, 64)
+		}
+		return time.Unix(sec, nsec), true
+	}
+
+	return time.Time{}, false
+}
+
+// 为不含年份的时间补全年份；若结果晚于当前时间太多，视为去年的日志
+func withCurrentYear(t time.Time) time.Time {
+	now := time.Now()
+	t = time.Date(now.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local)
+	if t.After(now.Add(24 * time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t
+}
@@ -0,0 +1,592 @@
+package rule
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 条件表达式：对日志字段求值，编译时检查语法和类型，例如
+//
+//	level == "ERROR" && service == "payments" && latency_ms > 2000
+//	status >= 500 && path =~ "^/api/"
+//
+// 支持 ==、!=、<、<=、>、>=、=~（正则匹配）、!~、&&、||、! 和括号；
+// 字面量为双引号或单引号字符串、数字、true/false，其他标识符为字段名。
+// 字段不存在时比较结果为 false；字段是字符串、字面量是数字时按数字比较
+type Expr struct {
+	source string
+	root   node
+}
+
+// 条件求值的一步：一次比较或一个布尔字段
+type Step struct {
+	Expr   string `json:"expr"`   // 比较表达式
+	Values string `json:"values"` // 参与比较的字段值
+	Result bool   `json:"result"` // 比较结果
+}
+
+// 编译条件表达式
+func CompileCondition(source string) (*Expr, error) {
+	p := &parser{source: source}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, p.errorf(tok, "多余的 %q", tok.text)
+	}
+	if t := root.typ(); t != typeBool && t != typeDynamic {
+		return nil, fmt.Errorf("条件表达式的结果必须是布尔值，实际为%s", t)
+	}
+	return &Expr{source: source, root: asCondition(root)}, nil
+}
+
+// 条件表达式原文
+func (e *Expr) String() string {
+	return e.source
+}
+
+// 对字段求值
+func (e *Expr) Eval(fields Fields) bool {
+	return truthy(e.root.eval(&env{fields: fields}))
+}
+
+// 对字段求值并记录每一步比较，短路未求值的比较不记录
+func (e *Expr) Explain(fields Fields) (bool, []Step) {
+	env := &env{fields: fields, trace: true}
+	result := truthy(e.root.eval(env))
+	return result, env.steps
+}
+
+// 值类型
+type valueType int
+
+const (
+	typeDynamic valueType = iota // 字段，运行时才知道类型
+	typeBool
+	typeNumber
+	typeString
+)
+
+func (t valueType) String() string {
+	switch t {
+	case typeBool:
+		return "布尔值"
+	case typeNumber:
+		return "数字"
+	case typeString:
+		return "字符串"
+	}
+	return "字段"
+}
+
+type env struct {
+	fields Fields
+	trace  bool
+	steps  []Step
+}
+
+type node interface {
+	typ() valueType
+	eval(env *env) interface{}
+	String() string
+}
+
+// 字面量
+type literal struct {
+	value interface{}
+	text  string
+}
+
+func (l *literal) typ() valueType {
+	switch l.value.(type) {
+	case bool:
+		return typeBool
+	case float64:
+		return typeNumber
+	}
+	return typeString
+}
+
+func (l *literal) eval(*env) interface{} { return l.value }
+func (l *literal) String() string        { return l.text }
+
+// 字段引用
+type field struct {
+	name string
+}
+
+func (f *field) typ() valueType { return typeDynamic }
+func (f *field) String() string { return f.name }
+
+func (f *field) eval(env *env) interface{} {
+	value, exists := env.fields[f.name]
+	if !exists {
+		return nil
+	}
+	return value
+}
+
+// 作为条件单独出现的字段，如 retry && level == "WARN"
+type fieldCondition struct {
+	*field
+}
+
+func (f *fieldCondition) eval(env *env) interface{} {
+	value := f.field.eval(env)
+	result := truthy(value)
+	if env.trace {
+		env.steps = append(env.steps, Step{Expr: f.name, Values: describe(f.name, value), Result: result})
+	}
+	return result
+}
+
+// 比较
+type comparison struct {
+	op          string
+	left, right node
+	regex       *regexp.Regexp // =~ 和 !~ 的正则，编译时生成
+}
+
+func (c *comparison) typ() valueType { return typeBool }
+
+func (c *comparison) String() string {
+	return c.left.String() + " " + c.op + " " + c.right.String()
+}
+
+func (c *comparison) eval(env *env) interface{} {
+	left, right := c.left.eval(env), c.right.eval(env)
+	result := c.compare(left, right)
+	if env.trace {
+		var values []string
+		for _, operand := range []struct {
+			n node
+			v interface{}
+		}{{c.left, left}, {c.right, right}} {
+			if f, ok := operand.n.(*field); ok {
+				values = append(values, describe(f.name, operand.v))
+			}
+		}
+		env.steps = append(env.steps, Step{Expr: c.String(), Values: strings.Join(values, ", "), Result: result})
+	}
+	return result
+}
+
+func (c *comparison) compare(left, right interface{}) bool {
+	if left == nil || right == nil {
+		return false
+	}
+
+	switch c.op {
+	case "=~":
+		return c.regex.MatchString(toString(left))
+	case "!~":
+		return !c.regex.MatchString(toString(left))
+	case "==":
+		return equal(left, right)
+	case "!=":
+		return !equal(left, right)
+	}
+
+	if l, r, ok := numbers(left, right); ok {
+		switch c.op {
+		case "<":
+			return l < r
+		case "<=":
+			return l <= r
+		case ">":
+			return l > r
+		case ">=":
+			return l >= r
+		}
+	}
+	ls, lok := left.(string)
+	rs, rok := right.(string)
+	if !lok || !rok {
+		return false
+	}
+	switch c.op {
+	case "<":
+		return ls < rs
+	case "<=":
+		return ls <= rs
+	case ">":
+		return ls > rs
+	case ">=":
+		return ls >= rs
+	}
+	return false
+}
+
+// 逻辑运算
+type logical struct {
+	op          string // && 或 ||
+	left, right node
+}
+
+func (l *logical) typ() valueType { return typeBool }
+
+func (l *logical) String() string {
+	return "(" + l.left.String() + " " + l.op + " " + l.right.String() + ")"
+}
+
+func (l *logical) eval(env *env) interface{} {
+	left := truthy(l.left.eval(env))
+	if l.op == "&&" && !left {
+		return false
+	}
+	if l.op == "||" && left {
+		return true
+	}
+	return truthy(l.right.eval(env))
+}
+
+// 取反
+type not struct {
+	operand node
+}
+
+func (n *not) typ() valueType            { return typeBool }
+func (n *not) String() string            { return "!" + n.operand.String() }
+func (n *not) eval(env *env) interface{} { return !truthy(n.operand.eval(env)) }
+
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		b, err := strconv.ParseBool(v)
+		return err == nil && b
+	}
+	return false
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// 转换为数字比较，字符串字段可以解析为数字时按数字比较
+func numbers(left, right interface{}) (float64, float64, bool) {
+	l, lok := toNumber(left)
+	r, rok := toNumber(right)
+	_, lnum := left.(float64)
+	_, rnum := right.(float64)
+	return l, r, lok && rok && (lnum || rnum)
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func equal(left, right interface{}) bool {
+	if l, r, ok := numbers(left, right); ok {
+		return l == r
+	}
+	if _, ok := left.(bool); ok {
+		return truthy(left) == truthy(right)
+	}
+	if _, ok := right.(bool); ok {
+		return truthy(left) == truthy(right)
+	}
+	return toString(left) == toString(right)
+}
+
+func describe(name string, value interface{}) string {
+	if value == nil {
+		return name + " 不存在"
+	}
+	if s, ok := value.(string); ok {
+		return name + " = " + strconv.Quote(s)
+	}
+	return name + " = " + toString(value)
+}
+
+// 词法单元
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type parser struct {
+	source string
+	tokens []token
+	pos    int
+}
+
+func (p *parser) errorf(tok token, format string, args ...interface{}) error {
+	return fmt.Errorf("条件表达式第 %d 个字符: %s", tok.pos+1, fmt.Sprintf(format, args...))
+}
+
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!"}
+
+func (p *parser) tokenize() error {
+	s := p.source
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			p.tokens = append(p.tokens, token{tokenLParen, "(", i})
+			i++
+		case c == ')':
+			p.tokens = append(p.tokens, token{tokenRParen, ")", i})
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(s) && s[end] != c {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return fmt.Errorf("条件表达式第 %d 个字符: 字符串没有结束", i+1)
+			}
+			p.tokens = append(p.tokens, token{tokenString, s[i : end+1], i})
+			i = end + 1
+		case c >= '0' && c <= '9' || c == '-' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9' || c == '.' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			end := i + 1
+			for end < len(s) && (s[end] >= '0' && s[end] <= '9' || s[end] == '.' || s[end] == 'e' || s[end] == 'E') {
+				end++
+			}
+			p.tokens = append(p.tokens, token{tokenNumber, s[i:end], i})
+			i = end
+		case c == '_' || isLetter(c):
+			end := i + 1
+			for end < len(s) && (s[end] == '_' || s[end] == '.' || s[end] == '-' || s[end] >= '0' && s[end] <= '9' || isLetter(s[end])) {
+				end++
+			}
+			p.tokens = append(p.tokens, token{tokenIdent, s[i:end], i})
+			i = end
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(s[i:], op) {
+					p.tokens = append(p.tokens, token{tokenOp, op, i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return fmt.Errorf("条件表达式第 %d 个字符: 无法识别的 %q", i+1, string(c))
+			}
+		}
+	}
+	p.tokens = append(p.tokens, token{tokenEOF, "", len(s)})
+	return nil
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// 检查逻辑运算的操作数是否为布尔值
+func (p *parser) checkBool(tok token, n node) error {
+	if t := n.typ(); t != typeBool && t != typeDynamic {
+		return p.errorf(tok, "%s 的操作数必须是布尔值，%s 是%s", tok.text, n, t)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOp && p.peek().text == "||" {
+		tok := p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.checkBool(tok, left); err != nil {
+			return nil, err
+		}
+		if err := p.checkBool(tok, right); err != nil {
+			return nil, err
+		}
+		left = &logical{op: "||", left: asCondition(left), right: asCondition(right)}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOp && p.peek().text == "&&" {
+		tok := p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.checkBool(tok, left); err != nil {
+			return nil, err
+		}
+		if err := p.checkBool(tok, right); err != nil {
+			return nil, err
+		}
+		left = &logical{op: "&&", left: asCondition(left), right: asCondition(right)}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if tok := p.peek(); tok.kind == tokenOp && tok.text == "!" {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.checkBool(tok, operand); err != nil {
+			return nil, err
+		}
+		return &not{operand: asCondition(operand)}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	if tok.kind != tokenOp || tok.text == "&&" || tok.text == "||" || tok.text == "!" {
+		return left, nil
+	}
+	p.next()
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &comparison{op: tok.text, left: left, right: right}
+	lt, rt := left.typ(), right.typ()
+	switch tok.text {
+	case "=~", "!~":
+		lit, ok := right.(*literal)
+		if !ok || rt != typeString {
+			return nil, p.errorf(tok, "%s 右边必须是正则表达式字符串", tok.text)
+		}
+		if lt == typeBool {
+			return nil, p.errorf(tok, "%s 左边不能是布尔值", tok.text)
+		}
+		regex, err := regexp.Compile(lit.value.(string))
+		if err != nil {
+			return nil, p.errorf(tok, "正则表达式无效: %v", err)
+		}
+		c.regex = regex
+	case "<", "<=", ">", ">=":
+		if lt == typeBool || rt == typeBool {
+			return nil, p.errorf(tok, "%s 不能比较布尔值", tok.text)
+		}
+		fallthrough
+	default:
+		if lt != typeDynamic && rt != typeDynamic && lt != rt {
+			return nil, p.errorf(tok, "%s 两边的类型不一致: %s 和 %s", tok.text, lt, rt)
+		}
+	}
+	return c, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenLParen:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, p.errorf(closing, "缺少 )")
+		}
+		return n, nil
+	case tokenString:
+		value, err := unquote(tok.text)
+		if err != nil {
+			return nil, p.errorf(tok, "字符串无效: %v", err)
+		}
+		return &literal{value: value, text: tok.text}, nil
+	case tokenNumber:
+		value, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf(tok, "数字无效: %s", tok.text)
+		}
+		return &literal{value: value, text: tok.text}, nil
+	case tokenIdent:
+		switch tok.text {
+		case "true":
+			return &literal{value: true, text: tok.text}, nil
+		case "false":
+			return &literal{value: false, text: tok.text}, nil
+		}
+		return &field{name: tok.text}, nil
+	case tokenEOF:
+		return nil, p.errorf(tok, "表达式不完整")
+	}
+	return nil, p.errorf(tok, "这里不能出现 %q", tok.text)
+}
+
+// 逻辑运算中单独出现的字段按布尔值求值，并记录到求值步骤中
+func asCondition(n node) node {
+	if f, ok := n.(*field); ok {
+		return &fieldCondition{field: f}
+	}
+	return n
+}
+
+func unquote(text string) (string, error) {
+	if strings.HasPrefix(text, "'") {
+		inner := text[1 : len(text)-1]
+		return strings.ReplaceAll(inner, `\'`, "'"), nil
+	}
+	return strconv.Unquote(text)
+}
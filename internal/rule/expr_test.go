@@ -0,0 +1,161 @@
+package rule
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xurenlu/aipipe/internal/config"
+)
+
+func TestConditionEval(t *testing.T) {
+	logfmt := `time=2026-10-19T10:00:00Z level=ERROR service=payments latency_ms=2450 msg="charge failed"`
+	access := `10.0.0.8 - - [19/Oct/2026:10:00:00 +0800] "POST /api/orders HTTP/1.1" 502 173 "-" "curl/8.0"`
+	jsonLine := `{"level":"warn","http":{"status":503,"path":"/health"},"retry":true}`
+
+	tests := []struct {
+		condition string
+		line      string
+		want      bool
+	}{
+		{`level == "ERROR" && service == "payments" && latency_ms > 2000`, logfmt, true},
+		{`level == "ERROR" && latency_ms > 3000`, logfmt, false},
+		{`msg =~ "^charge" || level == "INFO"`, logfmt, true},
+		{`status >= 500 && path =~ "^/api/"`, access, true},
+		{`status >= 500 && method != 'POST'`, access, false},
+		{`!(status < 500) && bytes == 173`, access, true},
+		{`http.status == 503 && http.path !~ "^/api/" && retry`, jsonLine, true},
+		{`level == "warn" && !retry`, jsonLine, false},
+		// 缺失的字段使比较不成立
+		{`user_id == "42"`, logfmt, false},
+		{`user_id != "42"`, logfmt, false},
+		{`!(user_id == "42")`, logfmt, true},
+	}
+
+	for _, tt := range tests {
+		expr, err := CompileCondition(tt.condition)
+		if err != nil {
+			t.Fatalf("编译 %q 失败: %v", tt.condition, err)
+		}
+		if got := expr.Eval(ExtractFields(tt.line)); got != tt.want {
+			t.Errorf("%q 对 %q 求值为 %v, 期望 %v", tt.condition, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestConditionCompileErrors(t *testing.T) {
+	invalid := []string{
+		`status > true`,
+		`path =~ "(unclosed"`,
+		`service == "payments`,
+		`"a" && level == "ERROR"`,
+		`status >= 500 &&`,
+		`(status >= 500`,
+		`latency_ms + 1 > 2`,
+		`"ERROR"`,
+	}
+	for _, condition := range invalid {
+		if _, err := CompileCondition(condition); err == nil {
+			t.Errorf("条件 %q 应编译失败", condition)
+		}
+	}
+}
+
+func TestConditionExplain(t *testing.T) {
+	expr, err := CompileCondition(`status >= 500 && path =~ "^/api/" && method == "GET"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := ExtractFields(`10.0.0.8 - - [19/Oct/2026:10:00:00 +0800] "POST /api/orders HTTP/1.1" 502 173`)
+
+	result, steps := expr.Explain(fields)
+	if result {
+		t.Error("method 为 POST，条件不应成立")
+	}
+	if len(steps) != 3 {
+		t.Fatalf("步骤数 = %d, 期望 3: %+v", len(steps), steps)
+	}
+	if !steps[0].Result || !steps[1].Result || steps[2].Result {
+		t.Errorf("步骤结果不符: %+v", steps)
+	}
+	if !strings.Contains(steps[2].Values, "POST") {
+		t.Errorf("步骤应记录字段值: %+v", steps[2])
+	}
+
+	// 短路后不再记录后续比较
+	_, steps = expr.Explain(Fields{"status": 200.0})
+	if len(steps) != 1 {
+		t.Errorf("短路后步骤数 = %d, 期望 1", len(steps))
+	}
+}
+
+func TestExtractFields(t *testing.T) {
+	fields := ExtractFields(`{"level":"error","req":{"id":"abc","ms":12.5},"tags":["a","b"]}`)
+	if fields["level"] != "error" || fields["req.id"] != "abc" || fields["req.ms"] != 12.5 {
+		t.Errorf("JSON 字段解析错误: %v", fields)
+	}
+	if fields["tags"] != `["a","b"]` {
+		t.Errorf("数组应保留为 JSON 文本: %v", fields["tags"])
+	}
+
+	fields = ExtractFields(`2026-10-19 10:00:00 WARN disk usage high path=/var used="91 %"`)
+	if fields["level"] != "WARN" || fields["path"] != "/var" || fields["used"] != "91 %" {
+		t.Errorf("logfmt 字段解析错误: %v", fields)
+	}
+	if !strings.HasPrefix(fields["line"].(string), "2026-10-19") {
+		t.Errorf("line 应为整行: %v", fields["line"])
+	}
+}
+
+func TestRuleEngineCondition(t *testing.T) {
+	engine := NewRuleEngine([]config.FilterRule{
+		{ID: "slow_payments", Condition: `service == "payments" && latency_ms > 2000`, Action: ActionAlert, Priority: 10, Enabled: true},
+		{ID: "api_5xx", Pattern: `/api/`, Condition: `status >= 500`, Action: ActionHighlight, Priority: 20, Enabled: true},
+	})
+
+	if result := engine.Filter(`level=INFO service=payments latency_ms=2500`); result == nil || result.Rule.ID != "slow_payments" {
+		t.Errorf("慢支付请求应匹配 slow_payments: %+v", result)
+	}
+	if result := engine.Filter(`level=INFO service=payments latency_ms=150`); result != nil {
+		t.Errorf("快速请求不应匹配: %+v", result)
+	}
+	if result := engine.Filter(`10.0.0.8 - - [19/Oct/2026:10:00:00 +0800] "GET /api/users HTTP/1.1" 500 12`); result == nil || result.Rule.ID != "api_5xx" {
+		t.Errorf("API 5xx 应匹配 api_5xx: %+v", result)
+	}
+	// 模式匹配但条件不成立
+	if result := engine.Filter(`10.0.0.8 - - [19/Oct/2026:10:00:00 +0800] "GET /api/users HTTP/1.1" 200 12`); result != nil {
+		t.Errorf("API 200 不应匹配: %+v", result)
+	}
+
+	explanation, err := engine.ExplainRule("api_5xx", `10.0.0.8 - - [19/Oct/2026:10:00:00 +0800] "GET /api/users HTTP/1.1" 200 12`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !explanation.PatternMatched || explanation.ConditionMatched || explanation.Matched {
+		t.Errorf("解释结果不符: %+v", explanation)
+	}
+
+	if err := engine.AddRule(config.FilterRule{ID: "bad", Condition: `status > "x" &&`, Action: ActionIgnore, Enabled: true}); err == nil {
+		t.Error("无效条件的规则应被拒绝")
+	}
+}
+
+func TestRuleEngineLabels(t *testing.T) {
+	engine := NewRuleEngine([]config.FilterRule{
+		{ID: "payments_trace", Condition: `service.name == "payments" && trace_id != ""`, Action: ActionAlert, Priority: 10, Enabled: true},
+		{ID: "label_level", Condition: `labels.level == "error"`, Action: ActionHighlight, Priority: 20, Enabled: true},
+	})
+	labels := map[string]string{"service.name": "payments", "trace_id": "4bf92f3577b34da6", "level": "error"}
+
+	if result := engine.FilterLabels(`charge failed`, "", labels); result == nil || result.Rule.ID != "payments_trace" {
+		t.Errorf("元数据应作为条件字段: %+v", result)
+	}
+	if result := engine.FilterTemplate(`charge failed`, ""); result != nil {
+		t.Errorf("没有元数据时不应匹配: %+v", result)
+	}
+
+	// 日志行中的同名字段优先，元数据仍可用 labels. 前缀引用
+	labels["service.name"] = "orders"
+	if result := engine.FilterLabels(`level=INFO msg="charge failed"`, "", labels); result == nil || result.Rule.ID != "label_level" {
+		t.Errorf("应按 labels.level 匹配: %+v", result)
+	}
+}
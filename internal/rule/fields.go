@@ -0,0 +1,105 @@
+package rule
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 从日志行解析出的字段，值为 string、float64 或 bool，嵌套的 JSON 对象用点号展开（如 http.status）
+type Fields map[string]interface{}
+
+// key=value 形式的字段（logfmt），值可以用双引号包含空格
+var logfmtPattern = regexp.MustCompile(`(?:^|\s)([A-Za-z_][\w.\-]*)=("(?:[^"\\]|\\.)*"|\S*)`)
+
+// Nginx/Apache 访问日志 (common/combined)
+var accessLogPattern = regexp.MustCompile(`^(\S+) \S+ (\S+) \[([^\]]+)\] "(\S+) (\S+)[^"]*" (\d{3}) (\d+|-)`)
+
+// 日志级别关键字
+var levelPattern = regexp.MustCompile(`\b(TRACE|DEBUG|INFO|NOTICE|WARN|WARNING|ERROR|FATAL|CRITICAL|PANIC)\b`)
+
+// 从日志行解析字段：JSON 对象、logfmt 和访问日志，未解析出 level 时取行中的大写级别关键字；
+// line 为整行内容
+func ExtractFields(line string) Fields {
+	fields := make(Fields)
+
+	trimmed := strings.TrimSpace(line)
+	if start := strings.IndexByte(trimmed, '{'); start >= 0 && strings.HasSuffix(trimmed, "}") {
+		var object map[string]interface{}
+		if err := json.Unmarshal([]byte(trimmed[start:]), &object); err == nil {
+			flatten(fields, "", object)
+		}
+	}
+
+	if len(fields) == 0 {
+		if m := accessLogPattern.FindStringSubmatch(trimmed); m != nil {
+			fields["remote_addr"] = m[1]
+			if m[2] != "-" {
+				fields["remote_user"] = m[2]
+			}
+			fields["time"] = m[3]
+			fields["method"] = m[4]
+			fields["path"] = m[5]
+			fields["status"], _ = strconv.ParseFloat(m[6], 64)
+			if bytes, err := strconv.ParseFloat(m[7], 64); err == nil {
+				fields["bytes"] = bytes
+			}
+		}
+	}
+
+	for _, m := range logfmtPattern.FindAllStringSubmatch(line, -1) {
+		if _, exists := fields[m[1]]; exists {
+			continue
+		}
+		value := m[2]
+		if strings.HasPrefix(value, `"`) {
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			}
+		}
+		fields[m[1]] = value
+	}
+
+	if _, exists := fields["level"]; !exists {
+		if m := levelPattern.FindString(line); m != "" {
+			fields["level"] = m
+		}
+	}
+	if _, exists := fields["line"]; !exists {
+		fields["line"] = line
+	}
+	return fields
+}
+
+// 加入数据源提供的元数据：总是可以用 labels.<名称> 引用，日志行中没有同名字段时也可以直接用名称引用
+func addLabels(fields Fields, labels map[string]string) {
+	for key, value := range labels {
+		fields["labels."+key] = value
+	}
+	for key, value := range labels {
+		if _, exists := fields[key]; !exists {
+			fields[key] = value
+		}
+	}
+}
+
+// 展开嵌套的 JSON 对象，数组保留为 JSON 文本
+func flatten(fields Fields, prefix string, object map[string]interface{}) {
+	for key, value := range object {
+		name := key
+		if prefix != "" {
+			name = prefix + "." + key
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flatten(fields, name, v)
+		case []interface{}:
+			data, _ := json.Marshal(v)
+			fields[name] = string(data)
+		case nil:
+		default:
+			fields[name] = v
+		}
+	}
+}
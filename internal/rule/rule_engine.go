@@ -10,6 +10,14 @@ import (
 	"github.com/xurenlu/aipipe/internal/config"
 )
 
+// 规则动作
+const (
+	ActionFilter    = "filter"    // 过滤，不调用 AI
+	ActionIgnore    = "ignore"    // 忽略，不调用 AI
+	ActionAlert     = "alert"     // 直接判定为重要日志并通知，不调用 AI
+	ActionHighlight = "highlight" // 高亮输出，仍由 AI 判断重要性
+)
+
 // 过滤结果
 type FilterResult struct {
 	Rule        config.FilterRule `json:"rule"`
@@ -37,15 +45,18 @@ type RuleStats struct {
 type RuleEngine struct {
 	rules         []config.FilterRule
 	compiledRules map[string]*regexp.Regexp
+	conditions    map[string]*Expr // 编译后的条件表达式
 	stats         RuleStats
 	mutex         sync.RWMutex
+	statsMu       sync.Mutex // 保护匹配计数：匹配日志时只持有读锁，多个协程可以同时匹配
 }
 
 // 创建新的规则引擎
 func NewRuleEngine(rules []config.FilterRule) *RuleEngine {
 	re := &RuleEngine{
-		rules:         rules,
+		rules:         append([]config.FilterRule(nil), rules...),
 		compiledRules: make(map[string]*regexp.Regexp),
+		conditions:    make(map[string]*Expr),
 		stats: RuleStats{
 			MatchCounts:    make(map[string]int64),
 			ActionCounts:   make(map[string]int64),
@@ -55,7 +66,8 @@ func NewRuleEngine(rules []config.FilterRule) *RuleEngine {
 		},
 	}
 	
-	// 编译规则
+	// 编译规则，规则列表始终按优先级排序，匹配时直接按顺序遍历
+	re.sortRules()
 	re.compileRules()
 	re.updateStats()
 	
@@ -68,47 +80,107 @@ func (re *RuleEngine) compileRules() {
 	defer re.mutex.Unlock()
 	
 	re.compiledRules = make(map[string]*regexp.Regexp)
+	re.conditions = make(map[string]*Expr)
 	
 	for _, rule := range re.rules {
-		if rule.Enabled && rule.Pattern != "" {
-			if compiled, err := regexp.Compile(rule.Pattern); err == nil {
-				re.compiledRules[rule.ID] = compiled
-			}
+		if rule.Enabled {
+			// 无效的规则不会匹配任何日志，rules show 可以查看原因
+			re.compileRule(rule)
+		}
+	}
+}
+
+// 编译规则的模式和条件表达式，需持有写锁
+func (re *RuleEngine) compileRule(rule config.FilterRule) error {
+	delete(re.compiledRules, rule.ID)
+	delete(re.conditions, rule.ID)
+
+	var pattern *regexp.Regexp
+	if rule.Pattern != "" {
+		compiled, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return fmt.Errorf("编译规则失败: %w", err)
+		}
+		pattern = compiled
+	}
+	var condition *Expr
+	if rule.Condition != "" {
+		compiled, err := CompileCondition(rule.Condition)
+		if err != nil {
+			return fmt.Errorf("编译条件失败: %w", err)
 		}
+		condition = compiled
+	}
+
+	if pattern != nil {
+		re.compiledRules[rule.ID] = pattern
+	}
+	if condition != nil {
+		re.conditions[rule.ID] = condition
 	}
+	return nil
+}
+
+// 规则是否匹配：模式或模板ID任一匹配（都未设置时只看条件），并且条件表达式成立；
+// 规则编译失败时不匹配。fields 在需要时才解析
+func (re *RuleEngine) matches(rule config.FilterRule, line, templateID string, fields func() Fields) bool {
+	matched := rule.Pattern == "" && rule.Template == "" && rule.Condition != ""
+	if rule.Template != "" && rule.Template == templateID {
+		matched = true
+	}
+	if compiled, exists := re.compiledRules[rule.ID]; exists && !matched {
+		matched = compiled.MatchString(line)
+	}
+	if !matched || rule.Condition == "" {
+		return matched
+	}
+
+	condition, exists := re.conditions[rule.ID]
+	return exists && condition.Eval(fields())
 }
 
 // 过滤日志行
 func (re *RuleEngine) Filter(line string) *FilterResult {
+	return re.FilterTemplate(line, "")
+}
+
+// 过滤日志行，同时按日志模板ID匹配规则
+func (re *RuleEngine) FilterTemplate(line, templateID string) *FilterResult {
+	return re.FilterLabels(line, templateID, nil)
+}
+
+// 过滤日志行，同时按日志模板ID匹配规则，条件中可以使用数据源提供的元数据 labels
+func (re *RuleEngine) FilterLabels(line, templateID string, labels map[string]string) *FilterResult {
 	re.mutex.RLock()
 	defer re.mutex.RUnlock()
-	
-	// 按优先级排序规则
-	sortedRules := make([]config.FilterRule, len(re.rules))
-	copy(sortedRules, re.rules)
-	sort.Slice(sortedRules, func(i, j int) bool {
-		return sortedRules[i].Priority < sortedRules[j].Priority
-	})
-	
-	// 遍历规则，找到第一个匹配的
-	for _, rule := range sortedRules {
+
+	// 同一行的字段只解析一次
+	var fields Fields
+	lazyFields := func() Fields {
+		if fields == nil {
+			fields = ExtractFields(line)
+			addLabels(fields, labels)
+		}
+		return fields
+	}
+
+	// 按优先级遍历规则，找到第一个匹配的
+	for _, rule := range re.rules {
 		if !rule.Enabled {
 			continue
 		}
-		
-		if compiled, exists := re.compiledRules[rule.ID]; exists {
-			if compiled.MatchString(line) {
-				// 更新统计
-				re.updateStats()
-				re.stats.MatchCounts[rule.ID]++
-				re.stats.ActionCounts[rule.Action]++
-				re.stats.CategoryCounts[rule.Category]++
-				
-				return re.createFilterResult(rule)
-			}
+
+		if re.matches(rule, line, templateID, lazyFields) {
+			re.statsMu.Lock()
+			re.stats.MatchCounts[rule.ID]++
+			re.stats.ActionCounts[rule.Action]++
+			re.stats.CategoryCounts[rule.Category]++
+			re.statsMu.Unlock()
+
+			return re.createFilterResult(rule)
 		}
 	}
-	
+
 	return nil
 }
 
@@ -155,12 +227,8 @@ func (re *RuleEngine) AddRule(rule config.FilterRule) error {
 	}
 	
 	// 编译规则
-	if rule.Pattern != "" {
-		if compiled, err := regexp.Compile(rule.Pattern); err != nil {
-			return fmt.Errorf("编译规则失败: %w", err)
-		} else {
-			re.compiledRules[rule.ID] = compiled
-		}
+	if err := re.compileRule(rule); err != nil {
+		return err
 	}
 	
 	// 添加规则
@@ -173,6 +241,46 @@ func (re *RuleEngine) AddRule(rule config.FilterRule) error {
 	return nil
 }
 
+// 替换同一ID的规则
+func (re *RuleEngine) UpdateRule(rule config.FilterRule) error {
+	re.mutex.Lock()
+	defer re.mutex.Unlock()
+
+	for i := range re.rules {
+		if re.rules[i].ID != rule.ID {
+			continue
+		}
+
+		delete(re.compiledRules, rule.ID)
+		delete(re.conditions, rule.ID)
+		if rule.Enabled {
+			if err := re.compileRule(rule); err != nil {
+				return err
+			}
+		}
+
+		re.rules[i] = rule
+		re.sortRules()
+		re.updateStats()
+		return nil
+	}
+
+	return fmt.Errorf("未找到规则: %s", rule.ID)
+}
+
+// 获取指定ID的规则
+func (re *RuleEngine) GetRule(ruleID string) (config.FilterRule, bool) {
+	re.mutex.RLock()
+	defer re.mutex.RUnlock()
+
+	for _, rule := range re.rules {
+		if rule.ID == ruleID {
+			return rule, true
+		}
+	}
+	return config.FilterRule{}, false
+}
+
 // 删除规则
 func (re *RuleEngine) RemoveRule(ruleID string) error {
 	re.mutex.Lock()
@@ -185,6 +293,7 @@ func (re *RuleEngine) RemoveRule(ruleID string) error {
 			
 			// 删除编译的规则
 			delete(re.compiledRules, ruleID)
+			delete(re.conditions, ruleID)
 			
 			// 更新统计
 			re.updateStats()
@@ -206,15 +315,14 @@ func (re *RuleEngine) SetRuleEnabled(ruleID string, enabled bool) error {
 			re.rules[i].Enabled = enabled
 			
 			// 如果启用，编译规则
-			if enabled && re.rules[i].Pattern != "" {
-				if compiled, err := regexp.Compile(re.rules[i].Pattern); err == nil {
-					re.compiledRules[ruleID] = compiled
-				} else {
-					return fmt.Errorf("编译规则失败: %w", err)
+			if enabled {
+				if err := re.compileRule(re.rules[i]); err != nil {
+					return err
 				}
-			} else if !enabled {
+			} else {
 				// 如果禁用，删除编译的规则
 				delete(re.compiledRules, ruleID)
+				delete(re.conditions, ruleID)
 			}
 			
 			re.updateStats()
@@ -227,7 +335,7 @@ func (re *RuleEngine) SetRuleEnabled(ruleID string, enabled bool) error {
 
 // 排序规则
 func (re *RuleEngine) sortRules() {
-	sort.Slice(re.rules, func(i, j int) bool {
+	sort.SliceStable(re.rules, func(i, j int) bool {
 		return re.rules[i].Priority < re.rules[j].Priority
 	})
 }
@@ -246,27 +354,77 @@ func (re *RuleEngine) GetRules() []config.FilterRule {
 func (re *RuleEngine) GetStats() RuleStats {
 	re.mutex.RLock()
 	defer re.mutex.RUnlock()
-	
-	return re.stats
+	re.statsMu.Lock()
+	defer re.statsMu.Unlock()
+
+	stats := re.stats
+	stats.MatchCounts = copyCounts(re.stats.MatchCounts)
+	stats.ActionCounts = copyCounts(re.stats.ActionCounts)
+	stats.CategoryCounts = copyCounts(re.stats.CategoryCounts)
+	return stats
+}
+
+func copyCounts(counts map[string]int64) map[string]int64 {
+	copied := make(map[string]int64, len(counts))
+	for k, v := range counts {
+		copied[k] = v
+	}
+	return copied
 }
 
-// 清除缓存
+// 清除缓存，重新编译所有规则（compileRules 自己获取写锁）
 func (re *RuleEngine) ClearCache() {
-	re.mutex.Lock()
-	defer re.mutex.Unlock()
-	
-	re.compiledRules = make(map[string]*regexp.Regexp)
 	re.compileRules()
 }
 
-// 测试规则
-func (re *RuleEngine) TestRule(ruleID, testLine string) (bool, error) {
-	re.mutex.RLock()
-	defer re.mutex.RUnlock()
-	
-	if compiled, exists := re.compiledRules[ruleID]; exists {
-		return compiled.MatchString(testLine), nil
+// 规则对一行日志的求值过程
+type Explanation struct {
+	Rule             config.FilterRule `json:"rule"`
+	Fields           Fields            `json:"fields"`            // 解析出的字段
+	TemplateID       string            `json:"template_id"`       // 日志行的模板ID
+	PatternMatched   bool              `json:"pattern_matched"`   // 模式或模板ID是否匹配（都未设置时为 true）
+	ConditionMatched bool              `json:"condition_matched"` // 条件是否成立（未设置条件时为 true）
+	Steps            []Step            `json:"steps"`             // 条件的求值步骤
+	Matched          bool              `json:"matched"`           // 规则是否匹配
+}
+
+// 解释规则对一行日志的求值过程，规则无效时返回错误
+func (re *RuleEngine) ExplainRule(ruleID, line, templateID string) (*Explanation, error) {
+	rule, exists := re.GetRule(ruleID)
+	if !exists {
+		return nil, fmt.Errorf("未找到规则: %s", ruleID)
 	}
-	
-	return false, fmt.Errorf("规则未找到或未编译: %s", ruleID)
+	if err := ValidateRule(rule); err != nil {
+		return nil, err
+	}
+
+	explanation := &Explanation{
+		Rule:             rule,
+		Fields:           ExtractFields(line),
+		TemplateID:       templateID,
+		PatternMatched:   rule.Pattern == "" && rule.Template == "",
+		ConditionMatched: true,
+	}
+	if rule.Template != "" && rule.Template == templateID {
+		explanation.PatternMatched = true
+	}
+	if rule.Pattern != "" && !explanation.PatternMatched {
+		explanation.PatternMatched = regexp.MustCompile(rule.Pattern).MatchString(line)
+	}
+	if rule.Condition != "" {
+		condition, _ := CompileCondition(rule.Condition)
+		explanation.ConditionMatched, explanation.Steps = condition.Explain(explanation.Fields)
+	}
+	explanation.Matched = explanation.PatternMatched && explanation.ConditionMatched
+	return explanation, nil
+}
+
+// 测试规则是否匹配一行日志（模式、模板ID和条件），templateID 为日志行的模板ID，可以为空；
+// 规则不存在或无效时返回错误
+func (re *RuleEngine) TestRule(ruleID, testLine, templateID string) (bool, error) {
+	explanation, err := re.ExplainRule(ruleID, testLine, templateID)
+	if err != nil {
+		return false, err
+	}
+	return explanation.Matched, nil
 }
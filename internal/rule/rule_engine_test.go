@@ -0,0 +1,76 @@
+package rule
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/xurenlu/aipipe/internal/config"
+)
+
+// 测试规则按优先级匹配，并发匹配和修改规则时计数准确
+func TestRuleEngineConcurrentFilter(t *testing.T) {
+	engine := NewRuleEngine([]config.FilterRule{
+		{ID: "low", Pattern: `ERROR`, Action: ActionHighlight, Priority: 20, Enabled: true},
+		{ID: "high", Pattern: `ERROR payment`, Action: ActionAlert, Priority: 10, Enabled: true},
+	})
+	if result := engine.Filter("ERROR payment failed"); result == nil || result.Rule.ID != "high" {
+		t.Fatalf("应匹配优先级更高的规则: %+v", result)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				engine.Filter("ERROR payment failed")
+			}
+			engine.AddRule(config.FilterRule{ID: fmt.Sprintf("extra_%d", i), Pattern: `never`, Action: ActionIgnore, Priority: i, Enabled: true})
+			engine.GetStats()
+		}(i)
+	}
+	wg.Wait()
+
+	stats := engine.GetStats()
+	if stats.MatchCounts["high"] != 801 || stats.ActionCounts[ActionAlert] != 801 {
+		t.Errorf("匹配计数 = %d, 期望 801", stats.MatchCounts["high"])
+	}
+	if stats.TotalRules != 10 {
+		t.Errorf("规则数 = %d, 期望 10", stats.TotalRules)
+	}
+}
+
+func TestRuleEngineTestRule(t *testing.T) {
+	engine := NewRuleEngine([]config.FilterRule{
+		{ID: "slow", Condition: `latency_ms > 2000`, Action: ActionAlert, Enabled: true},
+		{ID: "tpl", Template: "abc123", Action: ActionIgnore, Enabled: true},
+		{ID: "re", Pattern: `timeout`, Action: ActionAlert, Enabled: true},
+	})
+
+	tests := []struct {
+		id, line, template string
+		want               bool
+	}{
+		{"slow", "latency_ms=2500", "", true},
+		{"slow", "latency_ms=100", "", false},
+		{"tpl", "GET /health 200", "abc123", true},
+		{"tpl", "GET /health 200", "other", false},
+		{"re", "read timeout", "", true},
+	}
+	for _, tt := range tests {
+		got, err := engine.TestRule(tt.id, tt.line, tt.template)
+		if err != nil || got != tt.want {
+			t.Errorf("TestRule(%s, %q) = %v, %v, 期望 %v", tt.id, tt.line, got, err, tt.want)
+		}
+	}
+	if _, err := engine.TestRule("missing", "x", ""); err == nil {
+		t.Error("不存在的规则应返回错误")
+	}
+
+	// 重新编译规则不应死锁
+	engine.ClearCache()
+	if result := engine.Filter("read timeout"); result == nil || result.Rule.ID != "re" {
+		t.Errorf("重新编译后规则应仍然生效: %+v", result)
+	}
+}
@@ -0,0 +1,52 @@
+package rule
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/xurenlu/aipipe/internal/config"
+)
+
+// highlight 规则支持的颜色及终端转义码
+var HighlightColors = map[string]string{
+	"red":     "\033[31m",
+	"green":   "\033[32m",
+	"yellow":  "\033[33m",
+	"blue":    "\033[34m",
+	"magenta": "\033[35m",
+	"cyan":    "\033[36m",
+}
+
+// 检查规则是否有效：ID 非空、模式和条件可以编译、动作和颜色受支持
+func ValidateRule(r config.FilterRule) error {
+	if strings.TrimSpace(r.ID) == "" {
+		return fmt.Errorf("规则ID不能为空")
+	}
+	if r.Pattern == "" && r.Template == "" && r.Condition == "" {
+		return fmt.Errorf("规则 %s 需要指定模式 (pattern)、日志模板ID (template) 或条件 (condition)", r.ID)
+	}
+	if r.Pattern != "" {
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return fmt.Errorf("规则 %s 的模式无效: %w", r.ID, err)
+		}
+	}
+	if r.Condition != "" {
+		if _, err := CompileCondition(r.Condition); err != nil {
+			return fmt.Errorf("规则 %s 的条件无效: %w", r.ID, err)
+		}
+	}
+
+	switch r.Action {
+	case ActionFilter, ActionIgnore, ActionAlert, ActionHighlight:
+	default:
+		return fmt.Errorf("规则 %s 的动作不支持: %q (可选: filter, ignore, alert, highlight)", r.ID, r.Action)
+	}
+
+	if r.Color != "" {
+		if _, ok := HighlightColors[r.Color]; !ok {
+			return fmt.Errorf("规则 %s 的颜色不支持: %q (可选: red, green, yellow, blue, magenta, cyan)", r.ID, r.Color)
+		}
+	}
+	return nil
+}
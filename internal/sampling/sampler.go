@@ -0,0 +1,254 @@
+package sampling
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/config"
+)
+
+// 采样结果
+type Decision struct {
+	Pass       bool // 是否放行（送去分析）
+	First      bool // 是否为该数据源中新出现的模板
+	Suppressed int  // 放行时附带的此前被抑制的相似日志数
+}
+
+// 一段时间内被抑制、之后没有放行的相似日志汇总
+type Summary struct {
+	Source  string    `json:"source"`  // 数据源名称
+	Example string    `json:"example"` // 第一条被抑制的日志
+	Count   int       `json:"count"`   // 被抑制的数量
+	First   time.Time `json:"first"`   // 第一条被抑制的时间
+	Last    time.Time `json:"last"`    // 最后一条被抑制的时间
+}
+
+// 单个数据源的采样统计
+type SourceStats struct {
+	Source     string `json:"source"`
+	Passed     uint64 `json:"passed"`     // 放行的日志数
+	Suppressed uint64 `json:"suppressed"` // 被抑制的日志数
+}
+
+// 令牌桶，rate 小于 0 表示不限制
+type bucket struct {
+	tokens float64
+	rate   float64
+	burst  float64
+	last   time.Time
+}
+
+func newBucket(rate float64, burst int, now time.Time) *bucket {
+	return &bucket{tokens: float64(burst), rate: rate, burst: float64(burst), last: now}
+}
+
+func (b *bucket) take(now time.Time) bool {
+	if b.rate < 0 {
+		return true
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (b *bucket) refund() {
+	if b.rate < 0 {
+		return
+	}
+	if b.tokens++; b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+type sourceState struct {
+	bucket     *bucket
+	passed     uint64
+	suppressed uint64
+}
+
+type templateState struct {
+	source     string
+	bucket     *bucket
+	lastSeen   time.Time
+	suppressed int       // 待报告的被抑制数量
+	first      time.Time // 第一条待报告日志被抑制的时间
+	last       time.Time
+	example    string
+}
+
+// 日志洪峰采样器：每个数据源和数据源中的每个模板各有一个令牌桶，
+// 超过速率的日志被抑制，只记录数量；新模板的第一条日志总是放行。
+// 模板使用模板挖掘（Drain）匹配出的模板ID，没有模板ID的日志只按数据源的速率采样
+type Sampler struct {
+	config    config.SamplingConfig
+	sources   map[string]*sourceState
+	templates map[string]*templateState
+	evicted   []Summary // 因模板数超限被移除、尚未报告的汇总
+	mutex     sync.Mutex
+}
+
+// 创建采样器，未设置的参数使用默认值
+func NewSampler(cfg config.SamplingConfig) *Sampler {
+	if cfg.SourceRate == 0 {
+		cfg.SourceRate = 50
+	}
+	if cfg.SourceBurst <= 0 {
+		cfg.SourceBurst = 200
+	}
+	if cfg.TemplateRate == 0 {
+		cfg.TemplateRate = 1
+	}
+	if cfg.TemplateBurst <= 0 {
+		cfg.TemplateBurst = 10
+	}
+	if cfg.ReportInterval <= 0 {
+		cfg.ReportInterval = time.Minute
+	}
+	if cfg.MaxTemplates <= 0 {
+		cfg.MaxTemplates = 10000
+	}
+
+	return &Sampler{
+		config:    cfg,
+		sources:   make(map[string]*sourceState),
+		templates: make(map[string]*templateState),
+	}
+}
+
+// 汇总输出的间隔
+func (s *Sampler) ReportInterval() time.Duration {
+	return s.config.ReportInterval
+}
+
+// 判断一条日志是否放行，templateID 为日志匹配的模板ID（未启用模板挖掘时为空）
+func (s *Sampler) Sample(source, templateID, line string, now time.Time) Decision {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	src, exists := s.sources[source]
+	if !exists {
+		src = &sourceState{bucket: newBucket(s.config.SourceRate, s.config.SourceBurst, now)}
+		s.sources[source] = src
+	}
+
+	key := source + "\x00" + templateID
+	tmpl, exists := s.templates[key]
+	if !exists {
+		if len(s.templates) >= s.config.MaxTemplates {
+			s.evictOne()
+		}
+		// 没有模板ID的日志共用一个不限速的模板，只记录被抑制的数量
+		rate := s.config.TemplateRate
+		if templateID == "" {
+			rate = -1
+		}
+		tmpl = &templateState{source: source, bucket: newBucket(rate, s.config.TemplateBurst, now)}
+		s.templates[key] = tmpl
+		tmpl.bucket.take(now)
+		tmpl.lastSeen = now
+
+		// 新模板总是放行，数据源的令牌不足时也不抑制
+		src.bucket.take(now)
+		src.passed++
+		return Decision{Pass: true, First: true}
+	}
+	tmpl.lastSeen = now
+
+	if tmpl.bucket.take(now) {
+		if src.bucket.take(now) {
+			src.passed++
+			decision := Decision{Pass: true, Suppressed: tmpl.suppressed}
+			tmpl.suppressed = 0
+			tmpl.example = ""
+			return decision
+		}
+		tmpl.bucket.refund()
+	}
+
+	src.suppressed++
+	if tmpl.suppressed == 0 {
+		tmpl.first = now
+		tmpl.example = line
+	}
+	tmpl.suppressed++
+	tmpl.last = now
+	return Decision{}
+}
+
+// 模板数超过上限时移除一个模板，待报告的数量保留到下次 Flush
+func (s *Sampler) evictOne() {
+	for key, tmpl := range s.templates {
+		if tmpl.suppressed > 0 {
+			s.evicted = append(s.evicted, tmpl.summary())
+		}
+		delete(s.templates, key)
+		return
+	}
+}
+
+func (t *templateState) summary() Summary {
+	return Summary{Source: t.source, Example: t.example, Count: t.suppressed, First: t.first, Last: t.last}
+}
+
+// 返回第一条被抑制超过 ReportInterval、期间没有放行的相似日志汇总，并清理长时间未出现的模板
+func (s *Sampler) Flush(now time.Time) []Summary {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.flush(now, false)
+}
+
+// 返回所有待报告的汇总，用于退出前输出
+func (s *Sampler) FlushAll() []Summary {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.flush(time.Now(), true)
+}
+
+func (s *Sampler) flush(now time.Time, all bool) []Summary {
+	summaries := s.evicted
+	s.evicted = nil
+
+	interval := s.config.ReportInterval
+	for key, tmpl := range s.templates {
+		if tmpl.suppressed > 0 && (all || now.Sub(tmpl.first) >= interval) {
+			summaries = append(summaries, tmpl.summary())
+			tmpl.suppressed = 0
+			tmpl.example = ""
+		}
+		// 令牌桶早已回满的模板不再需要跟踪
+		if tmpl.suppressed == 0 && now.Sub(tmpl.lastSeen) >= 10*interval {
+			delete(s.templates, key)
+		}
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Source != summaries[j].Source {
+			return summaries[i].Source < summaries[j].Source
+		}
+		return summaries[i].First.Before(summaries[j].First)
+	})
+	return summaries
+}
+
+// 各数据源的采样统计，按名称排序
+func (s *Sampler) Stats() []SourceStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats := make([]SourceStats, 0, len(s.sources))
+	for name, src := range s.sources {
+		stats = append(stats, SourceStats{Source: name, Passed: src.passed, Suppressed: src.suppressed})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Source < stats[j].Source })
+	return stats
+}
@@ -0,0 +1,129 @@
+package sampling
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/config"
+)
+
+func TestSamplerTemplateRate(t *testing.T) {
+	s := NewSampler(config.SamplingConfig{SourceRate: -1, TemplateRate: 1, TemplateBurst: 2, ReportInterval: time.Minute})
+	now := time.Now()
+
+	passed := 0
+	for i := 0; i < 100; i++ {
+		d := s.Sample("app", "conn", fmt.Sprintf("connection refused from 10.0.0.%d", i%250), now)
+		if i == 0 && !d.First {
+			t.Error("第一条日志应标记为新模板")
+		}
+		if d.Pass {
+			passed++
+		}
+	}
+	if passed != 2 {
+		t.Errorf("放行 %d 条, 期望 2 条 (突发容量)", passed)
+	}
+
+	// 新模板的第一条总是放行
+	if d := s.Sample("app", "disk", "disk full on /dev/sda1", now); !d.Pass || !d.First {
+		t.Errorf("新模板的第一条应放行: %+v", d)
+	}
+
+	// 令牌恢复后放行的日志带上此前被抑制的数量
+	d := s.Sample("app", "conn", "connection refused from 10.0.0.1", now.Add(time.Second))
+	if !d.Pass || d.Suppressed != 98 {
+		t.Errorf("结果 = %+v, 期望放行并附带 98 条被抑制", d)
+	}
+
+	stats := s.Stats()
+	if len(stats) != 1 || stats[0].Passed != 4 || stats[0].Suppressed != 98 {
+		t.Errorf("统计 = %+v", stats)
+	}
+}
+
+func TestSamplerSourceRate(t *testing.T) {
+	s := NewSampler(config.SamplingConfig{SourceRate: 1, SourceBurst: 3, TemplateRate: -1})
+	now := time.Now()
+
+	passed := 0
+	for i := 0; i < 10; i++ {
+		if s.Sample("app", "health", "GET /health 200", now).Pass {
+			passed++
+		}
+	}
+	if passed != 3 {
+		t.Errorf("放行 %d 条, 期望 3 条", passed)
+	}
+
+	// 其他数据源不受影响
+	if !s.Sample("db", "health", "GET /health 200", now).Pass {
+		t.Error("不同数据源的令牌桶应相互独立")
+	}
+}
+
+// 测试没有模板ID的日志只按数据源的速率采样，被抑制的数量仍附加在下一条放行的日志上
+func TestSamplerWithoutTemplate(t *testing.T) {
+	s := NewSampler(config.SamplingConfig{SourceRate: 1, SourceBurst: 2, TemplateRate: 1, TemplateBurst: 1})
+	now := time.Now()
+
+	passed := 0
+	for i := 0; i < 5; i++ {
+		if s.Sample("app", "", fmt.Sprintf("request %d done", i), now).Pass {
+			passed++
+		}
+	}
+	if passed != 2 {
+		t.Errorf("放行 %d 条, 期望 2 条 (数据源突发容量)", passed)
+	}
+
+	d := s.Sample("app", "", "request 5 done", now.Add(time.Second))
+	if !d.Pass || d.Suppressed != 3 {
+		t.Errorf("结果 = %+v, 期望放行并附带 3 条被抑制", d)
+	}
+}
+
+func TestSamplerFlush(t *testing.T) {
+	s := NewSampler(config.SamplingConfig{SourceRate: -1, TemplateRate: 1, TemplateBurst: 1, ReportInterval: time.Minute})
+	now := time.Now()
+
+	for i := 0; i < 5; i++ {
+		s.Sample("app", "retry", fmt.Sprintf("retry %d failed", i), now.Add(time.Duration(i)*time.Millisecond))
+	}
+
+	if summaries := s.Flush(now.Add(time.Second)); len(summaries) != 0 {
+		t.Errorf("未到汇总间隔不应输出: %+v", summaries)
+	}
+
+	summaries := s.Flush(now.Add(2 * time.Minute))
+	if len(summaries) != 1 || summaries[0].Count != 4 || summaries[0].Example != "retry 1 failed" || summaries[0].Source != "app" {
+		t.Fatalf("汇总 = %+v", summaries)
+	}
+	if summaries := s.FlushAll(); len(summaries) != 0 {
+		t.Errorf("已报告的数量不应重复输出: %+v", summaries)
+	}
+}
+
+func TestSamplerMaxTemplates(t *testing.T) {
+	s := NewSampler(config.SamplingConfig{SourceRate: -1, TemplateRate: 1, TemplateBurst: 1, MaxTemplates: 2})
+	now := time.Now()
+
+	s.Sample("app", "alpha", "alpha happened", now)
+	s.Sample("app", "alpha", "alpha happened", now)
+	s.Sample("app", "beta", "beta happened", now)
+	s.Sample("app", "gamma", "gamma happened", now)
+
+	if len(s.templates) > 2 {
+		t.Errorf("跟踪 %d 个模板, 超过上限 2", len(s.templates))
+	}
+
+	// 被移除模板的抑制数量不会丢失
+	total := 0
+	for _, summary := range s.FlushAll() {
+		total += summary.Count
+	}
+	if total != 1 {
+		t.Errorf("汇总的抑制数量 %d, 期望 1", total)
+	}
+}
@@ -0,0 +1,186 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/input"
+	"github.com/xurenlu/aipipe/internal/record"
+)
+
+// 命令重启等待时间的默认值
+const (
+	DefaultRestartDelay    = time.Second
+	DefaultMaxRestartDelay = time.Minute
+)
+
+// 命令数据源：运行任意命令（如 kubectl logs -f、docker logs -f、ssh host tail -F），
+// 分别读取 stdout 和 stderr，命令退出后按指数退避重启
+type CommandSource struct {
+	name    string
+	format  string
+	config  config.CommandConfig
+	options input.LineOptions
+	emitMu  sync.Mutex
+}
+
+// 创建命令数据源，未配置 command 时使用 path
+func NewCommandSource(cfg config.SourceConfig, options input.LineOptions) (*CommandSource, error) {
+	command := cfg.Command
+	if command.Command == "" {
+		command.Command = cfg.Path
+	}
+	if command.Command == "" {
+		return nil, fmt.Errorf("数据源 %s 未配置命令", cfg.Name)
+	}
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+
+	if command.RestartDelay <= 0 {
+		command.RestartDelay = DefaultRestartDelay
+	}
+	if command.MaxRestartDelay < command.RestartDelay {
+		command.MaxRestartDelay = DefaultMaxRestartDelay
+		if command.MaxRestartDelay < command.RestartDelay {
+			command.MaxRestartDelay = command.RestartDelay
+		}
+	}
+
+	return &CommandSource{
+		name:    cfg.Name,
+		format:  cfg.Format,
+		config:  command,
+		options: options,
+	}, nil
+}
+
+// 数据源名称
+func (s *CommandSource) Name() string {
+	return s.name
+}
+
+// 运行命令直到 ctx 取消，命令退出后自动重启
+func (s *CommandSource) Run(ctx context.Context, emit func(*record.Record) bool) error {
+	delay := s.config.RestartDelay
+	for {
+		started := time.Now()
+		err := s.runOnce(ctx, emit)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		// 运行时间超过退避上限视为正常运行过，重新从初始等待时间开始
+		if time.Since(started) > s.config.MaxRestartDelay {
+			delay = s.config.RestartDelay
+		}
+
+		if err != nil {
+			fmt.Printf("⚠️  数据源 %s 命令退出: %v，%s 后重启\n", s.name, err, delay)
+		} else {
+			fmt.Printf("⚠️  数据源 %s 命令已结束，%s 后重启\n", s.name, delay)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > s.config.MaxRestartDelay {
+			delay = s.config.MaxRestartDelay
+		}
+	}
+}
+
+// 运行一次命令，读完 stdout 和 stderr 后返回
+func (s *CommandSource) runOnce(ctx context.Context, emit func(*record.Record) bool) error {
+	cmd := s.command(ctx)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("创建输出管道失败: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("创建错误输出管道失败: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("启动命令失败: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go s.readStream(stdout, "stdout", emit, &wg)
+	go s.readStream(stderr, "stderr", emit, &wg)
+
+	// 子进程可能继承管道，取消时主动关闭，避免一直等待读取结束
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stdout.Close()
+			stderr.Close()
+		case <-done:
+		}
+	}()
+
+	// 必须先读完管道再 Wait，否则可能丢失最后的输出
+	wg.Wait()
+	return cmd.Wait()
+}
+
+// 构造命令：指定 args 时直接执行，否则通过 shell 执行命令行
+func (s *CommandSource) command(ctx context.Context) *exec.Cmd {
+	var cmd *exec.Cmd
+	switch {
+	case len(s.config.Args) > 0:
+		cmd = exec.CommandContext(ctx, s.config.Command, s.config.Args...)
+	case runtime.GOOS == "windows":
+		cmd = exec.CommandContext(ctx, "cmd", "/C", s.config.Command)
+	default:
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", s.config.Command)
+	}
+
+	cmd.Dir = s.config.Dir
+	if len(s.config.Env) > 0 {
+		cmd.Env = append(os.Environ(), s.config.Env...)
+	}
+	return cmd
+}
+
+// 逐行读取一个输出流，每行作为一条记录，stream 标签区分 stdout 和 stderr
+func (s *CommandSource) readStream(r io.Reader, stream string, emit func(*record.Record) bool, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	reader := input.NewLineReader(r, s.options)
+	for {
+		line, err := reader.ReadLine()
+		if err != nil {
+			return
+		}
+
+		rec := &record.Record{
+			Source:  s.name,
+			Format:  s.format,
+			Message: line,
+			Origin:  stream,
+		}
+		rec.SetLabel("source", s.name)
+		rec.SetLabel("stream", stream)
+
+		s.emitMu.Lock()
+		emit(rec)
+		s.emitMu.Unlock()
+	}
+}
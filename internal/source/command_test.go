@@ -0,0 +1,83 @@
+//go:build !windows
+
+package source
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/input"
+	"github.com/xurenlu/aipipe/internal/record"
+)
+
+func TestCommandSource(t *testing.T) {
+	src, err := NewCommandSource(config.SourceConfig{
+		Name:   "api",
+		Format: "java",
+		Command: config.CommandConfig{
+			Command:      "echo out; echo err >&2",
+			RestartDelay: 10 * time.Millisecond,
+		},
+	}, input.DefaultLineOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := make(chan *record.Record, 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- src.Run(ctx, func(rec *record.Record) bool { records <- rec; return true })
+	}()
+
+	// 命令退出后会被重启，收到两轮输出
+	streams := map[string]int{}
+	timeout := time.After(5 * time.Second)
+	for streams["stdout"] < 2 || streams["stderr"] < 2 {
+		select {
+		case rec := <-records:
+			stream := rec.Labels["stream"]
+			want := map[string]string{"stdout": "out", "stderr": "err"}[stream]
+			if rec.Message != want || rec.Source != "api" || rec.Format != "java" || rec.Labels["source"] != "api" {
+				t.Fatalf("unexpected record: %+v", rec)
+			}
+			streams[stream]++
+		case <-timeout:
+			t.Fatalf("timeout, got %v", streams)
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
+
+func TestCommandSourceCancel(t *testing.T) {
+	// 子进程继承输出管道时，取消后也应立即返回
+	src, err := NewCommandSource(config.SourceConfig{
+		Name:    "sleep",
+		Command: config.CommandConfig{Command: "sleep 30 & sleep 30"},
+	}, input.DefaultLineOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := src.Run(ctx, func(*record.Record) bool { return true }); err != nil {
+		t.Errorf("Run: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run took %s after cancel", elapsed)
+	}
+}
@@ -0,0 +1,421 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/input"
+	"github.com/xurenlu/aipipe/internal/monitor"
+	"github.com/xurenlu/aipipe/internal/record"
+)
+
+// 容器运行时类型
+const (
+	ContainerDocker = "docker" // Docker json-file 日志
+	ContainerCRI    = "cri"    // Kubernetes CRI 日志 (containerd, CRI-O)
+)
+
+// 容器日志默认目录
+const (
+	DefaultDockerRoot    = "/var/lib/docker/containers"
+	DefaultPodsRoot      = "/var/log/pods"
+	DefaultContainerLink = "/var/log/containers"
+	DefaultCRIStateDir   = "/run/containerd/io.containerd.runtime.v2.task/k8s.io"
+)
+
+// 拼接中的不完整行最多保留的字节数
+const maxPartialSize = 1024 * 1024
+
+// 没有找到容器ID时（软链接可能还没创建），重新读取元数据的间隔
+const metadataRetry = 10 * time.Second
+
+// 容器元数据
+type containerMeta struct {
+	ID        string
+	Name      string
+	Image     string
+	Namespace string
+	Pod       string
+	PodUID    string
+	Labels    map[string]string
+
+	retryAt time.Time // 元数据不完整时，在此时间之后重新读取
+}
+
+// 容器日志数据源：发现并读取节点上的 Docker json-file 或 Kubernetes CRI 日志文件，
+// 合并被拆分的长行，并为每条记录添加命名空间、Pod、容器和镜像信息
+type ContainerSource struct {
+	name      string
+	format    string
+	runtime   string
+	root      string
+	linksDir  string
+	stateDir  string
+	startFrom string
+	poll      bool          // 强制轮询（容器 overlay 等收不到文件事件时）
+	interval  time.Duration // 轮询间隔，为 0 时使用默认值
+	options   input.LineOptions
+	positions *monitor.PositionStore
+
+	metas   map[string]*containerMeta // 日志文件路径 -> 元数据
+	partial map[string]*strings.Builder
+	mutex   sync.Mutex
+}
+
+// 创建容器日志数据源，positions 为 nil 时不保存读取位置
+func NewContainerSource(cfg config.SourceConfig, options input.LineOptions, positions *monitor.PositionStore) (*ContainerSource, error) {
+	s := &ContainerSource{
+		name:      cfg.Name,
+		format:    cfg.Format,
+		root:      cfg.Path,
+		linksDir:  cfg.Container.LinksDir,
+		stateDir:  cfg.Container.StateDir,
+		startFrom: monitor.StartFromCheckpoint,
+		poll:      cfg.Poll,
+		interval:  cfg.PollInterval,
+		options:   options,
+		positions: positions,
+		metas:     make(map[string]*containerMeta),
+		partial:   make(map[string]*strings.Builder),
+	}
+	if positions == nil {
+		s.startFrom = monitor.StartFromEnd
+	}
+
+	switch cfg.Type {
+	case ContainerDocker:
+		s.runtime = ContainerDocker
+		if s.root == "" {
+			s.root = DefaultDockerRoot
+		}
+	case ContainerCRI, "kubernetes":
+		s.runtime = ContainerCRI
+		if s.root == "" {
+			s.root = DefaultPodsRoot
+		}
+		if s.linksDir == "" {
+			s.linksDir = DefaultContainerLink
+		}
+		if s.stateDir == "" {
+			s.stateDir = DefaultCRIStateDir
+		}
+	default:
+		return nil, fmt.Errorf("不支持的容器日志类型: %s (可选: docker, cri)", cfg.Type)
+	}
+
+	return s, nil
+}
+
+// 数据源名称
+func (s *ContainerSource) Name() string {
+	return s.name
+}
+
+// 设置启动时已有日志文件的读取位置 (beginning, end, checkpoint)
+func (s *ContainerSource) SetStartFrom(from string) {
+	s.startFrom = from
+}
+
+// 日志文件匹配模式
+func (s *ContainerSource) pattern() string {
+	if s.runtime == ContainerDocker {
+		return filepath.Join(s.root, "*", "*-json.log")
+	}
+	return filepath.Join(s.root, "*", "*", "*.log")
+}
+
+// 监控日志文件直到 ctx 取消
+func (s *ContainerSource) Run(ctx context.Context, emit func(*record.Record) bool) error {
+	fileMonitor, err := monitor.NewFileMonitor()
+	if err != nil {
+		return err
+	}
+	defer fileMonitor.Stop()
+
+	if err := fileMonitor.SetStartFrom(s.startFrom); err != nil {
+		return err
+	}
+	if s.interval > 0 {
+		if err := fileMonitor.SetPollInterval(s.interval); err != nil {
+			return err
+		}
+	}
+	fileMonitor.SetForcePoll(s.poll)
+	if s.positions != nil {
+		fileMonitor.EnableCheckpoints(s.positions, 0)
+	}
+
+	_, err = fileMonitor.AddSource(monitor.FileSource{
+		Pattern:  s.pattern(),
+		Options:  s.options,
+		OnRemove: s.forget,
+	}, func(path, line string) {
+		if rec := s.ParseLine(path, line); rec != nil {
+			emit(rec)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("监控容器日志目录 %s 失败: %w", s.root, err)
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+// 解析一行容器日志；长行被拆分时返回 nil，直到读到最后一部分
+func (s *ContainerSource) ParseLine(path, line string) *record.Record {
+	var (
+		at      time.Time
+		stream  string
+		message string
+		partial bool
+		err     error
+	)
+	if s.runtime == ContainerDocker {
+		at, stream, message, partial, err = parseDockerLine(line)
+	} else {
+		at, stream, message, partial, err = parseCRILine(line)
+	}
+	if err != nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// 同一文件中 stdout 和 stderr 的拆分行分别拼接
+	key := path + "\x00" + stream
+	if partial {
+		buf := s.partial[key]
+		if buf == nil {
+			buf = &strings.Builder{}
+			s.partial[key] = buf
+		}
+		if buf.Len()+len(message) <= maxPartialSize {
+			buf.WriteString(message)
+		}
+		return nil
+	}
+	if buf := s.partial[key]; buf != nil {
+		buf.WriteString(message)
+		message = buf.String()
+		delete(s.partial, key)
+	}
+
+	rec := &record.Record{
+		Time:    at,
+		Source:  s.name,
+		Format:  s.format,
+		Message: message,
+		Origin:  key,
+	}
+	rec.SetLabel("path", path)
+	rec.SetLabel("stream", stream)
+	s.enrich(rec, s.metadata(path))
+	return rec
+}
+
+// 解析 Docker json-file 日志行: {"log":"...\n","stream":"stdout","time":"..."}
+// 超过 16KB 的行被拆分为多条，只有最后一条以换行结尾
+func parseDockerLine(line string) (time.Time, string, string, bool, error) {
+	var entry struct {
+		Log    string `json:"log"`
+		Stream string `json:"stream"`
+		Time   string `json:"time"`
+	}
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		return time.Time{}, "", "", false, fmt.Errorf("解析 docker 日志失败: %w", err)
+	}
+
+	at, _ := time.Parse(time.RFC3339Nano, entry.Time)
+	partial := !strings.HasSuffix(entry.Log, "\n")
+	message := strings.TrimSuffix(strings.TrimSuffix(entry.Log, "\n"), "\r")
+	return at, entry.Stream, message, partial, nil
+}
+
+// 解析 CRI 日志行: <time> <stream> <P|F> <message>，P 表示被拆分的部分行
+func parseCRILine(line string) (time.Time, string, string, bool, error) {
+	parts := strings.SplitN(line, " ", 4)
+	if len(parts) < 3 {
+		return time.Time{}, "", "", false, fmt.Errorf("无效的 CRI 日志行")
+	}
+
+	at, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, "", "", false, fmt.Errorf("无效的 CRI 时间戳: %s", parts[0])
+	}
+
+	message := ""
+	if len(parts) == 4 {
+		message = parts[3]
+	}
+	// 部分旧版本运行时没有 P/F 标记
+	switch parts[2] {
+	case "P":
+		return at, parts[1], message, true, nil
+	case "F":
+		return at, parts[1], message, false, nil
+	}
+	return at, parts[1], strings.Join(parts[2:], " "), false, nil
+}
+
+// 为记录添加容器元数据
+func (s *ContainerSource) enrich(rec *record.Record, meta *containerMeta) {
+	if meta == nil {
+		return
+	}
+	rec.SetLabel("container_id", meta.ID)
+	rec.SetLabel("container", meta.Name)
+	rec.SetLabel("image", meta.Image)
+	rec.SetLabel("namespace", meta.Namespace)
+	rec.SetLabel("pod", meta.Pod)
+	rec.SetLabel("pod_uid", meta.PodUID)
+	for key, value := range meta.Labels {
+		rec.SetLabel("label."+key, value)
+	}
+}
+
+// 获取日志文件对应的容器元数据（缓存），读取失败时下次重试，没有找到容器ID时稍后重试
+func (s *ContainerSource) metadata(path string) *containerMeta {
+	if meta, ok := s.metas[path]; ok && (meta.retryAt.IsZero() || time.Now().Before(meta.retryAt)) {
+		return meta
+	}
+
+	var meta *containerMeta
+	if s.runtime == ContainerDocker {
+		meta = readDockerMeta(filepath.Dir(path))
+	} else {
+		meta = s.readCRIMeta(path)
+	}
+	if meta != nil {
+		if meta.ID == "" {
+			meta.retryAt = time.Now().Add(metadataRetry)
+		}
+		s.metas[path] = meta
+	}
+	return meta
+}
+
+// 文件停止监控后清理它的元数据缓存和未拼接完的行
+func (s *ContainerSource) forget(path string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.metas, path)
+	prefix := path + "\x00"
+	for key := range s.partial {
+		if strings.HasPrefix(key, prefix) {
+			delete(s.partial, key)
+		}
+	}
+}
+
+// 读取 Docker 容器目录中的 config.v2.json
+func readDockerMeta(dir string) *containerMeta {
+	data, err := os.ReadFile(filepath.Join(dir, "config.v2.json"))
+	if err != nil {
+		return nil
+	}
+
+	var cfg struct {
+		ID     string `json:"ID"`
+		Name   string `json:"Name"`
+		Config struct {
+			Image  string            `json:"Image"`
+			Labels map[string]string `json:"Labels"`
+		} `json:"Config"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil
+	}
+
+	meta := &containerMeta{
+		ID:     cfg.ID,
+		Name:   strings.TrimPrefix(cfg.Name, "/"),
+		Image:  cfg.Config.Image,
+		Labels: make(map[string]string),
+	}
+	if meta.ID == "" {
+		meta.ID = filepath.Base(dir)
+	}
+
+	// dockershim 创建的 Kubernetes 容器带有 Pod 信息标签
+	for key, value := range cfg.Config.Labels {
+		switch key {
+		case "io.kubernetes.pod.namespace":
+			meta.Namespace = value
+		case "io.kubernetes.pod.name":
+			meta.Pod = value
+		case "io.kubernetes.pod.uid":
+			meta.PodUID = value
+		case "io.kubernetes.container.name":
+			meta.Name = value
+		default:
+			meta.Labels[key] = value
+		}
+	}
+	return meta
+}
+
+// 从 CRI 日志路径 /var/log/pods/<namespace>_<pod>_<uid>/<container>/<n>.log 解析 Pod 信息，
+// 并通过 /var/log/containers 软链接找到容器ID，从 containerd 状态目录读取镜像名称
+func (s *ContainerSource) readCRIMeta(path string) *containerMeta {
+	containerDir := filepath.Dir(path)
+	podDir := filepath.Base(filepath.Dir(containerDir))
+
+	parts := strings.Split(podDir, "_")
+	if len(parts) != 3 {
+		return nil
+	}
+
+	meta := &containerMeta{
+		Namespace: parts[0],
+		Pod:       parts[1],
+		PodUID:    parts[2],
+		Name:      filepath.Base(containerDir),
+	}
+	meta.ID = s.findContainerID(path, meta)
+	if meta.ID != "" {
+		meta.Image = s.readCRIImage(meta.ID)
+	}
+	return meta
+}
+
+// 软链接名称为 <pod>_<namespace>_<container>-<id>.log
+func (s *ContainerSource) findContainerID(path string, meta *containerMeta) string {
+	prefix := fmt.Sprintf("%s_%s_%s-", meta.Pod, meta.Namespace, meta.Name)
+	matches, _ := filepath.Glob(filepath.Join(s.linksDir, prefix+"*.log"))
+	for _, link := range matches {
+		target, err := filepath.EvalSymlinks(link)
+		if err != nil {
+			continue
+		}
+		if resolved, err := filepath.EvalSymlinks(path); err == nil && resolved == target {
+			return strings.TrimSuffix(strings.TrimPrefix(filepath.Base(link), prefix), ".log")
+		}
+	}
+	return ""
+}
+
+// containerd 在 OCI 配置的注解中记录了镜像名称
+func (s *ContainerSource) readCRIImage(id string) string {
+	data, err := os.ReadFile(filepath.Join(s.stateDir, id, "config.json"))
+	if err != nil {
+		return ""
+	}
+
+	var spec struct {
+		Annotations map[string]string `json:"annotations"`
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return ""
+	}
+	return firstNonEmpty(spec.Annotations["io.kubernetes.cri.image-name"], spec.Annotations["io.kubernetes.cri-o.ImageName"])
+}
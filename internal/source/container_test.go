@@ -0,0 +1,225 @@
+package source
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/input"
+	"github.com/xurenlu/aipipe/internal/monitor"
+	"github.com/xurenlu/aipipe/internal/pipeline"
+	"github.com/xurenlu/aipipe/internal/record"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContainerSourceDocker(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "abc123")
+	writeFile(t, filepath.Join(dir, "config.v2.json"), `{
+		"ID": "abc123", "Name": "/web",
+		"Config": {"Image": "nginx:1.25", "Labels": {"com.docker.compose.service": "web"}}
+	}`)
+	logFile := filepath.Join(dir, "abc123-json.log")
+	writeFile(t, logFile,
+		`{"log":"first part ","stream":"stderr","time":"2024-01-02T03:04:05.123456789Z"}`+"\n"+
+			`{"log":"request ok\n","stream":"stdout","time":"2024-01-02T03:04:05.2Z"}`+"\n"+
+			`{"log":"second part\n","stream":"stderr","time":"2024-01-02T03:04:05.3Z"}`+"\n")
+
+	src, err := NewContainerSource(config.SourceConfig{Name: "docker", Type: "docker", Path: root, Format: "nginx"}, input.DefaultLineOptions(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.SetStartFrom(monitor.StartFromBeginning)
+
+	records := make(chan *record.Record, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go src.Run(ctx, func(rec *record.Record) bool { records <- rec; return true })
+
+	want := []struct{ message, stream string }{
+		{"request ok", "stdout"},
+		{"first part second part", "stderr"},
+	}
+	for _, w := range want {
+		select {
+		case rec := <-records:
+			if rec.Message != w.message || rec.Labels["stream"] != w.stream {
+				t.Errorf("got %q (%s), want %q (%s)", rec.Message, rec.Labels["stream"], w.message, w.stream)
+			}
+			if rec.Labels["container"] != "web" || rec.Labels["image"] != "nginx:1.25" ||
+				rec.Labels["container_id"] != "abc123" || rec.Labels["label.com.docker.compose.service"] != "web" {
+				t.Errorf("unexpected labels: %v", rec.Labels)
+			}
+			if rec.Format != "nginx" || rec.Source != "docker" {
+				t.Errorf("unexpected record: %+v", rec)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timeout waiting for %q", w.message)
+		}
+	}
+}
+
+// 每条容器日志都带有时间，渲染后的行都以时间开头；堆栈应按日志内容合并为一个事件
+func TestContainerSourceMultilineTrace(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "abc123")
+	writeFile(t, filepath.Join(dir, "config.v2.json"), `{"ID": "abc123", "Name": "/api", "Config": {"Image": "api:1.0"}}`)
+	logFile := filepath.Join(dir, "abc123-json.log")
+
+	src, err := NewContainerSource(config.SourceConfig{Name: "docker", Type: "docker", Path: root, Format: "java"}, input.DefaultLineOptions(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var events []pipeline.Entry
+	assembler := pipeline.NewEventAssembler(0, time.Second, func(entry pipeline.Entry) {
+		events = append(events, entry)
+	})
+	lines := []string{
+		`{"log":"2024-01-02 03:04:05 ERROR order failed\n","stream":"stderr","time":"2024-01-02T03:04:05.1Z"}`,
+		`{"log":"java.lang.IllegalStateException: boom\n","stream":"stderr","time":"2024-01-02T03:04:05.2Z"}`,
+		`{"log":"GET /health 200\n","stream":"stdout","time":"2024-01-02T03:04:05.25Z"}`,
+		`{"log":"\tat com.example.OrderService.create(OrderService.java:42)\n","stream":"stderr","time":"2024-01-02T03:04:05.3Z"}`,
+		`{"log":"2024-01-02 03:04:06 INFO recovered\n","stream":"stderr","time":"2024-01-02T03:04:06Z"}`,
+	}
+	now := time.Now()
+	for _, line := range lines {
+		if rec := src.ParseLine(logFile, line); rec != nil {
+			assembler.AddRecord(rec, now)
+		}
+	}
+	assembler.Close()
+
+	var trace *pipeline.Entry
+	for i := range events {
+		if events[i].Labels["stream"] == "stderr" && strings.Contains(events[i].Line, "ERROR order failed") {
+			trace = &events[i]
+		}
+	}
+	if len(events) != 3 || trace == nil {
+		t.Fatalf("期望 3 个事件: %+v", events)
+	}
+	want := "2024-01-02T03:04:05.100Z 2024-01-02 03:04:05 ERROR order failed\n" +
+		"java.lang.IllegalStateException: boom\n" +
+		"\tat com.example.OrderService.create(OrderService.java:42)"
+	if trace.Line != want {
+		t.Errorf("堆栈未合并为一个事件: %q", trace.Line)
+	}
+	if trace.Labels["container"] != "api" {
+		t.Errorf("事件应保留第一条记录的元数据: %v", trace.Labels)
+	}
+}
+
+func TestContainerSourceCRI(t *testing.T) {
+	base := t.TempDir()
+	pods := filepath.Join(base, "pods")
+	links := filepath.Join(base, "containers")
+	state := filepath.Join(base, "state")
+
+	logFile := filepath.Join(pods, "prod_api-7d9f_0a1b", "api", "0.log")
+	writeFile(t, logFile, "")
+	if err := os.MkdirAll(links, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(logFile, filepath.Join(links, "api-7d9f_prod_api-c0ffee.log")); err != nil {
+		t.Skipf("symlink not supported: %v", err)
+	}
+	writeFile(t, filepath.Join(state, "c0ffee", "config.json"),
+		`{"annotations": {"io.kubernetes.cri.image-name": "registry/api:1.2"}}`)
+
+	src, err := NewContainerSource(config.SourceConfig{
+		Name:      "pods",
+		Type:      "cri",
+		Path:      pods,
+		Container: config.ContainerConfig{LinksDir: links, StateDir: state},
+	}, input.DefaultLineOptions(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := src.ParseLine(logFile, "2024-01-02T03:04:05.1Z stdout P java.lang."); rec != nil {
+		t.Fatalf("partial line emitted: %+v", rec)
+	}
+	rec := src.ParseLine(logFile, "2024-01-02T03:04:05.2Z stdout F NullPointerException")
+	if rec == nil {
+		t.Fatal("full line not emitted")
+	}
+	if rec.Message != "java.lang.NullPointerException" || !rec.Time.Equal(time.Date(2024, 1, 2, 3, 4, 5, 200000000, time.UTC)) {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+
+	labels := map[string]string{
+		"namespace":    "prod",
+		"pod":          "api-7d9f",
+		"pod_uid":      "0a1b",
+		"container":    "api",
+		"container_id": "c0ffee",
+		"image":        "registry/api:1.2",
+		"stream":       "stdout",
+	}
+	for key, want := range labels {
+		if got := rec.Labels[key]; got != want {
+			t.Errorf("label %s = %q, want %q", key, got, want)
+		}
+	}
+
+	if rec := src.ParseLine(logFile, "not a cri line"); rec != nil {
+		t.Errorf("invalid line emitted: %+v", rec)
+	}
+}
+
+func TestContainerSourceMetadataRetryAndForget(t *testing.T) {
+	base := t.TempDir()
+	pods := filepath.Join(base, "pods")
+	links := filepath.Join(base, "containers")
+
+	logFile := filepath.Join(pods, "prod_api-7d9f_0a1b", "api", "0.log")
+	writeFile(t, logFile, "")
+	if err := os.MkdirAll(links, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := NewContainerSource(config.SourceConfig{
+		Name:      "pods",
+		Type:      "cri",
+		Path:      pods,
+		Container: config.ContainerConfig{LinksDir: links, StateDir: filepath.Join(base, "state")},
+	}, input.DefaultLineOptions(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 软链接还没创建时不应一直缓存没有容器ID的元数据
+	rec := src.ParseLine(logFile, "2024-01-02T03:04:05.1Z stdout F starting")
+	if rec == nil || rec.Labels["pod"] != "api-7d9f" || rec.Labels["container_id"] != "" {
+		t.Fatalf("unexpected record: %+v", rec)
+	}
+	if err := os.Symlink(logFile, filepath.Join(links, "api-7d9f_prod_api-c0ffee.log")); err != nil {
+		t.Skipf("symlink not supported: %v", err)
+	}
+	src.metas[logFile].retryAt = time.Now().Add(-time.Second)
+	rec = src.ParseLine(logFile, "2024-01-02T03:04:05.2Z stdout F started")
+	if rec == nil || rec.Labels["container_id"] != "c0ffee" {
+		t.Fatalf("container id not resolved on retry: %+v", rec)
+	}
+
+	// 文件停止监控后清理缓存和未拼接完的行
+	src.ParseLine(logFile, "2024-01-02T03:04:05.3Z stderr P half")
+	src.forget(logFile)
+	if len(src.metas) != 0 || len(src.partial) != 0 {
+		t.Errorf("state not pruned: metas=%v partial=%v", src.metas, src.partial)
+	}
+}
@@ -0,0 +1,100 @@
+package source
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// 游标存储：按数据源名称保存读取游标（如 journal cursor），用于重启后继续读取
+type CursorStore struct {
+	file    string
+	cursors map[string]string
+	dirty   bool
+	mutex   sync.Mutex
+}
+
+// 默认游标文件路径
+func DefaultCursorFile() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "aipipe", "cursors.json")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".local", "state", "aipipe", "cursors.json")
+}
+
+// 加载游标存储，文件不存在时返回空存储
+func LoadCursorStore(file string) (*CursorStore, error) {
+	if file == "" {
+		file = DefaultCursorFile()
+	}
+
+	cs := &CursorStore{
+		file:    file,
+		cursors: make(map[string]string),
+	}
+
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return cs, nil
+	}
+	if err != nil {
+		return cs, fmt.Errorf("读取游标文件失败: %w", err)
+	}
+	if err := json.Unmarshal(data, &cs.cursors); err != nil {
+		return cs, fmt.Errorf("解析游标文件失败: %w", err)
+	}
+
+	return cs, nil
+}
+
+// 获取数据源的游标
+func (cs *CursorStore) Get(name string) string {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	return cs.cursors[name]
+}
+
+// 更新数据源的游标
+func (cs *CursorStore) Set(name, cursor string) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	if cs.cursors[name] == cursor {
+		return
+	}
+	cs.cursors[name] = cursor
+	cs.dirty = true
+}
+
+// 保存游标（先写临时文件再重命名）
+func (cs *CursorStore) Save() error {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	if !cs.dirty {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(cs.cursors, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化游标失败: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cs.file), 0755); err != nil {
+		return fmt.Errorf("创建游标目录失败: %w", err)
+	}
+
+	tmpFile := cs.file + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return fmt.Errorf("写入游标文件失败: %w", err)
+	}
+	if err := os.Rename(tmpFile, cs.file); err != nil {
+		return fmt.Errorf("保存游标文件失败: %w", err)
+	}
+
+	cs.dirty = false
+	return nil
+}
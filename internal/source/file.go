@@ -0,0 +1,109 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/input"
+	"github.com/xurenlu/aipipe/internal/monitor"
+	"github.com/xurenlu/aipipe/internal/record"
+)
+
+// 文件数据源：监控单个文件、通配符或目录，轮转和新创建的匹配文件自动跟踪
+type FileSource struct {
+	name      string
+	format    string
+	source    monitor.FileSource
+	interval  time.Duration // 轮询间隔，为 0 时使用默认值
+	startFrom string
+	positions *monitor.PositionStore
+}
+
+// 创建文件数据源，positions 为 nil 时不保存读取位置
+func NewFileSource(cfg config.SourceConfig, options input.LineOptions, positions *monitor.PositionStore) (*FileSource, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("数据源 %s 未配置文件路径", cfg.Name)
+	}
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+
+	s := &FileSource{
+		name:   cfg.Name,
+		format: cfg.Format,
+		source: monitor.FileSource{
+			Pattern:     cfg.Path,
+			Recursive:   cfg.Recursive,
+			Exclude:     cfg.Exclude,
+			GracePeriod: cfg.GracePeriod,
+			Poll:        cfg.Poll,
+			Options:     options,
+		},
+		interval:  cfg.PollInterval,
+		startFrom: monitor.StartFromCheckpoint,
+		positions: positions,
+	}
+	if positions == nil {
+		s.startFrom = monitor.StartFromEnd
+	}
+	return s, nil
+}
+
+// 数据源名称
+func (s *FileSource) Name() string {
+	return s.name
+}
+
+// 设置启动时已有文件的读取位置 (beginning, end, checkpoint)
+func (s *FileSource) SetStartFrom(from string) {
+	s.startFrom = from
+}
+
+// 监控文件直到 ctx 取消；普通文件不存在时返回错误，通配符和目录会等待匹配文件出现
+func (s *FileSource) Run(ctx context.Context, emit func(*record.Record) bool) error {
+	fileMonitor, err := monitor.NewFileMonitor()
+	if err != nil {
+		return err
+	}
+	defer fileMonitor.Stop()
+
+	if err := fileMonitor.SetStartFrom(s.startFrom); err != nil {
+		return err
+	}
+	if s.interval > 0 {
+		if err := fileMonitor.SetPollInterval(s.interval); err != nil {
+			return err
+		}
+	}
+	fileMonitor.SetForcePoll(s.source.Poll)
+	if s.positions != nil {
+		fileMonitor.EnableCheckpoints(s.positions, 0)
+	}
+
+	callback := func(path, line string) {
+		rec := &record.Record{
+			Source:  s.name,
+			Format:  s.format,
+			Message: line,
+			Origin:  path,
+		}
+		rec.SetLabel("path", path)
+		emit(rec)
+	}
+
+	info, err := os.Stat(s.source.Pattern)
+	if !monitor.IsPattern(s.source.Pattern) && (err != nil || !info.IsDir()) {
+		err = fileMonitor.AddFileWithOptions(s.source.Pattern, s.source.Options, callback)
+	} else {
+		_, err = fileMonitor.AddSource(s.source, callback)
+	}
+	if err != nil {
+		return err
+	}
+
+	<-ctx.Done()
+	return nil
+}
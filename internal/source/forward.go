@@ -0,0 +1,467 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/record"
+)
+
+// Fluent Forward 默认监听地址、单个消息最大字节数和最大条目数
+const (
+	DefaultForwardListen         = ":24224"
+	DefaultForwardMaxMessageSize = 16 * 1024 * 1024
+	DefaultForwardMaxEntries     = 100000
+)
+
+// 作为日志内容的记录字段，按顺序查找
+var forwardMessageKeys = []string{"log", "message", "msg", "MESSAGE"}
+
+// Fluent Forward 接收器：接收 Fluent Bit / Fluentd 的 forward 输出 (msgpack over TCP)，
+// 支持 Message、Forward、PackedForward 和 CompressedPackedForward 模式，以及 chunk ack
+type ForwardSource struct {
+	name       string
+	format     string
+	network    string
+	address    string
+	maxSize    int
+	maxEntries int
+	tagFormats []config.TagFormat
+
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	mutex    sync.Mutex
+	emitMu   sync.Mutex
+}
+
+// 创建 Fluent Forward 接收器
+func NewForwardSource(cfg config.SourceConfig) (*ForwardSource, error) {
+	listen := cfg.Forward.Listen
+	if listen == "" {
+		listen = cfg.Path
+	}
+	if listen == "" {
+		listen = DefaultForwardListen
+	}
+
+	network, address := "tcp", listen
+	if strings.Contains(listen, "://") {
+		var err error
+		network, address, err = parseListenAddress(listen)
+		if err != nil {
+			return nil, err
+		}
+		if network != "tcp" && network != "tcp4" && network != "tcp6" && network != "unix" {
+			return nil, fmt.Errorf("Fluent Forward 只支持 tcp 和 unix: %s", listen)
+		}
+	}
+
+	for _, tf := range cfg.Forward.TagFormats {
+		if tf.Tag == "" || tf.Format == "" {
+			return nil, fmt.Errorf("无效的 tag 格式映射: %s=%s", tf.Tag, tf.Format)
+		}
+	}
+
+	maxSize := cfg.Forward.MaxMessageSize
+	if maxSize <= 0 {
+		maxSize = DefaultForwardMaxMessageSize
+	}
+	maxEntries := cfg.Forward.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = DefaultForwardMaxEntries
+	}
+
+	return &ForwardSource{
+		name:       cfg.Name,
+		format:     cfg.Format,
+		network:    network,
+		address:    address,
+		maxSize:    maxSize,
+		maxEntries: maxEntries,
+		tagFormats: cfg.Forward.TagFormats,
+		conns:      make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// 数据源名称
+func (s *ForwardSource) Name() string {
+	return s.name
+}
+
+// 开始监听并返回实际监听地址
+func (s *ForwardSource) Listen() (net.Addr, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.listener != nil {
+		return s.listener.Addr(), nil
+	}
+
+	if s.network == "unix" {
+		if info, err := os.Lstat(s.address); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(s.address)
+		}
+	}
+
+	listener, err := net.Listen(s.network, s.address)
+	if err != nil {
+		return nil, fmt.Errorf("Fluent Forward 监听 %s 失败: %w", s.address, err)
+	}
+	s.listener = listener
+	return listener.Addr(), nil
+}
+
+// 接收消息直到 ctx 取消
+func (s *ForwardSource) Run(ctx context.Context, emit func(*record.Record) bool) error {
+	if _, err := s.Listen(); err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.listener.Close()
+		for conn := range s.conns {
+			conn.Close()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return fmt.Errorf("Fluent Forward 接受连接失败: %w", err)
+		}
+
+		s.mutex.Lock()
+		s.conns[conn] = struct{}{}
+		s.mutex.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveConn(conn, emit)
+
+			s.mutex.Lock()
+			delete(s.conns, conn)
+			s.mutex.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// 读取一个连接上的所有消息
+func (s *ForwardSource) serveConn(conn net.Conn, emit func(*record.Record) bool) {
+	decoder := newMsgpackDecoder(bufio.NewReaderSize(conn, 64*1024), s.maxSize)
+	decoder.maxItems = s.maxEntries
+	for {
+		value, err := decoder.Decode()
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				fmt.Printf("⚠️  Fluent Forward 连接 %s 读取失败: %v\n", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		records, chunk, err := s.decodeMessage(value)
+		if err != nil {
+			fmt.Printf("⚠️  Fluent Forward 消息无效 (%s): %v\n", conn.RemoteAddr(), err)
+			return
+		}
+
+		accepted := true
+		s.emitMu.Lock()
+		for _, rec := range records {
+			if !emit(rec) {
+				accepted = false
+			}
+		}
+		s.emitMu.Unlock()
+
+		// 所有记录都进入处理队列后才确认，发送方在收到 ack 之前会保留数据；
+		// 有记录因队列已满被丢弃时不确认并断开连接，由发送方重发整个 chunk
+		if chunk != "" && !accepted {
+			fmt.Printf("⚠️  Fluent Forward 处理队列已满，chunk %s 未确认，等待 %s 重发\n", chunk, conn.RemoteAddr())
+			return
+		}
+		if chunk != "" {
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if _, err := conn.Write(encodeMsgpackStringMap(map[string]string{"ack": chunk})); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// 解析一个 forward 消息，返回记录和需要确认的 chunk
+//
+//	Message:        [tag, time, record, option?]
+//	Forward:        [tag, [[time, record], ...], option?]
+//	PackedForward:  [tag, bin(entries), option?]，option.compressed 为 gzip 时需要先解压
+func (s *ForwardSource) decodeMessage(value interface{}) ([]*record.Record, string, error) {
+	message, ok := value.([]interface{})
+	if !ok || len(message) < 2 {
+		return nil, "", fmt.Errorf("消息必须是至少包含 tag 和条目的数组")
+	}
+
+	tag := msgpackString(message[0])
+	var option map[string]interface{}
+
+	var entries [][]interface{}
+	switch payload := message[1].(type) {
+	case []interface{}:
+		// Forward 模式
+		if len(payload) > s.maxEntries {
+			return nil, "", fmt.Errorf("条目数超过 %d", s.maxEntries)
+		}
+		for _, item := range payload {
+			entry, ok := item.([]interface{})
+			if !ok || len(entry) < 2 {
+				return nil, "", fmt.Errorf("无效的 forward 条目")
+			}
+			entries = append(entries, entry)
+		}
+		option = forwardOption(message, 2)
+
+	case []byte, string:
+		// PackedForward 模式
+		option = forwardOption(message, 2)
+		data := []byte(msgpackString(payload))
+		if msgpackString(option["compressed"]) == "gzip" {
+			var err error
+			if data, err = s.gunzip(data); err != nil {
+				return nil, "", err
+			}
+		}
+		decoder := newMsgpackDecoder(bytes.NewReader(data), s.maxSize)
+		decoder.maxItems = s.maxEntries
+		for {
+			item, err := decoder.Decode()
+			if err == io.EOF {
+				break
+			}
+			if len(entries) >= s.maxEntries {
+				return nil, "", fmt.Errorf("条目数超过 %d", s.maxEntries)
+			}
+			if err != nil {
+				return nil, "", fmt.Errorf("解析 packed forward 条目失败: %w", err)
+			}
+			entry, ok := item.([]interface{})
+			if !ok || len(entry) < 2 {
+				return nil, "", fmt.Errorf("无效的 packed forward 条目")
+			}
+			entries = append(entries, entry)
+		}
+
+	default:
+		// Message 模式
+		if len(message) < 3 {
+			return nil, "", fmt.Errorf("无效的 message 模式消息")
+		}
+		entries = [][]interface{}{{message[1], message[2]}}
+		option = forwardOption(message, 3)
+	}
+
+	records := make([]*record.Record, 0, len(entries))
+	for _, entry := range entries {
+		fields, ok := entry[1].(map[string]interface{})
+		if !ok {
+			return nil, "", fmt.Errorf("记录必须是映射")
+		}
+		records = append(records, s.newRecord(tag, forwardTime(entry[0]), fields))
+	}
+
+	return records, msgpackString(option["chunk"]), nil
+}
+
+// 解压 CompressedPackedForward，解压后的大小同样受限制
+func (s *ForwardSource) gunzip(data []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解压 packed forward 失败: %w", err)
+	}
+	defer gz.Close()
+
+	// 多个 gzip 成员连接在一起时依次解压
+	out, err := io.ReadAll(io.LimitReader(gz, int64(s.maxSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("解压 packed forward 失败: %w", err)
+	}
+	if len(out) > s.maxSize {
+		return nil, fmt.Errorf("解压后的数据超过 %d 字节", s.maxSize)
+	}
+	return out, nil
+}
+
+func forwardOption(message []interface{}, index int) map[string]interface{} {
+	if len(message) > index {
+		if option, ok := message[index].(map[string]interface{}); ok {
+			return option
+		}
+	}
+	return nil
+}
+
+// 解析事件时间：整数秒或 EventTime 扩展类型 (type 0: 4 字节秒 + 4 字节纳秒)
+func forwardTime(v interface{}) time.Time {
+	switch t := v.(type) {
+	case int64:
+		return time.Unix(t, 0)
+	case uint64:
+		return time.Unix(int64(t), 0)
+	case float64:
+		sec := int64(t)
+		return time.Unix(sec, int64((t-float64(sec))*1e9))
+	case msgpackExt:
+		if t.Type == 0 && len(t.Data) == 8 {
+			sec := binary.BigEndian.Uint32(t.Data[:4])
+			nsec := binary.BigEndian.Uint32(t.Data[4:])
+			return time.Unix(int64(sec), int64(nsec))
+		}
+	}
+	return time.Time{}
+}
+
+// 根据 tag 和记录字段生成日志记录
+func (s *ForwardSource) newRecord(tag string, at time.Time, fields map[string]interface{}) *record.Record {
+	rec := &record.Record{
+		Time:     at,
+		Source:   s.name,
+		Format:   s.formatForTag(tag),
+		Complete: true,
+	}
+	rec.SetLabel("tag", tag)
+
+	messageKey := ""
+	for _, key := range forwardMessageKeys {
+		if v, ok := fields[key]; ok {
+			messageKey = key
+			rec.Message = strings.TrimRight(msgpackString(v), "\n")
+			break
+		}
+	}
+	if messageKey == "" {
+		// 没有日志字段时使用整个记录的 JSON
+		data, _ := json.Marshal(jsonValue(fields))
+		rec.Message = string(data)
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if key == messageKey {
+			continue
+		}
+		switch v := fields[key].(type) {
+		case map[string]interface{}, []interface{}:
+			data, _ := json.Marshal(jsonValue(v))
+			rec.SetLabel(key, string(data))
+		default:
+			rec.SetLabel(key, msgpackString(v))
+		}
+	}
+
+	rec.Host = firstNonEmpty(rec.Labels["host"], rec.Labels["hostname"])
+	rec.Severity = firstNonEmpty(rec.Labels["level"], rec.Labels["severity"])
+	return rec
+}
+
+// 将 msgpack 值转换为可以序列化为 JSON 的值（bin 转为字符串）
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []byte:
+		return string(v)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = jsonValue(item)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = jsonValue(item)
+		}
+		return out
+	case msgpackExt:
+		return fmt.Sprintf("ext(%d)", v.Type)
+	}
+	return v
+}
+
+// 按配置顺序匹配 tag 对应的日志格式，没有匹配时使用数据源的格式
+func (s *ForwardSource) formatForTag(tag string) string {
+	for _, tf := range s.tagFormats {
+		if MatchTag(tf.Tag, tag) {
+			return tf.Format
+		}
+	}
+	return s.format
+}
+
+// 按 fluentd 规则匹配 tag: * 匹配一段，** 匹配零或多段，{a,b} 匹配其中之一
+func MatchTag(pattern, tag string) bool {
+	return matchTagParts(strings.Split(pattern, "."), strings.Split(tag, "."))
+}
+
+func matchTagParts(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchTagParts(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(parts) == 0 || !matchTagPart(pattern[0], parts[0]) {
+		return false
+	}
+	return matchTagParts(pattern[1:], parts[1:])
+}
+
+func matchTagPart(pattern, part string) bool {
+	if pattern == "*" {
+		return true
+	}
+	if strings.HasPrefix(pattern, "{") && strings.HasSuffix(pattern, "}") {
+		for _, alt := range strings.Split(pattern[1:len(pattern)-1], ",") {
+			if alt == part {
+				return true
+			}
+		}
+		return false
+	}
+	return pattern == part
+}
@@ -0,0 +1,220 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/record"
+)
+
+// 测试用的 msgpack 编码
+func packMsgpack(buf []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case string:
+		return appendMsgpackString(buf, v)
+	case int:
+		buf = append(buf, 0xd3)
+		return binary.BigEndian.AppendUint64(buf, uint64(v))
+	case []byte:
+		buf = append(buf, 0xc6)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(v)))
+		return append(buf, v...)
+	case msgpackExt:
+		buf = append(buf, 0xd7, byte(v.Type))
+		return append(buf, v.Data...)
+	case []interface{}:
+		buf = append(buf, 0xdc)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(v)))
+		for _, item := range v {
+			buf = packMsgpack(buf, item)
+		}
+		return buf
+	case map[string]interface{}:
+		buf = append(buf, 0xde)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(v)))
+		for key, item := range v {
+			buf = packMsgpack(appendMsgpackString(buf, key), item)
+		}
+		return buf
+	}
+	panic("unsupported type")
+}
+
+func eventTime(sec, nsec uint32) msgpackExt {
+	data := binary.BigEndian.AppendUint32(nil, sec)
+	return msgpackExt{Type: 0, Data: binary.BigEndian.AppendUint32(data, nsec)}
+}
+
+func TestForwardSource(t *testing.T) {
+	src, err := NewForwardSource(config.SourceConfig{
+		Name:   "fluent",
+		Format: "json",
+		Forward: config.ForwardConfig{
+			Listen: "127.0.0.1:0",
+			TagFormats: []config.TagFormat{
+				{Tag: "kube.**", Format: "java"},
+				{Tag: "nginx.{access,error}", Format: "nginx"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := src.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := make(chan *record.Record, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- src.Run(ctx, func(rec *record.Record) bool { records <- rec; return true })
+	}()
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Message 模式
+	msg := packMsgpack(nil, []interface{}{"nginx.error", 1700000000, map[string]interface{}{"log": "upstream timed out\n", "host": "web-1"}})
+	// Forward 模式，带 chunk
+	msg = packMsgpack(msg, []interface{}{"kube.var.log.api", []interface{}{
+		[]interface{}{eventTime(1700000001, 500), map[string]interface{}{"message": "NullPointerException", "level": "error"}},
+	}, map[string]interface{}{"chunk": "c1"}})
+	// CompressedPackedForward 模式，带 chunk
+	var entries []byte
+	entries = packMsgpack(entries, []interface{}{1700000002, map[string]interface{}{"log": []byte("packed line")}})
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(entries)
+	w.Close()
+	msg = packMsgpack(msg, []interface{}{"app", gz.Bytes(), map[string]interface{}{"chunk": "c2", "compressed": "gzip"}})
+
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		message, format, tag string
+		time                 time.Time
+	}{
+		{"upstream timed out", "nginx", "nginx.error", time.Unix(1700000000, 0)},
+		{"NullPointerException", "java", "kube.var.log.api", time.Unix(1700000001, 500)},
+		{"packed line", "json", "app", time.Unix(1700000002, 0)},
+	}
+	for _, w := range want {
+		select {
+		case rec := <-records:
+			if rec.Message != w.message || rec.Format != w.format || rec.Labels["tag"] != w.tag ||
+				!rec.Time.Equal(w.time) || rec.Source != "fluent" {
+				t.Errorf("got %+v, want %+v", rec, w)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for %q", w.message)
+		}
+	}
+
+	// 两个带 chunk 的消息都应收到 ack
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	decoder := newMsgpackDecoder(bufio.NewReader(conn), 1024)
+	for _, chunk := range []string{"c1", "c2"} {
+		ack, err := decoder.Decode()
+		if err != nil {
+			t.Fatalf("read ack: %v", err)
+		}
+		if m, ok := ack.(map[string]interface{}); !ok || m["ack"] != chunk {
+			t.Errorf("ack = %v, want %s", ack, chunk)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run: %v", err)
+	}
+}
+
+func TestForwardSourceRejected(t *testing.T) {
+	src, err := NewForwardSource(config.SourceConfig{
+		Name:    "fluent",
+		Format:  "json",
+		Forward: config.ForwardConfig{Listen: "127.0.0.1:0", MaxEntries: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := src.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 第二条记录被丢弃
+	var emitted int
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go src.Run(ctx, func(rec *record.Record) bool {
+		emitted++
+		return emitted != 2
+	})
+
+	// 有记录被丢弃的 chunk 不确认，连接被关闭
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	msg := packMsgpack(nil, []interface{}{"app", []interface{}{
+		[]interface{}{1700000000, map[string]interface{}{"log": "first"}},
+		[]interface{}{1700000001, map[string]interface{}{"log": "second"}},
+	}, map[string]interface{}{"chunk": "c1"}})
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if ack, err := newMsgpackDecoder(bufio.NewReader(conn), 1024).Decode(); err == nil {
+		t.Errorf("丢弃记录后不应确认: %v", ack)
+	}
+
+	// 条目数超过限制的消息被拒绝
+	if _, _, err := src.decodeMessage([]interface{}{"app", []interface{}{
+		[]interface{}{int64(1), map[string]interface{}{"log": "a"}},
+		[]interface{}{int64(2), map[string]interface{}{"log": "b"}},
+		[]interface{}{int64(3), map[string]interface{}{"log": "c"}},
+	}}); err == nil {
+		t.Error("条目数超过限制的消息应被拒绝")
+	}
+	decoder := newMsgpackDecoder(bytes.NewReader(packMsgpack(nil, []interface{}{1, 2, 3})), 1024)
+	decoder.maxItems = 2
+	if _, err := decoder.Decode(); err == nil {
+		t.Error("元素数超过限制的数组应解码失败")
+	}
+}
+
+func TestMatchTag(t *testing.T) {
+	tests := []struct {
+		pattern, tag string
+		want         bool
+	}{
+		{"app.*", "app.web", true},
+		{"app.*", "app.web.1", false},
+		{"app.**", "app", true},
+		{"app.**", "app.web.1", true},
+		{"**.error", "nginx.error", true},
+		{"{nginx,apache}.access", "apache.access", true},
+		{"{nginx,apache}.access", "caddy.access", false},
+	}
+	for _, tt := range tests {
+		if got := MatchTag(tt.pattern, tt.tag); got != tt.want {
+			t.Errorf("MatchTag(%q, %q) = %v, want %v", tt.pattern, tt.tag, got, tt.want)
+		}
+	}
+}
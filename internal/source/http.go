@@ -0,0 +1,456 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/record"
+)
+
+// 默认单个请求最大字节数
+const DefaultMaxBodySize = 10 * 1024 * 1024
+
+// HTTP 接收端点路径
+const (
+	IngestPath   = "/ingest"
+	LokiPushPath = "/loki/api/v1/push"
+	HealthPath   = "/healthz"
+)
+
+// HTTP 接收端点：接收应用和日志采集器推送的日志
+//
+//	POST /ingest             按行分隔的文本或 JSON、JSON 记录数组
+//	POST /loki/api/v1/push   Loki push API (JSON)
+//	POST /v1/logs            OTLP/HTTP 日志 (protobuf 或 JSON)
+//	GET  /healthz            健康检查
+//
+// 请求可以通过 ?source=&format= 参数或 X-Aipipe-Source、X-Aipipe-Format 头指定来源和格式
+type HTTPSource struct {
+	name        string
+	format      string
+	listen      string
+	token       string
+	maxBodySize int64
+
+	listener net.Listener
+	emit     func(*record.Record) bool
+	mutex    sync.Mutex
+	emitMu   sync.Mutex
+}
+
+// 创建 HTTP 接收端点
+func NewHTTPSource(cfg config.SourceConfig) (*HTTPSource, error) {
+	listen := cfg.HTTP.Listen
+	if listen == "" {
+		listen = cfg.Path
+	}
+	if listen == "" {
+		return nil, fmt.Errorf("HTTP 监听地址不能为空")
+	}
+
+	maxBodySize := cfg.HTTP.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = DefaultMaxBodySize
+	}
+
+	return &HTTPSource{
+		name:        cfg.Name,
+		format:      cfg.Format,
+		listen:      listen,
+		token:       cfg.HTTP.Token,
+		maxBodySize: maxBodySize,
+	}, nil
+}
+
+// 数据源名称
+func (s *HTTPSource) Name() string {
+	return s.name
+}
+
+// 开始监听并返回实际监听地址
+func (s *HTTPSource) Listen() (net.Addr, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.listener != nil {
+		return s.listener.Addr(), nil
+	}
+
+	listener, err := net.Listen("tcp", s.listen)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP 监听 %s 失败: %w", s.listen, err)
+	}
+	s.listener = listener
+	return listener.Addr(), nil
+}
+
+// 接收请求直到 ctx 取消
+func (s *HTTPSource) Run(ctx context.Context, emit func(*record.Record) bool) error {
+	if _, err := s.Listen(); err != nil {
+		return err
+	}
+	s.emit = emit
+
+	server := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.Serve(s.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("HTTP 服务异常退出: %w", err)
+	}
+	return nil
+}
+
+// 处理请求
+func (s *HTTPSource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == HealthPath {
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "ok\n")
+		return
+	}
+
+	switch r.URL.Path {
+	case IngestPath, LokiPushPath, OTLPLogsPath:
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		httpError(w, http.StatusMethodNotAllowed, "只支持 POST 请求")
+		return
+	}
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		httpError(w, http.StatusUnauthorized, "认证失败")
+		return
+	}
+
+	body, err := s.readBody(w, r)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			httpError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("请求超过大小限制 (%d 字节)", s.maxBodySize))
+			return
+		}
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var records []*record.Record
+	contentType := r.Header.Get("Content-Type")
+	switch r.URL.Path {
+	case LokiPushPath:
+		if !strings.Contains(contentType, "json") {
+			httpError(w, http.StatusUnsupportedMediaType, "只支持 JSON 格式的 Loki push 请求")
+			return
+		}
+		records, err = ParseLokiPush(body)
+	case OTLPLogsPath:
+		if !strings.Contains(contentType, "json") && !strings.Contains(contentType, "protobuf") {
+			httpError(w, http.StatusUnsupportedMediaType, "OTLP 请求只支持 application/x-protobuf 和 application/json")
+			return
+		}
+		records, err = ParseOTLPLogs(body, contentType)
+	default:
+		records, err = ParseIngestBody(body, contentType)
+	}
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	source, format := s.requestLabels(r)
+	s.emitMu.Lock()
+	for _, rec := range records {
+		if rec.Source == "" {
+			rec.Source = source
+		}
+		if rec.Format == "" {
+			rec.Format = format
+		}
+		s.emit(rec)
+	}
+	s.emitMu.Unlock()
+
+	switch r.URL.Path {
+	case LokiPushPath:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case OTLPLogsPath:
+		// 返回空的 ExportLogsServiceResponse
+		if strings.Contains(contentType, "json") {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, "{}")
+		} else {
+			w.Header().Set("Content-Type", "application/x-protobuf")
+			w.WriteHeader(http.StatusOK)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"accepted": len(records)})
+}
+
+// 校验 Bearer Token
+func (s *HTTPSource) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// 读取请求体（支持 gzip），超过大小限制时返回 *http.MaxBytesError
+func (s *HTTPSource) readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	var reader io.Reader = http.MaxBytesReader(w, r.Body, s.maxBodySize)
+
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("解压请求失败: %w", err)
+		}
+		defer gz.Close()
+		// 解压后的大小同样受限制
+		reader = io.LimitReader(gz, s.maxBodySize+1)
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(body)) > s.maxBodySize {
+			return nil, &http.MaxBytesError{Limit: s.maxBodySize}
+		}
+		return body, nil
+	}
+
+	return io.ReadAll(reader)
+}
+
+// 请求指定的来源和格式，未指定时使用数据源的配置
+func (s *HTTPSource) requestLabels(r *http.Request) (string, string) {
+	source := firstNonEmpty(r.URL.Query().Get("source"), r.Header.Get("X-Aipipe-Source"), s.name)
+	format := firstNonEmpty(r.URL.Query().Get("format"), r.Header.Get("X-Aipipe-Format"), s.format)
+	return source, format
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func httpError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// 解析 /ingest 请求体：JSON 数组按记录解析，其余按行解析（JSON 对象行按记录解析，其他行作为文本）
+func ParseIngestBody(body []byte, contentType string) ([]*record.Record, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return nil, nil
+	}
+
+	if trimmed[0] == '[' && !strings.HasPrefix(contentType, "text/") {
+		var items []json.RawMessage
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, fmt.Errorf("解析 JSON 数组失败: %w", err)
+		}
+		records := make([]*record.Record, 0, len(items))
+		for i, item := range items {
+			rec, err := recordFromJSON(item)
+			if err != nil {
+				return nil, fmt.Errorf("第 %d 条记录无效: %w", i+1, err)
+			}
+			records = append(records, rec)
+		}
+		return records, nil
+	}
+
+	var records []*record.Record
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), len(body)+1)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "{") && !strings.HasPrefix(contentType, "text/") {
+			if rec, err := recordFromJSON([]byte(line)); err == nil {
+				records = append(records, rec)
+				continue
+			}
+		}
+		records = append(records, &record.Record{Message: line})
+	}
+	return records, scanner.Err()
+}
+
+// 将 JSON 值转换为记录：字符串作为日志内容，对象按常见字段名解析
+func recordFromJSON(data []byte) (*record.Record, error) {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		return &record.Record{Message: text}, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("记录必须是字符串或 JSON 对象")
+	}
+
+	rec := &record.Record{
+		Source:   stringField(fields, "source"),
+		Format:   stringField(fields, "format"),
+		Host:     stringField(fields, "host", "hostname"),
+		App:      stringField(fields, "app", "service", "service_name"),
+		PID:      stringField(fields, "pid"),
+		Severity: stringField(fields, "severity", "level"),
+		Message:  stringField(fields, "message", "msg", "log", "line"),
+		Time:     timeField(fields, "time", "timestamp", "ts", "@timestamp"),
+		Complete: true,
+	}
+	if labels, ok := fields["labels"].(map[string]interface{}); ok {
+		for key, value := range labels {
+			rec.SetLabel(key, fmt.Sprint(value))
+		}
+	}
+	if rec.Message == "" {
+		// 没有消息字段时保留原始 JSON，交给 JSON 格式的日志解析
+		rec.Message = string(bytes.TrimSpace(data))
+	}
+	return rec, nil
+}
+
+func stringField(fields map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		switch v := fields[key].(type) {
+		case string:
+			if v != "" {
+				return v
+			}
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+	return ""
+}
+
+// 解析时间字段：RFC 3339 字符串或 Unix 时间戳（秒、毫秒、微秒、纳秒）
+func timeField(fields map[string]interface{}, keys ...string) time.Time {
+	for _, key := range keys {
+		switch v := fields[key].(type) {
+		case string:
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return t
+			}
+			if n, err := strconv.ParseFloat(v, 64); err == nil {
+				return unixTime(n)
+			}
+		case float64:
+			return unixTime(v)
+		}
+	}
+	return time.Time{}
+}
+
+// 根据数量级判断时间戳单位
+func unixTime(n float64) time.Time {
+	switch {
+	case n > 1e17:
+		return time.Unix(0, int64(n))
+	case n > 1e14:
+		return time.UnixMicro(int64(n))
+	case n > 1e11:
+		return time.UnixMilli(int64(n))
+	default:
+		sec := int64(n)
+		return time.Unix(sec, int64((n-float64(sec))*1e9))
+	}
+}
+
+// Loki push 请求 (JSON)
+type lokiPushRequest struct {
+	Streams []struct {
+		Stream map[string]string   `json:"stream"`
+		Values [][]json.RawMessage `json:"values"`
+	} `json:"streams"`
+}
+
+// 解析 Loki push API 的 JSON 请求，流标签保存为记录标签
+func ParseLokiPush(body []byte) ([]*record.Record, error) {
+	var req lokiPushRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("解析 Loki push 请求失败: %w", err)
+	}
+
+	var records []*record.Record
+	for _, stream := range req.Streams {
+		for _, value := range stream.Values {
+			if len(value) < 2 {
+				return nil, fmt.Errorf("Loki 日志条目必须包含时间戳和内容")
+			}
+
+			var ts, line string
+			if err := json.Unmarshal(value[0], &ts); err != nil {
+				return nil, fmt.Errorf("无效的 Loki 时间戳: %s", value[0])
+			}
+			if err := json.Unmarshal(value[1], &line); err != nil {
+				return nil, fmt.Errorf("无效的 Loki 日志内容: %s", value[1])
+			}
+			nsec, err := strconv.ParseInt(ts, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("无效的 Loki 时间戳: %s", ts)
+			}
+
+			rec := &record.Record{
+				Time:     time.Unix(0, nsec),
+				Host:     firstNonEmpty(stream.Stream["host"], stream.Stream["hostname"], stream.Stream["instance"]),
+				App:      firstNonEmpty(stream.Stream["app"], stream.Stream["service_name"], stream.Stream["job"]),
+				Severity: firstNonEmpty(stream.Stream["level"], stream.Stream["severity"]),
+				Message:  line,
+				Complete: true,
+			}
+			for key, label := range stream.Stream {
+				rec.SetLabel(key, label)
+			}
+
+			// 第三个元素为结构化元数据
+			if len(value) > 2 {
+				var metadata map[string]string
+				if err := json.Unmarshal(value[2], &metadata); err == nil {
+					for key, label := range metadata {
+						rec.SetLabel(key, label)
+					}
+				}
+			}
+			records = append(records, rec)
+		}
+	}
+	return records, nil
+}
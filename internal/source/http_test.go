@@ -0,0 +1,86 @@
+package source
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/record"
+)
+
+func TestHTTPSource(t *testing.T) {
+	src, err := NewHTTPSource(config.SourceConfig{
+		Name:   "http",
+		Format: "java",
+		HTTP:   config.HTTPConfig{Listen: "127.0.0.1:0", Token: "secret", MaxBodySize: 1024},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records []*record.Record
+	src.emit = func(rec *record.Record) bool { records = append(records, rec); return true }
+
+	send := func(path, contentType, body, token string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		src.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := send("/ingest", "text/plain", "line", ""); code != http.StatusUnauthorized {
+		t.Errorf("missing token: status %d", code)
+	}
+	if code := send("/ingest", "text/plain", strings.Repeat("x", 2048), "secret"); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("large body: status %d", code)
+	}
+	if len(records) != 0 {
+		t.Fatalf("rejected requests emitted %d records", len(records))
+	}
+
+	// 文本和 NDJSON 混合
+	body := "plain error line\n{\"message\":\"json line\",\"level\":\"error\",\"ts\":1700000000}\n\n"
+	if code := send("/ingest?source=api&format=python", "application/x-ndjson", body, "secret"); code != http.StatusOK {
+		t.Fatalf("ndjson: status %d", code)
+	}
+	if len(records) != 2 || records[0].Message != "plain error line" || records[0].Source != "api" || records[0].Format != "python" {
+		t.Fatalf("ndjson records: %+v", records)
+	}
+	if records[1].Message != "json line" || records[1].Severity != "error" || !records[1].Time.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("ndjson record: %+v", records[1])
+	}
+
+	// JSON 数组
+	records = nil
+	if code := send("/ingest", "application/json", `["first", {"msg": "second", "source": "worker"}]`, "secret"); code != http.StatusOK {
+		t.Fatalf("array: status %d", code)
+	}
+	if len(records) != 2 || records[0].Source != "http" || records[0].Format != "java" || records[1].Source != "worker" {
+		t.Fatalf("array records: %+v", records)
+	}
+
+	// Loki push
+	records = nil
+	loki := `{"streams":[{"stream":{"job":"nginx","host":"web-1","level":"error"},"values":[["1700000000000000001","upstream timed out",{"trace_id":"abc"}]]}]}`
+	if code := send("/loki/api/v1/push", "application/json", loki, "secret"); code != http.StatusNoContent {
+		t.Fatalf("loki: status %d", code)
+	}
+	if len(records) != 1 {
+		t.Fatalf("loki records: %d", len(records))
+	}
+	rec := records[0]
+	if rec.Message != "upstream timed out" || rec.App != "nginx" || rec.Host != "web-1" || rec.Severity != "error" ||
+		rec.Labels["trace_id"] != "abc" || rec.Time.UnixNano() != 1700000000000000001 {
+		t.Errorf("loki record: %+v", rec)
+	}
+	if code := send("/loki/api/v1/push", "application/x-protobuf", "x", "secret"); code != http.StatusUnsupportedMediaType {
+		t.Errorf("loki protobuf: status %d", code)
+	}
+}
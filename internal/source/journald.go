@@ -0,0 +1,235 @@
+package source
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/record"
+)
+
+// 游标保存间隔
+const cursorFlushInterval = 5 * time.Second
+
+// journald 数据源：运行 journalctl -f -o json 并解析每条日志
+type JournaldSource struct {
+	name    string
+	format  string
+	config  config.JournalConfig
+	cursors *CursorStore
+}
+
+// 创建 journald 数据源，cursors 为 nil 时不保存游标
+func NewJournaldSource(cfg config.SourceConfig, cursors *CursorStore) *JournaldSource {
+	format := cfg.Format
+	if format == "" {
+		format = "journald"
+	}
+	if cfg.Journal.NoCursor {
+		cursors = nil
+	}
+
+	return &JournaldSource{
+		name:    cfg.Name,
+		format:  format,
+		config:  cfg.Journal,
+		cursors: cursors,
+	}
+}
+
+// 数据源名称
+func (s *JournaldSource) Name() string {
+	return s.name
+}
+
+// 生成 journalctl 参数：有保存的游标时从游标之后继续，否则使用 since
+func (s *JournaldSource) Args() ([]string, error) {
+	args := []string{"--follow", "--output=json", "--no-pager"}
+
+	cursor := ""
+	if s.cursors != nil {
+		cursor = s.cursors.Get(s.name)
+	}
+	switch {
+	case cursor != "":
+		args = append(args, "--after-cursor="+cursor)
+	case s.config.Since != "":
+		args = append(args, "--since="+s.config.Since)
+	default:
+		// 没有游标和开始时间时只读取新日志
+		args = append(args, "--lines=0")
+	}
+
+	if s.config.Until != "" {
+		args = append(args, "--until="+s.config.Until)
+	}
+	if s.config.Priority != "" {
+		args = append(args, "--priority="+s.config.Priority)
+	}
+	if s.config.Boot {
+		args = append(args, "--boot")
+	}
+	if s.config.Kernel {
+		args = append(args, "--dmesg")
+	}
+	for _, service := range s.config.Services {
+		if service = strings.TrimSpace(service); service != "" {
+			args = append(args, "--unit="+service)
+		}
+	}
+	if s.config.User != "" {
+		uid, err := lookupUID(s.config.User)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "_UID="+uid)
+	}
+
+	return args, nil
+}
+
+// 将用户名解析为 UID，数字直接返回
+func lookupUID(name string) (string, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		return name, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", fmt.Errorf("无效的 journal 用户 %s: %w", name, err)
+	}
+	return u.Uid, nil
+}
+
+// 运行 journalctl 直到 ctx 取消或进程退出
+func (s *JournaldSource) Run(ctx context.Context, emit func(*record.Record) bool) error {
+	args, err := s.Args()
+	if err != nil {
+		return err
+	}
+
+	command := s.config.Command
+	if command == "" {
+		command = "journalctl"
+	}
+
+	cmd := exec.CommandContext(ctx, command, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("创建 journalctl 输出管道失败: %w", err)
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("启动 journalctl 失败: %w", err)
+	}
+	defer s.saveCursor()
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	lastFlush := time.Now()
+	for scanner.Scan() {
+		rec, cursor, err := ParseJournalEntry(scanner.Bytes())
+		if err != nil {
+			continue
+		}
+
+		rec.Source = s.name
+		rec.Format = s.format
+		emit(rec)
+
+		if s.cursors != nil && cursor != "" {
+			s.cursors.Set(s.name, cursor)
+			if time.Since(lastFlush) >= cursorFlushInterval {
+				s.saveCursor()
+				lastFlush = time.Now()
+			}
+		}
+	}
+
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("journalctl 退出: %w %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// 保存游标
+func (s *JournaldSource) saveCursor() {
+	if s.cursors == nil {
+		return
+	}
+	if err := s.cursors.Save(); err != nil {
+		fmt.Printf("⚠️  保存 journal 游标失败: %v\n", err)
+	}
+}
+
+// 解析 journalctl -o json 输出的一条日志，返回记录和游标
+func ParseJournalEntry(data []byte) (*record.Record, string, error) {
+	var entry map[string]interface{}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, "", fmt.Errorf("解析 journal 日志失败: %w", err)
+	}
+
+	rec := &record.Record{
+		Message: journalField(entry, "MESSAGE"),
+		Host:    journalField(entry, "_HOSTNAME"),
+		PID:     journalField(entry, "_PID"),
+	}
+
+	// 单元名称优先，其次 syslog 标识
+	rec.App = journalField(entry, "_SYSTEMD_UNIT")
+	if rec.App == "" {
+		rec.App = journalField(entry, "SYSLOG_IDENTIFIER")
+	}
+	if rec.App == "" && journalField(entry, "_TRANSPORT") == "kernel" {
+		rec.App = "kernel"
+	}
+	rec.Origin = rec.App + "[" + rec.PID + "]"
+
+	if priority, err := strconv.Atoi(journalField(entry, "PRIORITY")); err == nil {
+		rec.Severity = record.SeverityName(priority)
+	}
+
+	// __REALTIME_TIMESTAMP 为微秒级 Unix 时间戳
+	if usec, err := strconv.ParseInt(journalField(entry, "__REALTIME_TIMESTAMP"), 10, 64); err == nil {
+		rec.Time = time.UnixMicro(usec)
+	}
+
+	rec.SetLabel("unit", journalField(entry, "_SYSTEMD_UNIT"))
+	rec.SetLabel("identifier", journalField(entry, "SYSLOG_IDENTIFIER"))
+	rec.SetLabel("transport", journalField(entry, "_TRANSPORT"))
+	rec.SetLabel("boot_id", journalField(entry, "_BOOT_ID"))
+
+	return rec, journalField(entry, "__CURSOR"), nil
+}
+
+// 读取 journal 字段：字符串直接返回，非 UTF-8 内容以字节数组表示
+func journalField(entry map[string]interface{}, key string) string {
+	switch v := entry[key].(type) {
+	case string:
+		return v
+	case []interface{}:
+		b := make([]byte, 0, len(v))
+		for _, item := range v {
+			if n, ok := item.(float64); ok {
+				b = append(b, byte(n))
+			}
+		}
+		return strings.ToValidUTF8(string(b), "�")
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
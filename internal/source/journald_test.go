@@ -0,0 +1,102 @@
+//go:build !windows
+
+package source
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/record"
+)
+
+// 伪造的 journalctl：记录参数并输出固定的 JSON 日志
+const fakeJournalctl = `#!/bin/sh
+echo "$@" > "$(dirname "$0")/args"
+cat <<'EOF'
+{"__CURSOR":"s=1;i=1","__REALTIME_TIMESTAMP":"1700000000123456","PRIORITY":"3","_SYSTEMD_UNIT":"nginx.service","_HOSTNAME":"web-1","_PID":"42","MESSAGE":"upstream timed out"}
+not json
+{"__CURSOR":"s=1;i=2","__REALTIME_TIMESTAMP":"1700000001000000","PRIORITY":"6","SYSLOG_IDENTIFIER":"kernel","_TRANSPORT":"kernel","MESSAGE":[111,111,109,255]}
+EOF
+`
+
+func TestJournaldSource(t *testing.T) {
+	dir := t.TempDir()
+	command := filepath.Join(dir, "journalctl")
+	if err := os.WriteFile(command, []byte(fakeJournalctl), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cursors, err := LoadCursorStore(filepath.Join(dir, "cursors.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.SourceConfig{
+		Name: "system",
+		Journal: config.JournalConfig{
+			Services: []string{"nginx", "docker"},
+			Priority: "err",
+			Since:    "1 hour ago",
+			Kernel:   true,
+			User:     "1000",
+			Command:  command,
+		},
+	}
+
+	var records []*record.Record
+	src := NewJournaldSource(cfg, cursors)
+	if err := src.Run(context.Background(), func(rec *record.Record) bool {
+		records = append(records, rec)
+		return true
+	}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	for _, want := range []string{"--follow", "--output=json", "--since=1 hour ago", "--priority=err", "--dmesg", "--unit=nginx", "--unit=docker", "_UID=1000"} {
+		if !strings.Contains(string(args), want) {
+			t.Errorf("args %q missing %q", args, want)
+		}
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("records = %d, want 2", len(records))
+	}
+
+	first := records[0]
+	if first.Message != "upstream timed out" || first.App != "nginx.service" || first.Host != "web-1" ||
+		first.PID != "42" || first.Severity != "err" || first.Source != "system" || first.Format != "journald" {
+		t.Errorf("unexpected record: %+v", first)
+	}
+	if !first.Time.Equal(time.UnixMicro(1700000000123456)) {
+		t.Errorf("time = %v", first.Time)
+	}
+
+	second := records[1]
+	if second.App != "kernel" || second.Severity != "info" || !strings.HasPrefix(second.Message, "oom") {
+		t.Errorf("unexpected record: %+v", second)
+	}
+
+	// 游标已保存，重新启动时从游标之后继续，不再使用 since
+	reloaded, err := LoadCursorStore(filepath.Join(dir, "cursors.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.Get("system"); got != "s=1;i=2" {
+		t.Fatalf("cursor = %q", got)
+	}
+
+	resumed, err := NewJournaldSource(cfg, reloaded).Args()
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := strings.Join(resumed, " ")
+	if !strings.Contains(joined, "--after-cursor=s=1;i=2") || strings.Contains(joined, "--since") {
+		t.Errorf("resume args = %v", resumed)
+	}
+}
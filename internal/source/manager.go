@@ -0,0 +1,270 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/input"
+	"github.com/xurenlu/aipipe/internal/monitor"
+	"github.com/xurenlu/aipipe/internal/record"
+)
+
+// 数据源运行状态
+const (
+	StateStarting   = "starting"   // 尚未开始运行
+	StateRunning    = "running"    // 正在运行
+	StateRestarting = "restarting" // 出错退出，等待重启
+	StateFailed     = "failed"     // 无法启动（如监听端口被占用），不再重试
+	StateStopped    = "stopped"    // 已停止
+)
+
+// 数据源状态
+type Status struct {
+	Name        string    `json:"name"`
+	Type        string    `json:"type"`
+	Format      string    `json:"format"`
+	Priority    int       `json:"priority"`
+	Description string    `json:"description,omitempty"`
+	Address     string    `json:"address,omitempty"` // 网络数据源的实际监听地址
+	State       string    `json:"state"`
+	Records     uint64    `json:"records"`  // 已产生的日志记录数
+	Restarts    int       `json:"restarts"` // 出错后的重启次数
+	LastError   string    `json:"last_error,omitempty"`
+	LastRecord  time.Time `json:"last_record,omitempty"`
+}
+
+// 创建数据源所需的公共选项
+type ManagerOptions struct {
+	Input     config.InputConfig     // 输入处理配置
+	Encoding  string                 // 数据源未配置编码时使用的默认编码
+	Positions *monitor.PositionStore // 文件读取位置，为 nil 时不保存
+	Cursors   *CursorStore           // journald 游标，为 nil 时不保存
+	StartFrom string                 // 已有文件的起始读取位置，为空时使用数据源默认值
+}
+
+// 监听网络端口的数据源，在运行前绑定端口以便尽早发现地址冲突
+type listener interface {
+	Listen() (net.Addr, error)
+}
+
+// 根据数据源配置创建数据源
+func NewSource(cfg config.SourceConfig, opts ManagerOptions) (Source, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	encoding := cfg.Encoding
+	if encoding == "" {
+		encoding = opts.Encoding
+	}
+	options := input.NewLineOptions(opts.Input, encoding)
+
+	switch cfg.Type {
+	case "file":
+		src, err := NewFileSource(cfg, options, opts.Positions)
+		if err != nil {
+			return nil, err
+		}
+		if opts.StartFrom != "" {
+			src.SetStartFrom(opts.StartFrom)
+		}
+		return src, nil
+	case "journalctl", "journald":
+		return NewJournaldSource(cfg, opts.Cursors), nil
+	case "syslog":
+		if cfg.Format == "" {
+			cfg.Format = "syslog"
+		}
+		return NewSyslogSource(cfg)
+	case "command":
+		return NewCommandSource(cfg, options)
+	case "http":
+		return NewHTTPSource(cfg)
+	case "otlp":
+		return NewOTLPSource(cfg)
+	case "forward":
+		return NewForwardSource(cfg)
+	case ContainerDocker, ContainerCRI, "kubernetes":
+		src, err := NewContainerSource(cfg, options, opts.Positions)
+		if err != nil {
+			return nil, err
+		}
+		if opts.StartFrom != "" {
+			src.SetStartFrom(opts.StartFrom)
+		}
+		return src, nil
+	}
+	return nil, fmt.Errorf("不支持的数据源类型: %s", cfg.Type)
+}
+
+// 数据源管理器：并发运行多源配置中所有启用的数据源，出错退出的数据源按指数退避重启，
+// 并记录每个数据源的状态。管理器本身也是一个 Source
+type Manager struct {
+	// 数据源状态变化时调用（可选），在数据源各自的协程中调用
+	OnStatus func(Status)
+
+	entries []*managedSource
+	mutex   sync.Mutex
+}
+
+type managedSource struct {
+	source Source
+	status Status
+}
+
+// 创建数据源管理器，按优先级排序并创建所有启用的数据源
+func NewManager(cfg config.MultiSourceConfig, opts ManagerOptions) (*Manager, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	sources := make([]config.SourceConfig, 0, len(cfg.Sources))
+	for _, src := range cfg.Sources {
+		if src.Enabled {
+			sources = append(sources, src)
+		}
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("没有启用的数据源")
+	}
+	sort.SliceStable(sources, func(i, j int) bool {
+		return sources[i].Priority < sources[j].Priority
+	})
+
+	m := &Manager{}
+	for _, srcCfg := range sources {
+		src, err := NewSource(srcCfg, opts)
+		if err != nil {
+			return nil, fmt.Errorf("创建数据源 %s 失败: %w", srcCfg.Name, err)
+		}
+		m.entries = append(m.entries, &managedSource{
+			source: src,
+			status: Status{
+				Name:        srcCfg.Name,
+				Type:        srcCfg.Type,
+				Format:      srcCfg.Format,
+				Priority:    srcCfg.Priority,
+				Description: srcCfg.Description,
+				State:       StateStarting,
+			},
+		})
+	}
+	return m, nil
+}
+
+// 数据源名称
+func (m *Manager) Name() string {
+	return "sources"
+}
+
+// 所有数据源的当前状态，按优先级排序
+func (m *Manager) Statuses() []Status {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	statuses := make([]Status, len(m.entries))
+	for i, entry := range m.entries {
+		statuses[i] = entry.status
+	}
+	return statuses
+}
+
+// 运行所有数据源直到 ctx 取消；所有数据源都无法启动时返回错误
+func (m *Manager) Run(ctx context.Context, emit func(*record.Record) bool) error {
+	// 先绑定所有监听端口，端口冲突的数据源直接标记为失败
+	started := 0
+	for _, entry := range m.entries {
+		if l, ok := entry.source.(listener); ok {
+			addr, err := l.Listen()
+			if err != nil {
+				m.update(entry, func(s *Status) {
+					s.State = StateFailed
+					s.LastError = err.Error()
+				})
+				continue
+			}
+			m.update(entry, func(s *Status) { s.Address = addr.String() })
+		}
+		started++
+	}
+	if started == 0 {
+		return fmt.Errorf("没有可以启动的数据源")
+	}
+
+	var wg sync.WaitGroup
+	for _, entry := range m.entries {
+		if entry.status.State == StateFailed {
+			continue
+		}
+		wg.Add(1)
+		go func(entry *managedSource) {
+			defer wg.Done()
+			m.run(ctx, entry, emit)
+		}(entry)
+	}
+	wg.Wait()
+	return nil
+}
+
+// 运行单个数据源，出错退出后按指数退避重启
+func (m *Manager) run(ctx context.Context, entry *managedSource, emit func(*record.Record) bool) {
+	counted := func(rec *record.Record) bool {
+		m.mutex.Lock()
+		entry.status.Records++
+		entry.status.LastRecord = time.Now()
+		m.mutex.Unlock()
+		rec.Priority = entry.status.Priority
+		return emit(rec)
+	}
+
+	delay := DefaultRestartDelay
+	for {
+		m.update(entry, func(s *Status) { s.State = StateRunning })
+		startedAt := time.Now()
+		err := entry.source.Run(ctx, counted)
+
+		if ctx.Err() != nil || err == nil {
+			// 正常结束（如 journalctl 指定了 --until）或收到停止信号
+			m.update(entry, func(s *Status) { s.State = StateStopped })
+			return
+		}
+
+		// 运行了足够长时间后出错，说明之前是正常的，重新从最短等待时间开始
+		if time.Since(startedAt) > DefaultMaxRestartDelay {
+			delay = DefaultRestartDelay
+		}
+		m.update(entry, func(s *Status) {
+			s.State = StateRestarting
+			s.Restarts++
+			s.LastError = err.Error()
+		})
+
+		select {
+		case <-ctx.Done():
+			m.update(entry, func(s *Status) { s.State = StateStopped })
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > DefaultMaxRestartDelay {
+			delay = DefaultMaxRestartDelay
+		}
+	}
+}
+
+// 更新数据源状态并通知状态变化
+func (m *Manager) update(entry *managedSource, change func(*Status)) {
+	m.mutex.Lock()
+	change(&entry.status)
+	status := entry.status
+	m.mutex.Unlock()
+
+	if m.OnStatus != nil {
+		m.OnStatus(status)
+	}
+}
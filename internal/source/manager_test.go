@@ -0,0 +1,95 @@
+package source
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/monitor"
+	"github.com/xurenlu/aipipe/internal/record"
+)
+
+func TestManager(t *testing.T) {
+	dir := t.TempDir()
+	appLog := filepath.Join(dir, "app.log")
+	writeFile(t, appLog, "first line\n")
+	lateLog := filepath.Join(dir, "late.log")
+
+	manager, err := NewManager(config.MultiSourceConfig{Sources: []config.SourceConfig{
+		{Name: "late", Type: "file", Path: lateLog, Format: "nginx", Enabled: true, Priority: 2},
+		{Name: "app", Type: "file", Path: appLog, Format: "java", Enabled: true, Priority: 1},
+		{Name: "off", Type: "file", Path: appLog, Enabled: false},
+	}}, ManagerOptions{StartFrom: monitor.StartFromBeginning})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := manager.Statuses()
+	if len(statuses) != 2 || statuses[0].Name != "app" || statuses[1].Name != "late" {
+		t.Fatalf("unexpected sources: %+v", statuses)
+	}
+
+	records := make(chan *record.Record, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- manager.Run(ctx, func(rec *record.Record) bool { records <- rec; return true })
+	}()
+
+	select {
+	case rec := <-records:
+		if rec.Message != "first line" || rec.Source != "app" || rec.Format != "java" || rec.Labels["path"] != appLog {
+			t.Errorf("unexpected record: %+v", rec)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout waiting for record")
+	}
+
+	// 文件不存在的数据源等待重启，文件出现后开始读取
+	deadline := time.Now().Add(3 * time.Second)
+	for manager.Statuses()[1].Restarts == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("missing file not restarted: %+v", manager.Statuses()[1])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := os.WriteFile(lateLog, []byte("late line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case rec := <-records:
+		if rec.Message != "late line" || rec.Source != "late" {
+			t.Errorf("unexpected record: %+v", rec)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for late record")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run: %v", err)
+	}
+	for _, status := range manager.Statuses() {
+		if status.State != StateStopped || status.Records != 1 {
+			t.Errorf("unexpected status: %+v", status)
+		}
+	}
+}
+
+func TestManagerListenFailure(t *testing.T) {
+	manager, err := NewManager(config.MultiSourceConfig{Sources: []config.SourceConfig{
+		{Name: "bad", Type: "syslog", Syslog: config.SyslogConfig{Listen: "tcp://256.0.0.1:1"}, Enabled: true},
+	}}, ManagerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Run(context.Background(), func(*record.Record) bool { return true }); err == nil {
+		t.Fatal("expected error when no source can start")
+	}
+	if status := manager.Statuses()[0]; status.State != StateFailed || status.LastError == "" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
@@ -0,0 +1,257 @@
+package source
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// msgpack 扩展类型
+type msgpackExt struct {
+	Type int8
+	Data []byte
+}
+
+// 流式 msgpack 解码器：从连接中逐个读取值
+// 数组和映射解码为 []interface{} 和 map[string]interface{}，整数为 int64 或 uint64，bin 为 []byte
+type msgpackDecoder struct {
+	r        *bufio.Reader
+	maxSize  int // 单个字符串、二进制或扩展数据的最大字节数
+	maxItems int // 单个数组或映射的最大元素数，0 表示只受 maxSize 限制
+}
+
+func newMsgpackDecoder(r io.Reader, maxSize int) *msgpackDecoder {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReaderSize(r, 64*1024)
+	}
+	return &msgpackDecoder{r: br, maxSize: maxSize}
+}
+
+// 读取下一个值
+func (d *msgpackDecoder) Decode() (interface{}, error) {
+	return d.decode(0)
+}
+
+// 最大嵌套深度，防止恶意数据导致栈溢出
+const msgpackMaxDepth = 64
+
+func (d *msgpackDecoder) decode(depth int) (interface{}, error) {
+	if depth > msgpackMaxDepth {
+		return nil, fmt.Errorf("msgpack 嵌套过深")
+	}
+
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b&0xf0 == 0x80:
+		return d.decodeMap(int(b&0x0f), depth)
+	case b&0xf0 == 0x90:
+		return d.decodeArray(int(b&0x0f), depth)
+	case b&0xe0 == 0xa0:
+		return d.readString(int(b & 0x1f))
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.readLength(b - 0xc4)
+		if err != nil {
+			return nil, err
+		}
+		return d.readBytes(n)
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.readLength(b - 0xc7)
+		if err != nil {
+			return nil, err
+		}
+		return d.readExt(n)
+	case 0xca:
+		v, err := d.readUint(4)
+		return float64(math.Float32frombits(uint32(v))), err
+	case 0xcb:
+		v, err := d.readUint(8)
+		return math.Float64frombits(v), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		v, err := d.readUint(1 << (b - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if v > math.MaxInt64 {
+			return v, nil
+		}
+		return int64(v), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (b - 0xd0)
+		v, err := d.readUint(size)
+		if err != nil {
+			return nil, err
+		}
+		// 按位宽做符号扩展
+		shift := 64 - 8*size
+		return int64(v<<shift) >> shift, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.readExt(1 << (b - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.readLength(b - 0xd9)
+		if err != nil {
+			return nil, err
+		}
+		return d.readString(n)
+	case 0xdc, 0xdd:
+		n, err := d.readLength(b - 0xdc + 1)
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(n, depth)
+	case 0xde, 0xdf:
+		n, err := d.readLength(b - 0xde + 1)
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(n, depth)
+	}
+
+	return nil, fmt.Errorf("无效的 msgpack 类型: 0x%02x", b)
+}
+
+// 读取长度字段：0 为 1 字节，1 为 2 字节，2 为 4 字节
+func (d *msgpackDecoder) readLength(kind byte) (int, error) {
+	v, err := d.readUint(1 << kind)
+	if err != nil {
+		return 0, err
+	}
+	if v > uint64(d.maxSize) {
+		return 0, fmt.Errorf("msgpack 数据过大: %d 字节", v)
+	}
+	return int(v), nil
+}
+
+func (d *msgpackDecoder) readUint(size int) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(d.r, buf[8-size:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+func (d *msgpackDecoder) readBytes(n int) ([]byte, error) {
+	if n > d.maxSize {
+		return nil, fmt.Errorf("msgpack 数据过大: %d 字节", n)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (d *msgpackDecoder) readString(n int) (string, error) {
+	buf, err := d.readBytes(n)
+	return string(buf), err
+}
+
+func (d *msgpackDecoder) readExt(n int) (msgpackExt, error) {
+	typ, err := d.r.ReadByte()
+	if err != nil {
+		return msgpackExt{}, err
+	}
+	data, err := d.readBytes(n)
+	return msgpackExt{Type: int8(typ), Data: data}, err
+}
+
+// 检查数组或映射的元素数
+func (d *msgpackDecoder) checkItems(n int) error {
+	if d.maxItems > 0 && n > d.maxItems {
+		return fmt.Errorf("msgpack 元素过多: %d 个", n)
+	}
+	return nil
+}
+
+func (d *msgpackDecoder) decodeArray(n, depth int) ([]interface{}, error) {
+	if err := d.checkItems(n); err != nil {
+		return nil, err
+	}
+	// 元素数来自不可信数据，不预先分配
+	var values []interface{}
+	for i := 0; i < n; i++ {
+		v, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func (d *msgpackDecoder) decodeMap(n, depth int) (map[string]interface{}, error) {
+	if err := d.checkItems(n); err != nil {
+		return nil, err
+	}
+	values := make(map[string]interface{})
+	for i := 0; i < n; i++ {
+		key, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		values[msgpackString(key)] = value
+	}
+	return values, nil
+}
+
+// 将 msgpack 值转换为字符串（Fluent Bit 常把字符串编码为 bin）
+func msgpackString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// 编码只包含字符串的映射，用于回复 ack
+func encodeMsgpackStringMap(values map[string]string) []byte {
+	buf := []byte{0x80 | byte(len(values))}
+	for key, value := range values {
+		buf = appendMsgpackString(buf, key)
+		buf = appendMsgpackString(buf, value)
+	}
+	return buf
+}
+
+func appendMsgpackString(buf []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		buf = append(buf, 0xa0|byte(n))
+	case n < 1<<8:
+		buf = append(buf, 0xd9, byte(n))
+	case n < 1<<16:
+		buf = append(buf, 0xda)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, 0xdb)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(n))
+	}
+	return append(buf, s...)
+}
@@ -0,0 +1,412 @@
+package source
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/record"
+)
+
+// OTLP/HTTP 日志接收路径和默认端口
+const (
+	OTLPLogsPath      = "/v1/logs"
+	DefaultOTLPListen = ":4318"
+)
+
+// 创建 OTLP/HTTP 日志接收器，未配置监听地址时使用 OTLP 默认端口 4318
+func NewOTLPSource(cfg config.SourceConfig) (*HTTPSource, error) {
+	if cfg.HTTP.Listen == "" && cfg.Path == "" {
+		cfg.HTTP.Listen = DefaultOTLPListen
+	}
+	return NewHTTPSource(cfg)
+}
+
+// OTLP 日志请求 (ExportLogsServiceRequest)，字段名与 OTLP JSON 编码一致
+type otlpLogsRequest struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope       `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         otlpInt        `json:"timeUnixNano"`
+	ObservedTimeUnixNano otlpInt        `json:"observedTimeUnixNano"`
+	SeverityNumber       int            `json:"severityNumber"`
+	SeverityText         string         `json:"severityText"`
+	Body                 otlpAnyValue   `json:"body"`
+	Attributes           []otlpKeyValue `json:"attributes"`
+	TraceID              string         `json:"traceId"` // 十六进制
+	SpanID               string         `json:"spanId"`  // 十六进制
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string           `json:"stringValue,omitempty"`
+	BoolValue   *bool             `json:"boolValue,omitempty"`
+	IntValue    *otlpInt          `json:"intValue,omitempty"`
+	DoubleValue *float64          `json:"doubleValue,omitempty"`
+	ArrayValue  *otlpArrayValue   `json:"arrayValue,omitempty"`
+	KvlistValue *otlpKeyValueList `json:"kvlistValue,omitempty"`
+	BytesValue  []byte            `json:"bytesValue,omitempty"`
+}
+
+type otlpArrayValue struct {
+	Values []otlpAnyValue `json:"values"`
+}
+
+type otlpKeyValueList struct {
+	Values []otlpKeyValue `json:"values"`
+}
+
+// OTLP JSON 中 64 位整数编码为字符串，也兼容数字
+type otlpInt int64
+
+func (n *otlpInt) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*n = 0
+		return nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		u, uerr := strconv.ParseUint(s, 10, 64)
+		if uerr != nil {
+			return fmt.Errorf("无效的整数: %s", data)
+		}
+		v = int64(u)
+	}
+	*n = otlpInt(v)
+	return nil
+}
+
+// 转换为字符串：字符串直接返回，其他类型渲染为 JSON
+func (v otlpAnyValue) String() string {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return strconv.FormatBool(*v.BoolValue)
+	case v.IntValue != nil:
+		return strconv.FormatInt(int64(*v.IntValue), 10)
+	case v.DoubleValue != nil:
+		return strconv.FormatFloat(*v.DoubleValue, 'g', -1, 64)
+	case v.BytesValue != nil:
+		return hex.EncodeToString(v.BytesValue)
+	case v.ArrayValue != nil, v.KvlistValue != nil:
+		data, _ := json.Marshal(v.plain())
+		return string(data)
+	}
+	return ""
+}
+
+// 转换为普通 Go 值，用于渲染数组和键值对
+func (v otlpAnyValue) plain() interface{} {
+	switch {
+	case v.ArrayValue != nil:
+		values := make([]interface{}, len(v.ArrayValue.Values))
+		for i, item := range v.ArrayValue.Values {
+			values[i] = item.plain()
+		}
+		return values
+	case v.KvlistValue != nil:
+		values := make(map[string]interface{}, len(v.KvlistValue.Values))
+		for _, kv := range v.KvlistValue.Values {
+			values[kv.Key] = kv.Value.plain()
+		}
+		return values
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.IntValue != nil:
+		return int64(*v.IntValue)
+	case v.DoubleValue != nil:
+		return *v.DoubleValue
+	}
+	return v.String()
+}
+
+// 解析 OTLP/HTTP 日志请求，支持 protobuf 和 JSON 编码
+func ParseOTLPLogs(body []byte, contentType string) ([]*record.Record, error) {
+	var req otlpLogsRequest
+	switch {
+	case strings.Contains(contentType, "json"):
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, fmt.Errorf("解析 OTLP JSON 失败: %w", err)
+		}
+	case contentType == "" || strings.Contains(contentType, "protobuf"):
+		if err := decodeMessage(body, req.decodeField); err != nil {
+			return nil, fmt.Errorf("解析 OTLP protobuf 失败: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("不支持的 OTLP 内容类型: %s", contentType)
+	}
+
+	var records []*record.Record
+	for _, resourceLogs := range req.ResourceLogs {
+		for _, scopeLogs := range resourceLogs.ScopeLogs {
+			for _, logRecord := range scopeLogs.LogRecords {
+				records = append(records, otlpRecord(resourceLogs.Resource, scopeLogs.Scope, logRecord))
+			}
+		}
+	}
+	return records, nil
+}
+
+// 将 OTLP LogRecord 转换为记录：资源属性和日志属性都保存为标签
+func otlpRecord(resource otlpResource, scope otlpScope, lr otlpLogRecord) *record.Record {
+	rec := &record.Record{
+		Message:  lr.Body.String(),
+		Severity: otlpSeverity(lr.SeverityNumber, lr.SeverityText),
+		Complete: true,
+	}
+
+	switch {
+	case lr.TimeUnixNano > 0:
+		rec.Time = time.Unix(0, int64(lr.TimeUnixNano))
+	case lr.ObservedTimeUnixNano > 0:
+		rec.Time = time.Unix(0, int64(lr.ObservedTimeUnixNano))
+	}
+
+	for _, kv := range resource.Attributes {
+		rec.SetLabel(kv.Key, kv.Value.String())
+	}
+	for _, kv := range lr.Attributes {
+		rec.SetLabel(kv.Key, kv.Value.String())
+	}
+	rec.SetLabel("otel.scope.name", scope.Name)
+	rec.SetLabel("trace_id", lr.TraceID)
+	rec.SetLabel("span_id", lr.SpanID)
+
+	rec.App = rec.Labels["service.name"]
+	rec.Host = firstNonEmpty(rec.Labels["host.name"], rec.Labels["k8s.pod.name"], rec.Labels["k8s.node.name"])
+	rec.PID = rec.Labels["process.pid"]
+	return rec
+}
+
+// OTLP SeverityNumber 转换为 syslog 严重级别名称，没有数值时使用 SeverityText
+func otlpSeverity(number int, text string) string {
+	switch {
+	case number >= 21:
+		return "crit"
+	case number >= 17:
+		return "err"
+	case number >= 13:
+		return "warning"
+	case number >= 9:
+		return "info"
+	case number >= 1:
+		return "debug"
+	}
+	return strings.ToLower(text)
+}
+
+// 解析 protobuf 消息，每个字段调用一次 fn
+func decodeMessage(data []byte, fn func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		var value []byte
+		var scalar uint64
+		switch typ {
+		case protowire.VarintType:
+			scalar, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed64Type:
+			scalar, n = protowire.ConsumeFixed64(data)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(data)
+			scalar = uint64(v)
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if err := fn(num, typ, value, scalar); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *otlpLogsRequest) decodeField(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error {
+	if num == 1 && typ == protowire.BytesType {
+		var rl otlpResourceLogs
+		if err := decodeMessage(value, rl.decodeField); err != nil {
+			return err
+		}
+		r.ResourceLogs = append(r.ResourceLogs, rl)
+	}
+	return nil
+}
+
+func (r *otlpResourceLogs) decodeField(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error {
+	if typ != protowire.BytesType {
+		return nil
+	}
+	switch num {
+	case 1:
+		return decodeMessage(value, r.Resource.decodeField)
+	case 2:
+		var sl otlpScopeLogs
+		if err := decodeMessage(value, sl.decodeField); err != nil {
+			return err
+		}
+		r.ScopeLogs = append(r.ScopeLogs, sl)
+	}
+	return nil
+}
+
+func (r *otlpResource) decodeField(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error {
+	if num == 1 && typ == protowire.BytesType {
+		return appendKeyValue(&r.Attributes, value)
+	}
+	return nil
+}
+
+func (s *otlpScopeLogs) decodeField(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error {
+	if typ != protowire.BytesType {
+		return nil
+	}
+	switch num {
+	case 1:
+		return decodeMessage(value, s.Scope.decodeField)
+	case 2:
+		var lr otlpLogRecord
+		if err := decodeMessage(value, lr.decodeField); err != nil {
+			return err
+		}
+		s.LogRecords = append(s.LogRecords, lr)
+	}
+	return nil
+}
+
+func (s *otlpScope) decodeField(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error {
+	switch num {
+	case 1:
+		s.Name = string(value)
+	case 2:
+		s.Version = string(value)
+	}
+	return nil
+}
+
+func (lr *otlpLogRecord) decodeField(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error {
+	switch num {
+	case 1:
+		lr.TimeUnixNano = otlpInt(scalar)
+	case 11:
+		lr.ObservedTimeUnixNano = otlpInt(scalar)
+	case 2:
+		lr.SeverityNumber = int(scalar)
+	case 3:
+		lr.SeverityText = string(value)
+	case 5:
+		return decodeMessage(value, lr.Body.decodeField)
+	case 6:
+		return appendKeyValue(&lr.Attributes, value)
+	case 9:
+		lr.TraceID = hex.EncodeToString(value)
+	case 10:
+		lr.SpanID = hex.EncodeToString(value)
+	}
+	return nil
+}
+
+func (kv *otlpKeyValue) decodeField(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error {
+	switch num {
+	case 1:
+		kv.Key = string(value)
+	case 2:
+		return decodeMessage(value, kv.Value.decodeField)
+	}
+	return nil
+}
+
+func (v *otlpAnyValue) decodeField(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error {
+	switch num {
+	case 1:
+		s := string(value)
+		v.StringValue = &s
+	case 2:
+		b := scalar != 0
+		v.BoolValue = &b
+	case 3:
+		n := otlpInt(scalar)
+		v.IntValue = &n
+	case 4:
+		f := math.Float64frombits(scalar)
+		v.DoubleValue = &f
+	case 5:
+		v.ArrayValue = &otlpArrayValue{}
+		return decodeMessage(value, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error {
+			if num != 1 {
+				return nil
+			}
+			var item otlpAnyValue
+			if err := decodeMessage(value, item.decodeField); err != nil {
+				return err
+			}
+			v.ArrayValue.Values = append(v.ArrayValue.Values, item)
+			return nil
+		})
+	case 6:
+		v.KvlistValue = &otlpKeyValueList{}
+		return decodeMessage(value, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error {
+			if num != 1 {
+				return nil
+			}
+			return appendKeyValue(&v.KvlistValue.Values, value)
+		})
+	case 7:
+		v.BytesValue = append([]byte{}, value...)
+	}
+	return nil
+}
+
+func appendKeyValue(list *[]otlpKeyValue, data []byte) error {
+	var kv otlpKeyValue
+	if err := decodeMessage(data, kv.decodeField); err != nil {
+		return err
+	}
+	*list = append(*list, kv)
+	return nil
+}
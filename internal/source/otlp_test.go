@@ -0,0 +1,127 @@
+package source
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/xurenlu/aipipe/internal/record"
+)
+
+// 按 OTLP logs.proto 的字段编号手工编码请求
+func encodeOTLPRequest() []byte {
+	stringValue := func(s string) []byte {
+		return protowire.AppendString(protowire.AppendTag(nil, 1, protowire.BytesType), s)
+	}
+	keyValue := func(key string, value []byte) []byte {
+		b := protowire.AppendString(protowire.AppendTag(nil, 1, protowire.BytesType), key)
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		return protowire.AppendBytes(b, value)
+	}
+	field := func(b []byte, num protowire.Number, value []byte) []byte {
+		return protowire.AppendBytes(protowire.AppendTag(b, num, protowire.BytesType), value)
+	}
+
+	var intValue []byte
+	intValue = protowire.AppendTag(intValue, 3, protowire.VarintType)
+	intValue = protowire.AppendVarint(intValue, 500)
+
+	var logRecord []byte
+	logRecord = protowire.AppendTag(logRecord, 1, protowire.Fixed64Type)
+	logRecord = protowire.AppendFixed64(logRecord, 1700000000000000000)
+	logRecord = protowire.AppendTag(logRecord, 2, protowire.VarintType)
+	logRecord = protowire.AppendVarint(logRecord, 17)
+	logRecord = field(logRecord, 3, []byte("ERROR"))
+	logRecord = field(logRecord, 5, stringValue("payment failed"))
+	logRecord = field(logRecord, 6, keyValue("http.status_code", intValue))
+	logRecord = field(logRecord, 9, []byte{0x5b, 0x8e, 0xff, 0xf7, 0x98, 0x03, 0x81, 0x03, 0xd2, 0x69, 0xb6, 0x33, 0x81, 0x3f, 0xc6, 0x0c})
+	logRecord = field(logRecord, 10, []byte{0xee, 0xe1, 0x9b, 0x7e, 0xc3, 0xc1, 0xb1, 0x74})
+
+	scopeLogs := field(nil, 1, field(nil, 1, []byte("checkout")))
+	scopeLogs = field(scopeLogs, 2, logRecord)
+
+	var resource []byte
+	resource = field(resource, 1, keyValue("service.name", stringValue("payments")))
+	resource = field(resource, 1, keyValue("k8s.namespace.name", stringValue("prod")))
+	resource = field(resource, 1, keyValue("k8s.pod.name", stringValue("payments-7d9f")))
+
+	resourceLogs := field(nil, 1, resource)
+	resourceLogs = field(resourceLogs, 2, scopeLogs)
+
+	return field(nil, 1, resourceLogs)
+}
+
+const otlpJSONRequest = `{
+  "resourceLogs": [{
+    "resource": {"attributes": [
+      {"key": "service.name", "value": {"stringValue": "payments"}},
+      {"key": "k8s.namespace.name", "value": {"stringValue": "prod"}},
+      {"key": "k8s.pod.name", "value": {"stringValue": "payments-7d9f"}}
+    ]},
+    "scopeLogs": [{
+      "scope": {"name": "checkout"},
+      "logRecords": [{
+        "timeUnixNano": "1700000000000000000",
+        "severityNumber": 17,
+        "severityText": "ERROR",
+        "body": {"stringValue": "payment failed"},
+        "attributes": [{"key": "http.status_code", "value": {"intValue": "500"}}],
+        "traceId": "5b8efff798038103d269b633813fc60c",
+        "spanId": "eee19b7ec3c1b174"
+      }]
+    }]
+  }]
+}`
+
+func TestParseOTLPLogs(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        []byte
+		contentType string
+	}{
+		{"protobuf", encodeOTLPRequest(), "application/x-protobuf"},
+		{"json", []byte(otlpJSONRequest), "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := ParseOTLPLogs(tt.body, tt.contentType)
+			if err != nil {
+				t.Fatalf("ParseOTLPLogs: %v", err)
+			}
+			if len(records) != 1 {
+				t.Fatalf("records = %d, want 1", len(records))
+			}
+			checkOTLPRecord(t, records[0])
+		})
+	}
+
+	if _, err := ParseOTLPLogs([]byte{0xff}, "application/x-protobuf"); err == nil {
+		t.Error("expected error for invalid protobuf")
+	}
+}
+
+func checkOTLPRecord(t *testing.T, rec *record.Record) {
+	t.Helper()
+
+	if rec.Message != "payment failed" || rec.Severity != "err" || rec.App != "payments" || rec.Host != "payments-7d9f" {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+	if !rec.Time.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("time = %v", rec.Time)
+	}
+
+	labels := map[string]string{
+		"k8s.namespace.name": "prod",
+		"http.status_code":   "500",
+		"otel.scope.name":    "checkout",
+		"trace_id":           "5b8efff798038103d269b633813fc60c",
+		"span_id":            "eee19b7ec3c1b174",
+	}
+	for key, want := range labels {
+		if got := rec.Labels[key]; got != want {
+			t.Errorf("label %s = %q, want %q", key, got, want)
+		}
+	}
+}
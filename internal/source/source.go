@@ -0,0 +1,16 @@
+package source
+
+import (
+	"context"
+
+	"github.com/xurenlu/aipipe/internal/record"
+)
+
+// 数据源：持续产生日志记录，直到 ctx 被取消
+type Source interface {
+	// 数据源名称
+	Name() string
+	// 运行数据源，每条日志调用一次 emit；ctx 取消后返回。
+	// emit 返回 false 表示日志没有被接收（如处理队列已满被丢弃），需要确认送达的数据源据此决定是否确认
+	Run(ctx context.Context, emit func(*record.Record) bool) error
+}
@@ -0,0 +1,290 @@
+package source
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/record"
+)
+
+// 默认单条消息最大字节数
+const DefaultSyslogMessageSize = 64 * 1024
+
+// syslog 接收器：监听 UDP、TCP 或 unix socket，接收 RFC 3164/5424 消息
+type SyslogSource struct {
+	name    string
+	format  string
+	network string
+	address string
+	maxSize int
+
+	listener net.Listener
+	packet   net.PacketConn
+	conns    map[net.Conn]struct{}
+	mutex    sync.Mutex
+	emitMu   sync.Mutex
+}
+
+// 创建 syslog 接收器，监听地址格式为 udp://host:port、tcp://host:port、unix:///path 或 unixgram:///path
+func NewSyslogSource(cfg config.SourceConfig) (*SyslogSource, error) {
+	listen := cfg.Syslog.Listen
+	if listen == "" {
+		listen = cfg.Path
+	}
+	network, address, err := parseListenAddress(listen)
+	if err != nil {
+		return nil, err
+	}
+
+	format := cfg.Format
+	if format == "" {
+		format = "syslog"
+	}
+	maxSize := cfg.Syslog.MaxMessageSize
+	if maxSize <= 0 {
+		maxSize = DefaultSyslogMessageSize
+	}
+
+	return &SyslogSource{
+		name:    cfg.Name,
+		format:  format,
+		network: network,
+		address: address,
+		maxSize: maxSize,
+		conns:   make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// 解析监听地址，没有协议前缀时默认 UDP
+func parseListenAddress(listen string) (string, string, error) {
+	if listen == "" {
+		return "", "", fmt.Errorf("syslog 监听地址不能为空")
+	}
+
+	network, address, ok := strings.Cut(listen, "://")
+	if !ok {
+		return "udp", listen, nil
+	}
+
+	switch network {
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6", "unix", "unixgram":
+	default:
+		return "", "", fmt.Errorf("不支持的 syslog 协议: %s (支持 udp, tcp, unix, unixgram)", network)
+	}
+	if address == "" {
+		return "", "", fmt.Errorf("syslog 监听地址不能为空: %s", listen)
+	}
+	return network, address, nil
+}
+
+// 数据源名称
+func (s *SyslogSource) Name() string {
+	return s.name
+}
+
+// 开始监听并返回实际监听地址（端口为 0 时由系统分配），Run 之前调用可提前发现端口占用等错误
+func (s *SyslogSource) Listen() (net.Addr, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.listener != nil {
+		return s.listener.Addr(), nil
+	}
+	if s.packet != nil {
+		return s.packet.LocalAddr(), nil
+	}
+
+	if strings.HasPrefix(s.network, "unix") {
+		// 清理上次异常退出留下的 socket 文件
+		if info, err := os.Lstat(s.address); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(s.address)
+		}
+	}
+
+	var err error
+	switch s.network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		s.listener, err = net.Listen(s.network, s.address)
+		if err == nil {
+			return s.listener.Addr(), nil
+		}
+	default:
+		s.packet, err = net.ListenPacket(s.network, s.address)
+		if err == nil {
+			return s.packet.LocalAddr(), nil
+		}
+	}
+	return nil, fmt.Errorf("syslog 监听 %s://%s 失败: %w", s.network, s.address, err)
+}
+
+// 接收消息直到 ctx 取消
+func (s *SyslogSource) Run(ctx context.Context, emit func(*record.Record) bool) error {
+	if _, err := s.Listen(); err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		s.close()
+	}()
+
+	if s.packet != nil {
+		return s.servePacket(ctx, emit)
+	}
+	return s.serveStream(ctx, emit)
+}
+
+// 关闭监听和所有连接
+func (s *SyslogSource) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	if s.packet != nil {
+		s.packet.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// 数据报协议：每个数据报为一条消息
+func (s *SyslogSource) servePacket(ctx context.Context, emit func(*record.Record) bool) error {
+	buf := make([]byte, s.maxSize)
+	for {
+		n, addr, err := s.packet.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("syslog 接收失败: %w", err)
+		}
+		s.handle(buf[:n], addr, emit)
+	}
+}
+
+// 流协议：每个连接独立读取，支持换行分隔和 octet counting 两种分帧方式
+func (s *SyslogSource) serveStream(ctx context.Context, emit func(*record.Record) bool) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return fmt.Errorf("syslog 接受连接失败: %w", err)
+		}
+
+		s.mutex.Lock()
+		s.conns[conn] = struct{}{}
+		s.mutex.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveConn(conn, emit)
+
+			s.mutex.Lock()
+			delete(s.conns, conn)
+			s.mutex.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// 读取一个连接上的所有消息
+func (s *SyslogSource) serveConn(conn net.Conn, emit func(*record.Record) bool) {
+	reader := bufio.NewReaderSize(conn, 64*1024)
+	for {
+		msg, err := s.readFrame(reader)
+		if len(msg) > 0 {
+			s.handle(msg, conn.RemoteAddr(), emit)
+		}
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				fmt.Printf("⚠️  syslog 连接 %s 读取失败: %v\n", conn.RemoteAddr(), err)
+			}
+			return
+		}
+	}
+}
+
+// 读取一帧：以数字开头时为 octet counting (RFC 6587 "LEN SP MSG")，否则按换行分隔
+func (s *SyslogSource) readFrame(reader *bufio.Reader) ([]byte, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if first[0] >= '1' && first[0] <= '9' {
+		header, err := reader.ReadString(' ')
+		if err != nil {
+			return nil, err
+		}
+		length, err := strconv.Atoi(strings.TrimSuffix(header, " "))
+		if err != nil || length > s.maxSize {
+			return nil, fmt.Errorf("无效的 octet counting 长度: %q", header)
+		}
+		msg := make([]byte, length)
+		if _, err := io.ReadFull(reader, msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+	}
+
+	var msg []byte
+	for {
+		line, err := reader.ReadSlice('\n')
+		if len(msg)+len(line) <= s.maxSize {
+			msg = append(msg, line...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		return msg, err
+	}
+}
+
+// 解析并发送一条消息，并发连接的 emit 调用会串行执行
+func (s *SyslogSource) handle(data []byte, addr net.Addr, emit func(*record.Record) bool) {
+	rec, err := ParseSyslog(data, time.Now())
+	if err != nil {
+		return
+	}
+
+	rec.Source = s.name
+	rec.Format = s.format
+	if addr != nil && addr.String() != "" {
+		remote := addr.String()
+		if host, _, err := net.SplitHostPort(remote); err == nil {
+			remote = host
+		}
+		rec.SetLabel("remote", remote)
+	}
+	if rec.Host == "" {
+		rec.Host = rec.Labels["remote"]
+	}
+	rec.Origin = rec.Host + " " + rec.App + "[" + rec.PID + "]"
+
+	s.emitMu.Lock()
+	defer s.emitMu.Unlock()
+	emit(rec)
+}
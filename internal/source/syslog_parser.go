@@ -0,0 +1,217 @@
+package source
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/record"
+)
+
+// syslog 设施名称，下标即设施编号
+var facilityNames = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// 没有 PRI 时的默认值：user.notice
+const defaultPriority = 13
+
+// 解析一条 syslog 消息，自动识别 RFC 5424 和 RFC 3164 (BSD) 格式
+func ParseSyslog(data []byte, now time.Time) (*record.Record, error) {
+	msg := strings.TrimRight(string(data), "\r\n\x00")
+	if strings.TrimSpace(msg) == "" {
+		return nil, fmt.Errorf("空的 syslog 消息")
+	}
+
+	priority, rest, err := parsePriority(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &record.Record{Severity: record.SeverityName(priority % 8)}
+	if facility := priority / 8; facility < len(facilityNames) {
+		rec.SetLabel("facility", facilityNames[facility])
+	}
+
+	if strings.HasPrefix(rest, "1 ") {
+		err = parseRFC5424(rec, rest[2:])
+	} else {
+		parseRFC3164(rec, rest, now)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+// 解析 <PRI>，没有 PRI 时使用默认值
+func parsePriority(msg string) (int, string, error) {
+	if !strings.HasPrefix(msg, "<") {
+		return defaultPriority, msg, nil
+	}
+
+	end := strings.IndexByte(msg, '>')
+	if end < 2 || end > 4 {
+		return 0, "", fmt.Errorf("无效的 syslog PRI: %.10q", msg)
+	}
+	priority, err := strconv.Atoi(msg[1:end])
+	if err != nil || priority > 191 {
+		return 0, "", fmt.Errorf("无效的 syslog PRI: %s", msg[:end+1])
+	}
+	return priority, msg[end+1:], nil
+}
+
+// 解析 RFC 5424: TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+func parseRFC5424(rec *record.Record, msg string) error {
+	fields := make([]string, 5)
+	for i := range fields {
+		var ok bool
+		fields[i], msg, ok = strings.Cut(msg, " ")
+		if !ok && i < len(fields)-1 {
+			return fmt.Errorf("RFC 5424 消息头不完整")
+		}
+	}
+
+	if fields[0] != "-" {
+		t, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return fmt.Errorf("无效的 RFC 5424 时间戳: %s", fields[0])
+		}
+		rec.Time = t
+	}
+	rec.Host = nilValue(fields[1])
+	rec.App = nilValue(fields[2])
+	rec.PID = nilValue(fields[3])
+	rec.SetLabel("msgid", nilValue(fields[4]))
+
+	if msg == "-" || strings.HasPrefix(msg, "- ") {
+		msg = strings.TrimPrefix(strings.TrimPrefix(msg, "-"), " ")
+	} else if strings.HasPrefix(msg, "[") {
+		var err error
+		msg, err = parseStructuredData(rec, msg)
+		if err != nil {
+			return err
+		}
+	}
+
+	rec.Message = strings.TrimPrefix(msg, "\ufeff")
+	return nil
+}
+
+// RFC 5424 中 "-" 表示空值
+func nilValue(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
+// 解析结构化数据 [id key="value" ...]，参数保存为 id.key 标签，返回剩余的消息
+func parseStructuredData(rec *record.Record, msg string) (string, error) {
+	for strings.HasPrefix(msg, "[") {
+		i := 1
+		for i < len(msg) && msg[i] != ' ' && msg[i] != ']' {
+			i++
+		}
+		if i >= len(msg) {
+			return "", fmt.Errorf("结构化数据不完整")
+		}
+		id := msg[1:i]
+
+		for i < len(msg) && msg[i] == ' ' {
+			i++
+			eq := strings.IndexByte(msg[i:], '=')
+			if eq < 0 || i+eq+1 >= len(msg) || msg[i+eq+1] != '"' {
+				return "", fmt.Errorf("结构化数据参数无效: %s", id)
+			}
+			name := msg[i : i+eq]
+			i += eq + 2
+
+			// 参数值中 \" \\ \] 为转义字符
+			var value strings.Builder
+			for i < len(msg) && msg[i] != '"' {
+				if msg[i] == '\\' && i+1 < len(msg) && strings.IndexByte(`"\]`, msg[i+1]) >= 0 {
+					i++
+				}
+				value.WriteByte(msg[i])
+				i++
+			}
+			if i >= len(msg) {
+				return "", fmt.Errorf("结构化数据参数未结束: %s", id)
+			}
+			i++
+			rec.SetLabel(id+"."+name, value.String())
+		}
+
+		if i >= len(msg) || msg[i] != ']' {
+			return "", fmt.Errorf("结构化数据未结束: %s", id)
+		}
+		msg = msg[i+1:]
+	}
+
+	return strings.TrimPrefix(msg, " "), nil
+}
+
+// 解析 RFC 3164: TIMESTAMP HOSTNAME TAG[PID]: MSG，各部分缺失时尽量保留原文
+func parseRFC3164(rec *record.Record, msg string, now time.Time) {
+	msg = strings.TrimLeft(msg, " ")
+
+	if len(msg) >= len(time.Stamp) {
+		if t, err := time.ParseInLocation(time.Stamp, msg[:len(time.Stamp)], now.Location()); err == nil {
+			// BSD 时间戳没有年份，跨年时可能属于上一年
+			t = t.AddDate(now.Year(), 0, 0)
+			if t.After(now.Add(24 * time.Hour)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			rec.Time = t
+			msg = strings.TrimLeft(msg[len(time.Stamp):], " ")
+		}
+	}
+	if rec.Time.IsZero() {
+		// 部分实现（如 rsyslog）在 BSD 格式中使用 RFC 3339 时间戳
+		if field, rest, ok := strings.Cut(msg, " "); ok {
+			if t, err := time.Parse(time.RFC3339Nano, field); err == nil {
+				rec.Time = t
+				msg = rest
+			}
+		}
+	}
+
+	// 第一个字段不是 TAG 时视为主机名
+	if field, rest, ok := strings.Cut(msg, " "); ok && !isTag(field) && !rec.Time.IsZero() {
+		rec.Host = field
+		msg = rest
+	}
+
+	if field, rest, ok := strings.Cut(msg, " "); ok && isTag(field) {
+		tag := strings.TrimSuffix(field, ":")
+		if open := strings.IndexByte(tag, '['); open > 0 && strings.HasSuffix(tag, "]") {
+			rec.PID = tag[open+1 : len(tag)-1]
+			tag = tag[:open]
+		}
+		rec.App = tag
+		msg = rest
+	}
+
+	rec.Message = msg
+}
+
+// 是否为 TAG 字段，如 sshd: 或 sshd[123]:
+func isTag(field string) bool {
+	if !strings.HasSuffix(field, ":") || len(field) < 2 {
+		return false
+	}
+	for _, c := range strings.TrimSuffix(field, ":") {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("-_./[]", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,135 @@
+package source
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/record"
+)
+
+func TestParseSyslog(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		input string
+		want  record.Record
+	}{
+		{
+			name:  "rfc3164",
+			input: "<34>Oct 11 22:14:15 mymachine su[230]: 'su root' failed for lonvick on /dev/pts/8",
+			want: record.Record{
+				Time: time.Date(2023, 10, 11, 22, 14, 15, 0, time.UTC), Host: "mymachine", App: "su", PID: "230",
+				Severity: "crit", Message: "'su root' failed for lonvick on /dev/pts/8",
+				Labels: map[string]string{"facility": "auth"},
+			},
+		},
+		{
+			name:  "rfc3164 without host",
+			input: "<13>sshd: Connection closed",
+			want: record.Record{
+				App: "sshd", Severity: "notice", Message: "Connection closed",
+				Labels: map[string]string{"facility": "user"},
+			},
+		},
+		{
+			name:  "rfc5424",
+			input: `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="App\"lication"][meta seq="1"] An application event`,
+			want: record.Record{
+				Time: time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC), Host: "mymachine.example.com", App: "evntslog",
+				Severity: "notice", Message: "An application event",
+				Labels: map[string]string{
+					"facility": "local4", "msgid": "ID47", "exampleSDID@32473.iut": "3",
+					"exampleSDID@32473.eventSource": `App"lication`, "meta.seq": "1",
+				},
+			},
+		},
+		{
+			name:  "rfc5424 nil values",
+			input: "<11>1 - - app 99 - - disk failure",
+			want: record.Record{
+				App: "app", PID: "99", Severity: "err", Message: "disk failure",
+				Labels: map[string]string{"facility": "user"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSyslog([]byte(tt.input), now)
+			if err != nil {
+				t.Fatalf("ParseSyslog: %v", err)
+			}
+			if !got.Time.Equal(tt.want.Time) || got.Host != tt.want.Host || got.App != tt.want.App ||
+				got.PID != tt.want.PID || got.Severity != tt.want.Severity || got.Message != tt.want.Message {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			for key, value := range tt.want.Labels {
+				if got.Labels[key] != value {
+					t.Errorf("label %s = %q, want %q", key, got.Labels[key], value)
+				}
+			}
+		})
+	}
+
+	if _, err := ParseSyslog([]byte("<999>bad"), now); err == nil {
+		t.Error("expected error for invalid PRI")
+	}
+}
+
+func TestSyslogSource(t *testing.T) {
+	for _, network := range []string{"udp", "tcp"} {
+		t.Run(network, func(t *testing.T) {
+			src, err := NewSyslogSource(config.SourceConfig{
+				Name:   "net",
+				Syslog: config.SyslogConfig{Listen: network + "://127.0.0.1:0"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			addr, err := src.Listen()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			records := make(chan *record.Record, 10)
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() {
+				done <- src.Run(ctx, func(rec *record.Record) bool { records <- rec; return true })
+			}()
+
+			conn, err := net.Dial(network, addr.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if network == "udp" {
+				conn.Write([]byte("<11>1 - host1 app 1 - - first"))
+				conn.Write([]byte("<11>1 - host1 app 1 - - second"))
+			} else {
+				// octet counting 和换行分隔混用
+				conn.Write([]byte("29 <11>1 - host1 app 1 - - first<11>1 - host1 app 1 - - second\n"))
+			}
+			conn.Close()
+
+			for _, want := range []string{"first", "second"} {
+				select {
+				case rec := <-records:
+					if rec.Message != want || rec.Host != "host1" || rec.Source != "net" || rec.Format != "syslog" {
+						t.Errorf("got %+v, want message %q", rec, want)
+					}
+				case <-time.After(2 * time.Second):
+					t.Fatalf("timeout waiting for %q", want)
+				}
+			}
+
+			cancel()
+			if err := <-done; err != nil {
+				t.Errorf("Run: %v", err)
+			}
+		})
+	}
+}
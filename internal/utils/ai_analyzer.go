@@ -2,12 +2,15 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/xurenlu/aipipe/internal/config"
@@ -15,12 +18,21 @@ import (
 
 // 日志分析结果
 type LogAnalysis struct {
-	Line         string  `json:"line"`          // 日志行内容
-	Important    bool    `json:"important"`     // 是否重要
-	ShouldFilter bool    `json:"should_filter"` // 是否应该过滤
-	Summary      string  `json:"summary"`       // 摘要
-	Reason       string  `json:"reason"`        // 原因
-	Confidence   float64 `json:"confidence"`    // 置信度
+	Line         string   `json:"line"`                  // 日志行内容
+	Important    bool     `json:"important"`             // 是否重要
+	ShouldFilter bool     `json:"should_filter"`         // 是否应该过滤
+	Summary      string   `json:"summary"`               // 摘要
+	Reason       string   `json:"reason"`                // 原因
+	Confidence   float64  `json:"confidence"`            // 置信度
+	TemplateID   string   `json:"template_id,omitempty"` // 日志模板ID
+	Params       []string `json:"params,omitempty"`      // 模板变量参数
+	Fingerprint  string   `json:"fingerprint,omitempty"` // 异常指纹
+	Exception    string   `json:"exception,omitempty"`   // 异常类型
+	Occurrences  int64    `json:"occurrences,omitempty"` // 相同异常的出现次数（含本次）
+	Repeat       bool     `json:"repeat,omitempty"`      // 重要的异常在重复告警窗口内已告警过，不再告警
+	Rule         string   `json:"rule,omitempty"`        // 匹配的规则ID
+	RuleAction   string   `json:"rule_action,omitempty"` // 匹配规则的动作，filter/ignore/alert 时由规则决定结果而不调用 AI
+	Highlight    string   `json:"highlight,omitempty"`   // highlight 规则的高亮颜色
 }
 
 // AI API 请求和响应结构
@@ -42,17 +54,33 @@ type ChatResponse struct {
 
 // 分析日志内容
 func AnalyzeLog(logLine string, format string, cfg *config.Config) (*LogAnalysis, error) {
-	// 本地预过滤：对于明确的低级别日志，直接过滤，不调用 AI
-	if localAnalysis := tryLocalFilter(logLine); localAnalysis != nil {
-		return localAnalysis, nil
+	return AnalyzeLogContext(context.Background(), logLine, format, cfg)
+}
+
+// 分析日志行，ctx 取消或超时时中止 AI 请求；与监控模式一样先匹配日志模板和规则
+func AnalyzeLogContext(ctx context.Context, logLine string, format string, cfg *config.Config) (*LogAnalysis, error) {
+	return analyzerFor(cfg).AnalyzeContext(ctx, logLine, format)
+}
+
+// AnalyzeLog 使用的分析器，按配置缓存，避免每行重新编译规则和加载日志模板
+var analyzers sync.Map // *config.Config -> *Analyzer
+
+func analyzerFor(cfg *config.Config) *Analyzer {
+	if analyzer, ok := analyzers.Load(cfg); ok {
+		return analyzer.(*Analyzer)
 	}
+	analyzer, _ := analyzers.LoadOrStore(cfg, NewAnalyzer(cfg))
+	return analyzer.(*Analyzer)
+}
 
+// 调用 AI 分析日志内容，labels 为数据源提供的元数据
+func analyzeWithAI(ctx context.Context, logLine string, format string, labels map[string]string, cfg *config.Config) (*LogAnalysis, error) {
 	// 构建系统提示词和用户提示词
 	systemPrompt := buildSystemPrompt(format, cfg)
-	userPrompt := buildUserPrompt(logLine)
+	userPrompt := buildUserPrompt(logLine, labels)
 
 	// 调用 AI API
-	response, err := callAIAPI(systemPrompt, userPrompt, cfg)
+	response, err := callAIAPI(ctx, systemPrompt, userPrompt, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("调用 AI API 失败: %w", err)
 	}
@@ -147,9 +175,23 @@ func buildSystemPrompt(format string, cfg *config.Config) string {
 如果should_filter为false，表示这是重要的日志，需要关注。`, format)
 }
 
-// 构建用户提示词
-func buildUserPrompt(logLine string) string {
-	return fmt.Sprintf("请分析这条日志行：\n%s", logLine)
+// 构建用户提示词，有元数据时按名称排序附在日志之后
+func buildUserPrompt(logLine string, labels map[string]string) string {
+	prompt := fmt.Sprintf("请分析这条日志行：\n%s", logLine)
+	if len(labels) == 0 {
+		return prompt
+	}
+	return prompt + "\n\n日志元数据：\n" + strings.Join(formatLabels(labels), "\n")
+}
+
+// 元数据格式化为按名称排序的 name=value
+func formatLabels(labels map[string]string) []string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return pairs
 }
 
 // 从文件加载提示词
@@ -177,7 +219,7 @@ func loadPromptFromFile(filePath, format string) (string, error) {
 }
 
 // 调用 AI API
-func callAIAPI(systemPrompt, userPrompt string, cfg *config.Config) (string, error) {
+func callAIAPI(ctx context.Context, systemPrompt, userPrompt string, cfg *config.Config) (string, error) {
 	request := ChatRequest{
 		Model: cfg.Model,
 		Messages: []ChatMessage{
@@ -191,7 +233,7 @@ func callAIAPI(systemPrompt, userPrompt string, cfg *config.Config) (string, err
 		return "", err
 	}
 
-	req, err := http.NewRequest("POST", cfg.AIEndpoint, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", cfg.AIEndpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/cache"
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/exception"
+	"github.com/xurenlu/aipipe/internal/pattern"
+	"github.com/xurenlu/aipipe/internal/pipeline"
+	"github.com/xurenlu/aipipe/internal/record"
+	"github.com/xurenlu/aipipe/internal/rule"
+)
+
+// 日志分析器：在 AnalyzeLog 的基础上增加模板挖掘、异常指纹和按模板/指纹缓存
+type Analyzer struct {
+	config        *config.Config
+	rules         *rule.RuleEngine
+	miner         *pattern.TemplateMiner
+	fingerprinter *exception.Fingerprinter
+	exceptions    *exception.Aggregator
+	cache         *cache.CacheManager
+}
+
+// 创建新的日志分析器
+func NewAnalyzer(cfg *config.Config) *Analyzer {
+	a := &Analyzer{
+		config:        cfg,
+		fingerprinter: exception.NewFingerprinter(cfg.Exceptions),
+		exceptions:    exception.NewAggregator(),
+		cache:         cache.NewCacheManager(cfg.Cache),
+	}
+	if len(cfg.Rules) > 0 {
+		a.rules = rule.NewRuleEngine(cfg.Rules)
+	}
+
+	if cfg.Patterns.Enabled {
+		miner, err := pattern.LoadTemplateMiner(cfg.Patterns)
+		if err != nil {
+			fmt.Printf("⚠️  加载日志模板失败，将重新挖掘: %v\n", err)
+		}
+		a.miner = miner
+	}
+
+	return a
+}
+
+// 分析日志行或多行事件
+func (a *Analyzer) Analyze(line, format string) (*LogAnalysis, error) {
+	return a.AnalyzeContext(context.Background(), line, format)
+}
+
+// 分析日志行或多行事件，ctx 取消或超时时中止 AI 请求；可以并发调用
+func (a *Analyzer) AnalyzeContext(ctx context.Context, line, format string) (*LogAnalysis, error) {
+	entry := pipeline.Entry{Format: format, Line: line}
+	a.Prepare(&entry)
+	return a.AnalyzeEntry(ctx, entry)
+}
+
+// 入队前匹配日志模板和规则，结果记录在 entry 中：采样、折叠和分析都使用这一次匹配的结果，
+// 每行只匹配一次，alert 规则在采样之前就能确定。可以并发调用
+func (a *Analyzer) Prepare(entry *pipeline.Entry) {
+	if a.miner != nil {
+		entry.Template = a.miner.Match(entry.Line)
+	}
+	if a.rules != nil {
+		templateID := ""
+		if entry.Template != nil {
+			templateID = entry.Template.TemplateID
+		}
+		entry.Rule = a.rules.FilterLabels(entry.Line, templateID, entry.Labels)
+	}
+}
+
+// 分析已经过 Prepare 的日志，ctx 取消或超时时中止 AI 请求；可以并发调用
+func (a *Analyzer) AnalyzeEntry(ctx context.Context, entry pipeline.Entry) (*LogAnalysis, error) {
+	line, match := entry.Line, entry.Template
+	exc, _ := a.fingerprinter.Parse(line)
+
+	analysis, err := a.analyze(ctx, line, entry.Format, entry.Labels, match, entry.Rule, exc)
+	if err != nil {
+		return nil, err
+	}
+
+	analysis.Line = line
+	analysis.Important = !analysis.ShouldFilter
+	if match != nil {
+		analysis.TemplateID = match.TemplateID
+		analysis.Params = match.Params
+	}
+	if exc != nil {
+		at, ok := record.ExtractTimestamp(line)
+		if !ok {
+			at = time.Now()
+		}
+		group := a.exceptions.Add(exc, at, line)
+		analysis.Fingerprint = exc.Fingerprint
+		analysis.Exception = exc.Class
+		analysis.Occurrences = group.Count
+
+		// 相同异常在窗口内只告警一次，alert 规则匹配的异常总是告警
+		if analysis.Important && analysis.RuleAction != rule.ActionAlert {
+			analysis.Repeat = !a.exceptions.ShouldAlert(exc.Fingerprint, at, a.config.Exceptions.RepeatWindow)
+		}
+	}
+
+	return analysis, nil
+}
+
+func (a *Analyzer) analyze(ctx context.Context, line, format string, labels map[string]string, match *pattern.MatchResult, ruleMatch *rule.FilterResult, exc *exception.Exception) (*LogAnalysis, error) {
+	// 配置的规则优先：filter/ignore/alert 直接决定结果，highlight 只标记输出
+	decided, matched := decideRule(ruleMatch)
+	if decided != nil {
+		return decided, nil
+	}
+
+	// 本地预过滤
+	if localAnalysis := tryLocalFilter(line); localAnalysis != nil {
+		return markRule(localAnalysis, matched), nil
+	}
+
+	// 相同指纹的异常复用 AI 分析结果
+	if exc != nil {
+		if cached, ok := a.cache.GetExceptionAnalysis(exc.Fingerprint); ok {
+			analysis := *cached.(*LogAnalysis)
+			return markRule(&analysis, matched), nil
+		}
+	}
+
+	// 除变量外完全相同的日志复用 AI 分析结果（异常以指纹为准）；
+	// 不按聚类模板复用，同一模板下的 "failed" 和 "succeeded" 结论可能不同
+	if exc == nil && match != nil {
+		if cached, ok := a.cache.GetTemplateAnalysis(match.MaskedID); ok {
+			analysis := *cached.(*LogAnalysis)
+			return markRule(&analysis, matched), nil
+		}
+	}
+
+	analysis, err := analyzeWithAI(ctx, line, format, labels, a.config)
+	if err != nil {
+		return nil, err
+	}
+
+	if exc != nil {
+		cached := *analysis
+		a.cache.CacheExceptionAnalysis(exc.Fingerprint, &cached)
+	} else if match != nil {
+		cached := *analysis
+		a.cache.CacheTemplateAnalysis(match.MaskedID, &cached)
+	}
+
+	return markRule(analysis, matched), nil
+}
+
+// 获取模板挖掘器（未启用时返回 nil）
+func (a *Analyzer) Miner() *pattern.TemplateMiner {
+	return a.miner
+}
+
+// 获取本次运行中的异常统计
+func (a *Analyzer) Exceptions() []exception.Group {
+	return a.exceptions.Groups()
+}
+
+// 关闭分析器并持久化日志模板
+func (a *Analyzer) Close() error {
+	a.cache.Stop()
+
+	if a.miner != nil {
+		return a.miner.Save()
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/pipeline"
+)
+
+// 模拟 AI 服务：包含 failed 的日志判定为重要，返回请求次数计数器
+func fakeAI(t *testing.T, cfg *config.Config) *int64 {
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		var request ChatRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		content := request.Messages[len(request.Messages)-1].Content
+		verdict := fmt.Sprintf(`{"should_filter": %t, "summary": "ok", "reason": "test", "confidence": 0.9}`, !strings.Contains(content, "failed"))
+		json.NewEncoder(w).Encode(ChatResponse{Choices: []struct {
+			Message ChatMessage `json:"message"`
+		}{{Message: ChatMessage{Role: "assistant", Content: verdict}}}})
+	}))
+	t.Cleanup(server.Close)
+
+	cfg.AIEndpoint = server.URL
+	cfg.PromptFile = ""
+	cfg.Patterns.StateFile = filepath.Join(t.TempDir(), "patterns.json")
+	return &calls
+}
+
+func TestAnalyzerTemplateCache(t *testing.T) {
+	cfg := config.DefaultConfig
+	calls := fakeAI(t, &cfg)
+	analyzer := NewAnalyzer(&cfg)
+	defer analyzer.Close()
+
+	// 归入同一模板但结论不同的日志不复用分析结果
+	first, err := analyzer.Analyze("Payment for order 1 failed", "java")
+	if err != nil || !first.Important {
+		t.Fatalf("第一条: %+v, %v", first, err)
+	}
+	second, err := analyzer.Analyze("Payment for order 2 succeeded", "java")
+	if err != nil || second.Important {
+		t.Fatalf("第二条不应复用第一条的结论: %+v, %v", second, err)
+	}
+	if first.TemplateID != second.TemplateID {
+		t.Errorf("期望归入同一模板: %s != %s", first.TemplateID, second.TemplateID)
+	}
+
+	// 只有变量不同的日志复用分析结果
+	third, err := analyzer.Analyze("Payment for order 3 failed", "java")
+	if err != nil || !third.Important {
+		t.Fatalf("第三条: %+v, %v", third, err)
+	}
+	if n := atomic.LoadInt64(calls); n != 2 {
+		t.Errorf("AI 调用 %d 次, 期望 2 次", n)
+	}
+}
+
+// 测试入队前匹配的模板和规则在分析时直接使用，不再重新匹配
+func TestAnalyzerPrepare(t *testing.T) {
+	cfg := config.DefaultConfig
+	calls := fakeAI(t, &cfg)
+	cfg.Rules = []config.FilterRule{
+		{ID: "payments", Pattern: `payment failed`, Action: "alert", Priority: 1, Enabled: true},
+	}
+	analyzer := NewAnalyzer(&cfg)
+	defer analyzer.Close()
+
+	entry := pipeline.Entry{Format: "java", Line: "ERROR payment failed for order 42"}
+	analyzer.Prepare(&entry)
+	if entry.Rule == nil || entry.Rule.Rule.ID != "payments" || entry.Template == nil {
+		t.Fatalf("入队前应匹配规则和模板: %+v", entry)
+	}
+
+	analysis, err := analyzer.AnalyzeEntry(context.Background(), entry)
+	if err != nil || !analysis.Important || analysis.Rule != "payments" || analysis.TemplateID != entry.Template.TemplateID {
+		t.Fatalf("分析结果: %+v, %v", analysis, err)
+	}
+	if n := atomic.LoadInt64(calls); n != 0 {
+		t.Errorf("alert 规则决定的日志调用了 %d 次 AI", n)
+	}
+	if template, ok := analyzer.Miner().GetTemplate(entry.Template.TemplateID); !ok || template.Count != 1 {
+		t.Errorf("模板计数不为 1，每行只应匹配一次: %+v", template)
+	}
+}
+
+// 测试相同异常只在重复告警窗口内抑制，alert 规则匹配的异常总是告警
+func TestAnalyzerRepeatWindow(t *testing.T) {
+	cfg := config.DefaultConfig
+	fakeAI(t, &cfg)
+	cfg.Exceptions.RepeatWindow = 10 * time.Minute
+	cfg.Rules = []config.FilterRule{
+		{ID: "timeouts", Pattern: `TimeoutException`, Action: "alert", Priority: 1, Enabled: true},
+	}
+	analyzer := NewAnalyzer(&cfg)
+	defer analyzer.Close()
+
+	event := func(at, class string) string {
+		return "2026-10-19 " + at + " ERROR order failed\n" + class + ": boom\n\tat com.example.OrderService.create(OrderService.java:42)"
+	}
+	tests := []struct {
+		at, class string
+		repeat    bool
+	}{
+		{"10:00:00", "java.lang.IllegalStateException", false},
+		{"10:05:00", "java.lang.IllegalStateException", true},
+		{"10:11:00", "java.lang.IllegalStateException", false},
+		{"10:00:00", "java.util.concurrent.TimeoutException", false},
+		{"10:00:01", "java.util.concurrent.TimeoutException", false},
+	}
+	for _, tt := range tests {
+		analysis, err := analyzer.Analyze(event(tt.at, tt.class), "java")
+		if err != nil || !analysis.Important {
+			t.Fatalf("%s %s: %+v, %v", tt.at, tt.class, analysis, err)
+		}
+		if analysis.Repeat != tt.repeat {
+			t.Errorf("%s %s 重复 = %v, 期望 %v", tt.at, tt.class, analysis.Repeat, tt.repeat)
+		}
+	}
+}
+
+// 测试数据源的元数据按名称排序附在提示词中
+func TestBuildUserPromptLabels(t *testing.T) {
+	if prompt := buildUserPrompt("charge failed", nil); strings.Contains(prompt, "元数据") {
+		t.Errorf("没有元数据时不应附加: %q", prompt)
+	}
+
+	prompt := buildUserPrompt("charge failed", map[string]string{"trace_id": "4bf92f3577b34da6", "service.name": "payments"})
+	if !strings.HasSuffix(prompt, "日志元数据：\nservice.name=payments\ntrace_id=4bf92f3577b34da6") {
+		t.Errorf("提示词: %q", prompt)
+	}
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xurenlu/aipipe/internal/notification"
+	"github.com/xurenlu/aipipe/internal/pipeline"
+	"github.com/xurenlu/aipipe/internal/rule"
+)
+
+// 通知中日志内容的最大字节数，超过时截断
+const notificationLineLimit = 500
+
+// 重要日志的通知消息：摘要和日志内容，附加折叠的重复次数和之前被抑制的相似日志数；
+// alert 规则匹配的日志级别为 critical
+func AlertNotification(entry pipeline.Entry, analysis *LogAnalysis) *notification.NotificationMessage {
+	var content strings.Builder
+	content.WriteString(analysis.Summary)
+	content.WriteString("\n")
+	content.WriteString(truncateText(entry.Line, notificationLineLimit))
+	if entry.Repeats > 1 {
+		content.WriteString("\n" + RepeatsNote(entry))
+	}
+	if entry.Suppressed > 0 {
+		content.WriteString("\n" + SuppressedNote(entry.Suppressed))
+	}
+
+	metadata := map[string]string{}
+	for key, value := range entry.Labels {
+		metadata[key] = value
+	}
+	if entry.Format != "" {
+		metadata["format"] = entry.Format
+	}
+	if analysis.Rule != "" {
+		metadata["rule"] = analysis.Rule
+	}
+	if analysis.TemplateID != "" {
+		metadata["template_id"] = analysis.TemplateID
+	}
+	if analysis.Fingerprint != "" {
+		metadata["exception"] = analysis.Exception
+		metadata["fingerprint"] = analysis.Fingerprint
+	}
+
+	level := "warning"
+	if analysis.RuleAction == rule.ActionAlert {
+		level = "critical"
+	}
+	source := entry.Source
+	if source == "" {
+		source = "AIPipe"
+	}
+
+	return &notification.NotificationMessage{
+		Title:     "重要日志告警",
+		Content:   content.String(),
+		Level:     level,
+		Timestamp: time.Now(),
+		Source:    source,
+		Metadata:  metadata,
+	}
+}
+
+// 数据源元数据的说明，如 "service.name=payments trace_id=4bf92f35..."
+func LabelsNote(labels map[string]string) string {
+	return strings.Join(formatLabels(labels), " ")
+}
+
+// 截断到最多 limit 字节，不拆分多字节字符
+func truncateText(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "..."
+}
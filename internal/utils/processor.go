@@ -1,79 +1,184 @@
 package utils
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/input"
+	"github.com/xurenlu/aipipe/internal/pipeline"
+	"github.com/xurenlu/aipipe/internal/sampling"
 )
 
-// 处理标准输入
+// 处理标准输入：按 worker_pool 配置并发分析，结果按输入顺序输出，Ctrl+C 时中止正在进行的分析
 func ProcessStdin(cfg *config.Config, showNotImportant bool) {
-	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	reader := input.NewLineReader(os.Stdin, input.NewLineOptions(cfg.Input, ""))
 
 	lineCount := 0
 	filteredCount := 0
 	alertCount := 0
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		lineCount++
-
-		if strings.TrimSpace(line) == "" {
-			continue
-		}
-
-		// 使用 AI 分析日志
-		analysis, err := AnalyzeLog(line, "java", cfg)
-		if err != nil {
+	poolConfig := pipeline.ConfigFrom(cfg)
+	poolConfig.Overflow = pipeline.OverflowBlock
+	poolConfig.QueueTimeout = 0
+	workers, err := pipeline.New(poolConfig, func(ctx context.Context, entry pipeline.Entry) (interface{}, error) {
+		return AnalyzeLogContext(ctx, entry.Line, entry.Format, cfg)
+	}, func(result pipeline.Result) {
+		line := result.Entry.Line
+		if result.Err != nil {
+			if errors.Is(result.Err, context.Canceled) {
+				return
+			}
 			// AI 分析失败，使用简单过滤
 			if shouldFilter(line) {
 				filteredCount++
 				if showNotImportant {
 					fmt.Printf("🔇 [过滤] %s\n", line)
 				}
-				continue
+				return
 			}
 			// 显示日志
 			fmt.Printf("⚠️  [重要] %s\n", line)
 			fmt.Printf("   📝 摘要: %s\n", generateSummary(line))
+			printEntryNotes(result.Entry)
 			alertCount++
-		} else {
-			// AI 分析成功
-			if analysis.ShouldFilter {
-				filteredCount++
-				if showNotImportant {
-					fmt.Printf("🔇 [过滤] %s\n", line)
-					if analysis.Reason != "" {
-						fmt.Printf("   原因: %s\n", analysis.Reason)
-					}
+			return
+		}
+
+		// AI 分析成功
+		analysis := result.Value.(*LogAnalysis)
+		if analysis.ShouldFilter {
+			filteredCount++
+			if showNotImportant {
+				fmt.Printf("🔇 [过滤] %s\n", HighlightLine(line, analysis.Highlight))
+				if note := RuleNote(analysis); note != "" {
+					fmt.Printf("   📏 %s\n", note)
 				}
-			} else {
-				// 重要日志，显示并发送通知
-				fmt.Printf("⚠️  [重要] %s\n", line)
-				fmt.Printf("   📝 摘要: %s\n", analysis.Summary)
 				if analysis.Reason != "" {
 					fmt.Printf("   原因: %s\n", analysis.Reason)
 				}
+			}
+		} else {
+			// 重要日志，显示并发送通知
+			fmt.Printf("⚠️  [重要] %s\n", HighlightLine(line, analysis.Highlight))
+			fmt.Printf("   📝 摘要: %s\n", analysis.Summary)
+			if note := RuleNote(analysis); note != "" {
+				fmt.Printf("   📏 %s\n", note)
+			}
+			if analysis.Reason != "" {
+				fmt.Printf("   原因: %s\n", analysis.Reason)
+			}
+			printEntryNotes(result.Entry)
 
-				// 发送通知
-				go sendNotification(analysis.Summary, line)
-				alertCount++
+			// 发送通知，折叠和抑制的数量附加在摘要后
+			summary := analysis.Summary
+			if result.Entry.Repeats > 1 {
+				summary += " (" + RepeatsNote(result.Entry) + ")"
 			}
+			if result.Entry.Suppressed > 0 {
+				summary += " (" + SuppressedNote(result.Entry.Suppressed) + ")"
+			}
+			go sendNotification(summary, line)
+			alertCount++
 		}
+	})
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
 	}
+	workers.Start(ctx)
 
-	if err := scanner.Err(); err != nil {
-		fmt.Printf("❌ 读取输入失败: %v\n", err)
-		return
+	// 日志洪峰时抑制超过速率的相似日志
+	var sampler *sampling.Sampler
+	stopReport, reportDone := make(chan struct{}), make(chan struct{})
+	if cfg.Sampling.Enabled {
+		sampler = sampling.NewSampler(cfg.Sampling)
+		go ReportSuppressed(sampler, stopReport, reportDone)
+	}
+
+	submit := func(entry pipeline.Entry) {
+		if sampler != nil {
+			decision := sampler.Sample(entry.Source, "", entry.Line, time.Now())
+			if !decision.Pass {
+				return
+			}
+			entry.Suppressed = decision.Suppressed
+		}
+		// 使用 AI 分析日志
+		workers.Submit(entry)
+	}
+
+	// 连续重复的日志折叠为一条后再采样和分析
+	var deduper *pipeline.Deduper
+	stopDedupe := make(chan struct{})
+	if cfg.Dedupe.Enabled {
+		deduper, err = pipeline.NewDeduper(cfg.Dedupe.Window, cfg.Dedupe.Match, submit)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			workers.Close()
+			return
+		}
+		go deduper.FlushEvery(stopDedupe)
+	}
+
+	for ctx.Err() == nil {
+		line, err := reader.ReadLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Printf("❌ 读取输入失败: %v\n", err)
+			break
+		}
+		lineCount++
+
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		entry := pipeline.Entry{Source: "stdin", Format: "java", Line: line}
+		if deduper != nil {
+			deduper.Add(entry, time.Now())
+		} else {
+			submit(entry)
+		}
+	}
+	if deduper != nil {
+		close(stopDedupe)
+		deduper.Close()
+	}
+	workers.Close()
+	if sampler != nil {
+		close(stopReport)
+		<-reportDone
 	}
 
 	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 	fmt.Printf("📊 统计: 总计 %d 行, 过滤 %d 行, 告警 %d 次\n", lineCount, filteredCount, alertCount)
+	if sampler != nil {
+		PrintSamplingStats(sampler)
+	}
+}
+
+// 输出折叠的重复次数和之前被抑制的相似日志数
+func printEntryNotes(entry pipeline.Entry) {
+	if entry.Repeats > 1 {
+		fmt.Printf("   🔁 %s\n", RepeatsNote(entry))
+	}
+	if entry.Suppressed > 0 {
+		fmt.Printf("   🔇 %s\n", SuppressedNote(entry.Suppressed))
+	}
 }
 
 // 简单的过滤逻辑
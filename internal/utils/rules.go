@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"fmt"
+
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/rule"
+)
+
+// 按已匹配的规则判断日志：filter/ignore 直接过滤，alert 直接判定为重要，返回的分析结果不为 nil 时无需再调用 AI；
+// highlight 和未知动作只返回匹配的规则，由本地预过滤和 AI 继续判断
+func decideRule(matched *rule.FilterResult) (*LogAnalysis, *rule.FilterResult) {
+	if matched == nil {
+		return nil, nil
+	}
+
+	r := matched.Rule
+	switch r.Action {
+	case rule.ActionFilter, rule.ActionIgnore:
+		return markRule(&LogAnalysis{
+			ShouldFilter: true,
+			Summary:      ruleSummary(r),
+			Reason:       fmt.Sprintf("规则 %s 匹配，动作 %s", r.ID, r.Action),
+			Confidence:   1,
+		}, matched), nil
+	case rule.ActionAlert:
+		return markRule(&LogAnalysis{
+			ShouldFilter: false,
+			Summary:      ruleSummary(r),
+			Reason:       fmt.Sprintf("规则 %s 匹配，动作 alert", r.ID),
+			Confidence:   1,
+		}, matched), nil
+	}
+	return nil, matched
+}
+
+// 在分析结果中记录匹配的规则
+func markRule(analysis *LogAnalysis, matched *rule.FilterResult) *LogAnalysis {
+	if matched == nil {
+		return analysis
+	}
+	analysis.Rule = matched.Rule.ID
+	analysis.RuleAction = matched.Action
+	if matched.Action == rule.ActionHighlight {
+		analysis.Highlight = matched.Color
+		if analysis.Highlight == "" {
+			analysis.Highlight = "yellow"
+		}
+	}
+	return analysis
+}
+
+func ruleSummary(r config.FilterRule) string {
+	if r.Description != "" {
+		return r.Description
+	}
+	if r.Name != "" {
+		return r.Name
+	}
+	return "规则 " + r.ID
+}
+
+// 按 highlight 规则的颜色高亮日志行，未知颜色使用黄色
+func HighlightLine(line, color string) string {
+	if color == "" {
+		return line
+	}
+	code, ok := rule.HighlightColors[color]
+	if !ok {
+		code = rule.HighlightColors["yellow"]
+	}
+	return code + line + "\033[0m"
+}
+
+// 决定结果的规则说明，没有匹配规则时返回空字符串
+func RuleNote(analysis *LogAnalysis) string {
+	if analysis.Rule == "" {
+		return ""
+	}
+	return fmt.Sprintf("规则: %s (%s)", analysis.Rule, analysis.RuleAction)
+}
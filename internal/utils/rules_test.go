@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/xurenlu/aipipe/internal/config"
+	"github.com/xurenlu/aipipe/internal/pipeline"
+)
+
+func TestAnalyzeLogRules(t *testing.T) {
+	cfg := config.DefaultConfig
+	// AI 不可用，规则决定的日志不应调用 AI
+	cfg.AIEndpoint = "http://127.0.0.1:1/v1"
+	cfg.Patterns.StateFile = filepath.Join(t.TempDir(), "patterns.json")
+	cfg.Rules = []config.FilterRule{
+		{ID: "noise", Pattern: `healthz`, Action: "ignore", Priority: 1, Enabled: true},
+		{ID: "payments", Pattern: `payment failed`, Action: "alert", Priority: 2, Enabled: true, Description: "支付失败"},
+		{ID: "slow", Pattern: `slow query`, Action: "highlight", Priority: 3, Enabled: true, Color: "red"},
+		{ID: "disabled", Pattern: `ERROR`, Action: "ignore", Priority: 0, Enabled: false},
+	}
+
+	analysis, err := AnalyzeLogContext(context.Background(), "ERROR GET /healthz 500", "java", &cfg)
+	if err != nil || !analysis.ShouldFilter || analysis.Rule != "noise" {
+		t.Errorf("ignore 规则: %+v, %v", analysis, err)
+	}
+
+	analysis, err = AnalyzeLogContext(context.Background(), "ERROR payment failed for order 42", "java", &cfg)
+	if err != nil || analysis.ShouldFilter || analysis.Rule != "payments" || analysis.Summary != "支付失败" {
+		t.Errorf("alert 规则: %+v, %v", analysis, err)
+	}
+
+	// highlight 只标记输出，结果仍由本地预过滤或 AI 决定
+	analysis, err = AnalyzeLogContext(context.Background(), "DEBUG slow query took 3s", "java", &cfg)
+	if err != nil || !analysis.ShouldFilter || analysis.Rule != "slow" || analysis.Highlight != "red" {
+		t.Errorf("highlight 规则: %+v, %v", analysis, err)
+	}
+
+	if _, err := AnalyzeLogContext(context.Background(), "ERROR unmatched", "java", &cfg); err == nil {
+		t.Error("没有匹配规则的日志应交给 AI")
+	}
+}
+
+// AnalyzeLog 与监控模式一样先挖掘日志模板，按模板ID配置的规则同样生效
+func TestAnalyzeLogTemplateRule(t *testing.T) {
+	cfg := config.DefaultConfig
+	cfg.AIEndpoint = "http://127.0.0.1:1/v1"
+	cfg.Patterns.StateFile = filepath.Join(t.TempDir(), "patterns.json")
+
+	// 另一个分析器挖掘出的模板ID相同
+	analyzer := NewAnalyzer(&cfg)
+	defer analyzer.Close()
+	entry := pipeline.Entry{Format: "java", Line: "ERROR payment for order 1 failed"}
+	analyzer.Prepare(&entry)
+	if entry.Template == nil {
+		t.Fatal("应挖掘出日志模板")
+	}
+
+	cfg.Rules = []config.FilterRule{
+		{ID: "payments", Template: entry.Template.TemplateID, Action: "ignore", Priority: 1, Enabled: true},
+	}
+	analysis, err := AnalyzeLogContext(context.Background(), "ERROR payment for order 7 failed", "java", &cfg)
+	if err != nil || !analysis.ShouldFilter || analysis.Rule != "payments" {
+		t.Errorf("模板规则: %+v, %v", analysis, err)
+	}
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xurenlu/aipipe/internal/pipeline"
+	"github.com/xurenlu/aipipe/internal/sampling"
+)
+
+// 输出一段时间内被抑制的相似日志汇总
+func PrintSuppressed(summaries []sampling.Summary) {
+	for _, summary := range summaries {
+		span := summary.Last.Sub(summary.First).Round(time.Second)
+		fmt.Printf("🔇 [抑制] %s: %d 条相似日志已抑制 (%s - %s, 持续 %s)\n", summary.Source, summary.Count,
+			summary.First.Format("15:04:05"), summary.Last.Format("15:04:05"), span)
+		fmt.Printf("   示例: %s\n", summary.Example)
+	}
+}
+
+// 定期输出被抑制的日志汇总直到 stop 关闭，退出前输出剩余的汇总
+func ReportSuppressed(sampler *sampling.Sampler, stop chan struct{}, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(sampler.ReportInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			PrintSuppressed(sampler.Flush(now))
+		case <-stop:
+			PrintSuppressed(sampler.FlushAll())
+			return
+		}
+	}
+}
+
+// 输出各数据源的采样统计，没有抑制任何日志时不输出
+func PrintSamplingStats(sampler *sampling.Sampler) {
+	stats := sampler.Stats()
+	var suppressed uint64
+	for _, source := range stats {
+		suppressed += source.Suppressed
+	}
+	if suppressed == 0 {
+		return
+	}
+
+	fmt.Printf("🔇 采样统计: 共抑制 %d 条相似日志\n", suppressed)
+	for _, source := range stats {
+		fmt.Printf("   %s: 放行 %d 条, 抑制 %d 条\n", source.Source, source.Passed, source.Suppressed)
+	}
+}
+
+// 附加被抑制数量的提示，用于输出和通知
+func SuppressedNote(suppressed int) string {
+	return fmt.Sprintf("另有 %d 条相似日志已抑制", suppressed)
+}
+
+// 折叠的重复次数和时间范围，用于输出和通知
+func RepeatsNote(entry pipeline.Entry) string {
+	return fmt.Sprintf("连续重复 %d 次 (%s - %s)", entry.Repeats,
+		entry.FirstSeen.Format("15:04:05"), entry.LastSeen.Format("15:04:05"))
+}